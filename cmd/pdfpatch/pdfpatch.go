@@ -1,85 +1,285 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"strconv"
+	"strings"
 
 	"github.com/motevets/pdfpatch/pkg/api"
+	"github.com/motevets/pdfpatch/pkg/epubbinder"
 	"github.com/motevets/pdfpatch/pkg/extractor"
+	"github.com/motevets/pdfpatch/pkg/fetcher"
 	"github.com/motevets/pdfpatch/pkg/manifest"
 	"github.com/motevets/pdfpatch/pkg/pdfbinder"
 	"github.com/motevets/pdfpatch/pkg/pdfpatch"
+	"github.com/motevets/pdfpatch/pkg/sourcestore"
 )
 
 const usage = `
 pdfpatch SUBCOMMAND ARGS
 
-  SUBCOMMAND: must be extract-text, make-patch, make-patches, apply-patch, bind-pdf, patch-pdfs, patch-bundle, serve
+  SUBCOMMAND: must be extract-text, make-patch, make-patches, make-bundle, audit, validate, apply-patch, reverse-patch, show-patch, bind-pdf, bind-epub, patch-pdfs, patch-bundle, fetch-sources, serve, cache, manifest
+`
+
+const cacheOptionsUsage = `
+  CACHE OPTIONS:
+    --cache-dir DIR: directory of the cache of text extracted from PDFs (default: pdfpatch/extracted in the user cache directory)
+    --no-cache:      extract the text of every PDF again instead of using the cache
+`
+
+const auditOptionsUsage = `
+  AUDIT OPTIONS:
+    --max-context N:      most unchanged source characters a patch may keep around its hunks (default: no limit)
+    --max-deleted N:      most source characters a patch may delete (default: no limit)
+    --max-deleted-run N:  longest run of source text a patch may delete (default 80)
+    --max-verbatim-run N: longest run of source text a patch may reveal in one piece (default 120)
 `
 
 const extractTextUsage = `
-pdfpatch extract-text PDF_FILE
+pdfpatch extract-text [--extractor NAME] [--by-page] [CACHE OPTIONS] PDF_FILE
 
   PDF_FILE: path to PDF from which to extract text
-`
+
+  --extractor: text extractor to use (pdftotext or gopdf, default: pdftotext)
+  --by-page:   print the text of each page after a "#page N" line
+` + cacheOptionsUsage
 
 const makePatchUsage = `
-pdfpatch make-patch PDF_FILE MARKDOWN_FILE [ADDITIONAL_MARKDOWN_FILES ...]
+pdfpatch make-patch [--extractor NAME] [--page-anchored] [--hashed] [--pages RANGES] [CACHE OPTIONS] PDF_FILE MARKDOWN_FILE [ADDITIONAL_MARKDOWN_FILES ...]
 
   PDF_FILE:                  original source PDF file
   MARKDOWN_FILE:             file to diff against to make the patch
   ADDITIONAL_MARKDOWN_FILES: (optional) additional files appended to the first file with which to make the patch
-`
+
+  --extractor:     text extractor to use (pdftotext or gopdf, default: pdftotext)
+  --page-anchored: anchor each hunk to its page so differences on one page cannot disturb another
+  --hashed:        keep only the lengths and hashes of the PDF text the patch deletes or keeps as context
+                   (short spans like a single deleted word can still be guessed from their hashes)
+  --pages:         only use these pages of the PDF, e.g. "1-4,9,12-" (default: all pages)
+` + cacheOptionsUsage
 
 const makePatchesUsage = `
-pdfpatch make-patches MANIFEST_PATH PDF_DIR MARKDOWN_DIR OUTPUT_DIR
+pdfpatch make-patches [--extractor NAME] [--page-anchored] [--hashed] [--jobs N] [CACHE OPTIONS] MANIFEST_PATH PDF_DIR MARKDOWN_DIR OUTPUT_DIR
 
   MANIFEST_PATH: file page to manifest file
   PDF_DIR:       path to directory with source PDF files
   MARKDOWN_FILE: path to directory with files to diff against to make the patch
   OUTPUT_DIR:    path where patches should be written
+
+  --extractor:     text extractor to use instead of the one named by each source (pdftotext or gopdf)
+  --page-anchored: anchor each hunk to its page so differences on one page cannot disturb another
+  --hashed:        keep only the lengths and hashes of the PDF text the patch deletes or keeps as context
+                   (short spans like a single deleted word can still be guessed from their hashes)
+  --jobs:          number of PDFs to extract and diff at the same time (default: the number of CPUs)
+` + cacheOptionsUsage
+
+const makeBundleUsage = `
+pdfpatch make-bundle [--extractor NAME] [--page-anchored] [--hashed] [--jobs N] [--skip-audit] [AUDIT OPTIONS] [CACHE OPTIONS] MANIFEST_PATH PDF_DIR MARKDOWN_DIR CSS_DIR OUTPUT_BUNDLE_PATH
+
+  MANIFEST_PATH:      path to manifest file
+  PDF_DIR:            path to directory with source PDF files
+  MARKDOWN_DIR:       path to directory with files to diff against to make the patches
+  CSS_DIR:            path to directory with the style sheets listed in the manifest
+  OUTPUT_BUNDLE_PATH: path where the bundle should be written (.zip, .tar or .tar.gz)
+
+  --extractor:     text extractor to use instead of the one named by each source (pdftotext or gopdf)
+  --page-anchored: anchor each hunk to its page so differences on one page cannot disturb another
+  --hashed:        keep only the lengths and hashes of the PDF text the patch deletes or keeps as context
+                   (short spans like a single deleted word can still be guessed from their hashes)
+  --jobs:          number of PDFs to extract and diff at the same time (default: the number of CPUs)
+  --skip-audit:    make the bundle even if its patches reveal more source text than the audit options allow
+` + auditOptionsUsage + cacheOptionsUsage
+
+const auditUsage = `
+pdfpatch audit [AUDIT OPTIONS] PATCH_FILE [ADDITIONAL_PATCH_FILES ...]
+
+  PATCH_FILE:             patch file to measure how much source text it reveals
+  ADDITIONAL_PATCH_FILES: (optional) more patch files to measure
+
+  Exits with status 1 if any patch exceeds the limits.
+` + auditOptionsUsage
+
+const validateUsage = `
+pdfpatch validate [OPTIONS] MANIFEST_PATH|BUNDLE_PATH
+
+  MANIFEST_PATH: path to a manifest file (ending in .yml, .yaml, .json or .toml) to check
+  BUNDLE_PATH:   path to a bundle file to check along with the style sheets and patches in it
+
+  OPTIONS:
+    --css-dir DIR:      directory that should contain the style sheets of a manifest
+    --markdown-dir DIR: directory that should contain the patched files of a manifest
+    --patches-dir DIR:  directory that should contain the patches of a manifest
+
+  Prints every problem with the line and column it is at and exits with status 1 if there are any.
 `
 
 const applyPatchUsage = `
-pdfpatch apply-patch PDF_FILE [PATCH_FILE]
+pdfpatch apply-patch [--allow-rejected] [--extractor NAME] [--pages RANGES] [CACHE OPTIONS] PDF_FILE [PATCH_FILE]
 
   PDF_FILE:   path to source PDF file with which to patch
   PATCH_FILE: path to the patch file (optional, default: /dev/stdin)
-`
+
+  --allow-rejected: exit successfully even if some hunks could not be applied
+  --extractor:      text extractor the patch was generated with (pdftotext or gopdf, default: pdftotext)
+  --pages:          pages of the PDF the patch was generated from, e.g. "1-4,9,12-" (default: all pages)
+` + cacheOptionsUsage
+
+const reversePatchUsage = `
+pdfpatch reverse-patch [--extractor NAME] [--pages RANGES] [CACHE OPTIONS] PATCH_FILE [PDF_FILE]
+
+  PATCH_FILE: path to the patch file to print the reverse of, which turns its output back into the extracted text
+  PDF_FILE:   path to the source PDF file the patch was generated from (only needed for page anchored patches)
+
+  --extractor: text extractor the patch was generated with (pdftotext or gopdf, default: pdftotext)
+  --pages:     pages of the PDF the patch was generated from, e.g. "1-4,9,12-" (default: all pages)
+` + cacheOptionsUsage
+
+const showPatchUsage = `
+pdfpatch show-patch [--html] [--context N] [--no-color] [--extractor NAME] [--pages RANGES] [CACHE OPTIONS] PDF_FILE PATCH_FILE [PDF_FILE PATCH_FILE...]
+
+  PDF_FILE:   path to source PDF file the patch was generated from
+  PATCH_FILE: path to the patch file to show the changes of
+
+  --html:      write an HTML report with the extracted and patched text of each hunk side by side
+  --context:   most unchanged words shown around each change, out of those the patch keeps (default 8)
+  --no-color:  do not colour the changes even if the output is a terminal
+  --extractor: text extractor the patches were generated with (pdftotext or gopdf, default: pdftotext)
+  --pages:     pages of the PDFs the patches were generated from, e.g. "1-4,9,12-" (default: all pages)
+` + cacheOptionsUsage
 
 const bindPdfUsage = `
-pdfpatch bind-pdf INPUT_MARKDOWNS_DIR INPUT_CSS_FILE OUTPUT_FILE_PATH
+pdfpatch bind-pdf [OPTIONS] INPUT_MARKDOWNS_DIR INPUT_CSS_FILE OUTPUT_FILE_PATH
 
   INPUT_MARKDOWNS_DIR:    directory containing markdown file
   INPUT_CSS_FILE:         path to file used to style the book
   OUTPUT_FILE_PATH:       path where printable output HTML file is to be written
+
+  OPTIONS:
+    --renderer NAME: renderer used to make the PDF (weasyprint, wkhtmltopdf or chromium, default weasyprint)
+`
+
+const bindEpubUsage = `
+pdfpatch bind-epub [OPTIONS] INPUT_MARKDOWNS_DIR INPUT_CSS_FILE OUTPUT_FILE_PATH
+
+  INPUT_MARKDOWNS_DIR:    directory containing markdown files, one for each chapter of the book
+  INPUT_CSS_FILE:         path to file used to style the book
+  OUTPUT_FILE_PATH:       path where the EPUB file is to be written
+
+  OPTIONS:
+    --title TITLE:   title of the book (default Untitled)
+    --language LANG: language of the book (default en)
 `
 
 const patchPDFsUsage = `
-pdfpatch patch-pdfs MANIFEST_PATH INPUT_PDF_DIR PATCHES_DIR CSS_PATH OUTPUT_PDF_PATH
+pdfpatch patch-pdfs [OPTIONS] MANIFEST_PATH INPUT_PDF_DIR PATCHES_DIR CSS_PATH OUTPUT_PDF_PATH
 
   MANIFEST_PATH:   path to manifest file
   INPUT_PDF_DIR:   put the directory containing PDFs to patch
   PATCHES_DIR:	   directory containing patches with filenames like "input_pdf_file.pdf.patch" for each PDF file
+                   (or "input_pdf_file.pdf.pages-1-4_9.patch" for sources limited to pages)
   CSS_PATH:        path to the CSS file used to style the output PDF
-  OUTPUT_PDF_PATH: path where output PDF should be written
-`
+  OUTPUT_PDF_PATH: path where output PDF (or EPUB) should be written
+
+  OPTIONS:
+    --allow-rejected:           render the PDF even if some hunks could not be applied
+    --skip-verify:              do not check the input PDFs against the checksums in the manifest
+    --extractor NAME:           text extractor to use instead of the one named by each source (pdftotext or gopdf)
+    --allow-extractor-mismatch: apply patches even if they were generated with a different extractor
+    --renderer NAME:            renderer used to make the PDF instead of the one named by the style in the manifest
+                                (weasyprint, wkhtmltopdf or chromium)
+    --format FORMAT:            format of the output file, pdf or epub (default pdf)
+    --keep-work-dir:            keep the directory with the intermediate files (e.g. patched markdowns) for debugging
+    --jobs N:                   number of PDFs to extract and patch at the same time (default: the number of CPUs)
+` + cacheOptionsUsage
 
 const patchBundleUsage = `
-pdfpatch patch-bundle BUNDLE_PATH INPUT_PDF_DIR STYLE_SHEET OUTPUT_PDF_PATH
+pdfpatch patch-bundle [OPTIONS] BUNDLE_PATH INPUT_PDF_DIR STYLE_SHEET OUTPUT_PDF_PATH
 
   BUNDLE_PATH:     path to bundle file
   INPUT_PDF_DIR:   put the directory containing PDFs to patch
   STYLE_SHEET:     style sheet used to render the PDF (must be one listed in the manifest)
-  OUTPUT_PDF_PATH: path where output PDF should be written
+  OUTPUT_PDF_PATH: path where output PDF (or EPUB) should be written
+
+  OPTIONS:
+    --allow-rejected:           render the PDF even if some hunks could not be applied
+    --skip-verify:              do not check the input PDFs against the checksums in the manifest
+    --extractor NAME:           text extractor to use instead of the one named by each source (pdftotext or gopdf)
+    --allow-extractor-mismatch: apply patches even if they were generated with a different extractor
+    --renderer NAME:            renderer used to make the PDF instead of the one named by the style in the bundle
+                                (weasyprint, wkhtmltopdf or chromium)
+    --format FORMAT:            format of the output file, pdf or epub (default pdf)
+    --keep-work-dir:            keep the directory with the intermediate files (e.g. patched markdowns) for debugging
+    --jobs N:                   number of PDFs to extract and patch at the same time (default: the number of CPUs)
+    --fetch-sources:            download the PDFs missing from INPUT_PDF_DIR from the URLs in the manifest first
+` + cacheOptionsUsage + fetchOptionsUsage
+
+const fetchSourcesUsage = `
+pdfpatch fetch-sources [OPTIONS] MANIFEST_PATH|BUNDLE_PATH DEST_DIR
+
+  MANIFEST_PATH: path to a manifest file (ending in .yml, .yaml, .json or .toml)
+  BUNDLE_PATH:   path to a bundle file
+  DEST_DIR:      directory the source PDFs are downloaded to (created if needed)
+
+  Downloads the source PDFs missing from DEST_DIR from the URLs in the manifest and checks them against
+  its checksums. Interrupted downloads are resumed by running fetch-sources again.
+
+  OPTIONS:
+    --jobs N: number of PDFs to download at the same time (default: the number of CPUs)
+` + fetchOptionsUsage
+
+const fetchOptionsUsage = `
+  FETCH OPTIONS:
+    --retries N:       times a failed download is tried again (default 3)
+    --sources-dir DIR: directory of the download cache of sources with checksums, which can be the
+                       --sources-dir of serve (default: downloads are not cached)
 `
 
 const serveUsage = `
-pdfpatch serve PORT
+pdfpatch serve [OPTIONS] PORT
 
   PORT: port from which to serve API
+
+  OPTIONS:
+    --workers N:      number of patch jobs to run at the same time (default 2)
+    --queue-length N: number of patch jobs that may wait for a worker (default 100)
+    --renderer NAME:  renderer used to make PDFs instead of the one named by each style
+                      (weasyprint, wkhtmltopdf or chromium)
+    --job-retention:  how long finished jobs and their output are kept, e.g. 30m (default 1h)
+    --job-timeout:    how long a patch request or job may run before it is stopped (default 10m)
+    --keep-work-dir:  keep the uploads and intermediate files of every request for debugging
+    --sources-dir:    directory where uploaded source PDFs are stored so clients need not upload them again
+                      (default: sources are not stored). Stored sources are never removed, so only set it
+                      for clients trusted not to fill the disk.
+` + cacheOptionsUsage
+
+const cacheUsage = `
+pdfpatch cache [--cache-dir DIR] show|prune [--max-size SIZE]|clear
+
+  show:  print the directory, number of entries and size of the cache of text extracted from PDFs
+  prune: remove the least recently used entries until the cache is at most --max-size
+  clear: remove every entry from the cache
+
+  --cache-dir DIR: directory of the cache (default: pdfpatch/extracted in the user cache directory)
+  --max-size SIZE: size to prune the cache to, e.g. 500KB, 100MB or 1GB (default 256MB)
+`
+
+const manifestUsage = `
+pdfpatch manifest upgrade MANIFEST_PATH [ADDITIONAL_MANIFEST_PATHS ...]
+pdfpatch manifest convert [--to ENCODING] MANIFEST_PATH OUTPUT_PATH
+
+  upgrade: rewrite each manifest in the current version of the manifest format (comments are not kept),
+           manifests that are already current are left as they are
+  convert: write the manifest to OUTPUT_PATH in another encoding, in the current version of the format
+
+  Manifests can be written in YAML, JSON or TOML, told apart by their extension (.yml or .yaml, .json,
+  .toml) or else by their content.
+
+  --to ENCODING: yaml, json or toml (default: the encoding of the extension of OUTPUT_PATH)
 `
 
 func main() {
@@ -90,68 +290,369 @@ func main() {
 	subcommand := os.Args[1]
 
 	if subcommand == "extract-text" {
-		checkArguments(3, extractTextUsage)
-		text, err := extractor.TextFromPDF(os.Args[2])
+		flags := flag.NewFlagSet(subcommand, flag.ExitOnError)
+		extractorName := flags.String("extractor", "", "")
+		byPage := flags.Bool("by-page", false, "")
+		cache := cacheFlags(flags)
+		args := parseFlags(flags, extractTextUsage)
+		checkArgs(args, 1, extractTextUsage)
+		textExtractor, err := extractor.New(*extractorName)
 		exitOnError(err, "Could not extract text")
-		fmt.Println(text)
+		textExtractor = extractor.Cached(textExtractor, cache())
+		if *byPage {
+			pages, err := textExtractor.PagesFromPDF(args[0])
+			exitOnError(err, "Could not extract text")
+			for _, page := range pages {
+				fmt.Printf("#page %d\n%s\n", page.Number, page.Text)
+			}
+		} else {
+			text, err := textExtractor.TextFromPDF(args[0])
+			exitOnError(err, "Could not extract text")
+			fmt.Println(text)
+		}
 	} else if subcommand == "make-patch" {
-		if len(os.Args) < 4 {
-			checkArguments(0, makePatchUsage)
+		var options pdfpatch.Options
+		flags := flag.NewFlagSet(subcommand, flag.ExitOnError)
+		flags.StringVar(&options.Extractor, "extractor", "", "")
+		flags.BoolVar(&options.PageAnchored, "page-anchored", false, "")
+		flags.BoolVar(&options.Hashed, "hashed", false, "")
+		flags.StringVar(&options.Pages, "pages", "", "")
+		cache := cacheFlags(flags)
+		args := parseFlags(flags, makePatchUsage)
+		options.Cache = cache()
+		if len(args) < 2 {
+			checkArgs(args, 0, makePatchUsage)
 		}
-		patch, err := pdfpatch.GeneratePatch(os.Args[2], os.Args[3:])
+		patch, err := pdfpatch.GeneratePatch(args[0], args[1:], options)
 		exitOnError(err, "Could not generate patch")
 		fmt.Println(patch)
 	} else if subcommand == "make-patches" {
-		checkArguments(6, makePatchesUsage)
-		manifest := parseManifest(os.Args[2])
-		pdfMarkdowns := make([]pdfpatch.PDFMarkdowns, len(manifest.Sources))
-		for i, source := range manifest.Sources {
-			pdfFilename := source.FileName
-			pdfMarkdowns[i] = pdfpatch.PDFMarkdowns{
-				PDFFileName:       pdfFilename,
-				MarkdownFileNames: source.PatchedFiles,
-			}
-		}
-		patches, err := pdfpatch.GeneratePatches(pdfMarkdowns, os.Args[3], os.Args[4])
+		var options pdfpatch.Options
+		flags := flag.NewFlagSet(subcommand, flag.ExitOnError)
+		flags.StringVar(&options.Extractor, "extractor", "", "")
+		flags.BoolVar(&options.PageAnchored, "page-anchored", false, "")
+		flags.BoolVar(&options.Hashed, "hashed", false, "")
+		flags.IntVar(&options.Jobs, "jobs", 0, "")
+		cache := cacheFlags(flags)
+		args := parseFlags(flags, makePatchesUsage)
+		options.Cache = cache()
+		checkArgs(args, 4, makePatchesUsage)
+		manifest := parseManifest(args[0])
+		pdfMarkdowns := pdfpatch.PDFMarkdownsFromSources(manifest.Sources)
+		patches, err := pdfpatch.GeneratePatches(pdfMarkdowns, args[1], args[2], options)
 		exitOnError(err, "Could not generate patches")
 		for _, patch := range patches {
-			outputPath := path.Join(os.Args[5], patch.PDFFileName+".patch")
+			outputPath := path.Join(args[3], patch.PatchFileName())
 			err := ioutil.WriteFile(outputPath, []byte(patch.Patch), 0755)
 			exitOnError(err, "Could not write patch file")
 		}
+	} else if subcommand == "make-bundle" {
+		var options pdfpatch.Options
+		flags := flag.NewFlagSet(subcommand, flag.ExitOnError)
+		flags.StringVar(&options.Extractor, "extractor", "", "")
+		flags.BoolVar(&options.PageAnchored, "page-anchored", false, "")
+		flags.BoolVar(&options.Hashed, "hashed", false, "")
+		flags.IntVar(&options.Jobs, "jobs", 0, "")
+		flags.BoolVar(&options.SkipAudit, "skip-audit", false, "")
+		auditFlags(flags, &options.AuditLimits)
+		cache := cacheFlags(flags)
+		args := parseFlags(flags, makeBundleUsage)
+		options.Cache = cache()
+		checkArgs(args, 5, makeBundleUsage)
+		if options.AuditLimits == (pdfpatch.AuditLimits{}) {
+			options.SkipAudit = true
+		}
+		manifest := parseManifest(args[0])
+		err := pdfpatch.MakeBundle(manifest, args[1], args[2], args[3], args[4], options)
+		exitOnError(err, "Could not make bundle")
+	} else if subcommand == "audit" {
+		var limits pdfpatch.AuditLimits
+		flags := flag.NewFlagSet(subcommand, flag.ExitOnError)
+		auditFlags(flags, &limits)
+		args := parseFlags(flags, auditUsage)
+		if len(args) == 0 {
+			checkArgs(args, 0, auditUsage)
+		}
+		exceeded := false
+		for _, patchFileName := range args {
+			patch, err := ioutil.ReadFile(patchFileName)
+			exitOnError(err, "Could not read patch")
+			audit, err := pdfpatch.AuditPatch(patchFileName, string(patch), limits)
+			exitOnError(err, "Could not audit patch")
+			fmt.Println(audit)
+			exceeded = exceeded || len(audit.Exceeded) > 0
+		}
+		if exceeded {
+			os.Exit(1)
+		}
+	} else if subcommand == "validate" {
+		var options manifest.ValidationOptions
+		flags := flag.NewFlagSet(subcommand, flag.ExitOnError)
+		flags.StringVar(&options.CSSDir, "css-dir", "", "")
+		flags.StringVar(&options.MarkdownsDir, "markdown-dir", "", "")
+		flags.StringVar(&options.PatchesDir, "patches-dir", "", "")
+		args := parseFlags(flags, validateUsage)
+		checkArgs(args, 1, validateUsage)
+		var err error
+		if _, isManifest := manifest.EncodingOfPath(args[0]); isManifest {
+			_, err = manifest.ValidateFile(args[0], options)
+		} else {
+			err = manifest.ValidateBundle(args[0])
+		}
+		var invalid *manifest.InvalidManifestError
+		if errors.As(err, &invalid) {
+			for _, problem := range invalid.Problems {
+				if problem.Line == 0 {
+					fmt.Printf("%s: %s\n", args[0], problem)
+				} else {
+					fmt.Printf("%s:%s\n", args[0], problem)
+				}
+			}
+			os.Exit(1)
+		}
+		exitOnError(err, "Could not validate")
+		fmt.Printf("%s: ok\n", args[0])
 	} else if subcommand == "apply-patch" {
-		var patchFileName string
-		if len(os.Args) == 3 {
+		var (
+			patchFileName string
+			options       pdfpatch.Options
+		)
+		flags := flag.NewFlagSet(subcommand, flag.ExitOnError)
+		flags.BoolVar(&options.AllowRejectedHunks, "allow-rejected", false, "")
+		flags.StringVar(&options.Extractor, "extractor", "", "")
+		flags.StringVar(&options.Pages, "pages", "", "")
+		cache := cacheFlags(flags)
+		args := parseFlags(flags, applyPatchUsage)
+		options.Cache = cache()
+		if len(args) == 1 {
 			patchFileName = "/dev/stdin"
-		} else if len(os.Args) == 4 {
-			patchFileName = os.Args[3]
+		} else if len(args) == 2 {
+			patchFileName = args[1]
 		} else {
-			checkArguments(0, applyPatchUsage)
+			checkArgs(args, 0, applyPatchUsage)
 		}
-		result, err := pdfpatch.ApplyPatch(os.Args[2], patchFileName)
+		result, err := pdfpatch.ApplyPatch(args[0], patchFileName, options)
 		exitOnError(err, "Could not apply patch")
-		fmt.Println(result)
+		fmt.Println(result.Text)
+		exitOnRejectedHunks([]pdfpatch.PatchResult{result}, options.AllowRejectedHunks)
+	} else if subcommand == "reverse-patch" {
+		var (
+			pdfFileName string
+			options     pdfpatch.Options
+		)
+		flags := flag.NewFlagSet(subcommand, flag.ExitOnError)
+		flags.StringVar(&options.Extractor, "extractor", "", "")
+		flags.StringVar(&options.Pages, "pages", "", "")
+		cache := cacheFlags(flags)
+		args := parseFlags(flags, reversePatchUsage)
+		options.Cache = cache()
+		if len(args) == 2 {
+			pdfFileName = args[1]
+		} else if len(args) != 1 {
+			checkArgs(args, 0, reversePatchUsage)
+		}
+		reversePatch, err := pdfpatch.ReversePatch(pdfFileName, args[0], options)
+		exitOnError(err, "Could not reverse patch")
+		fmt.Print(reversePatch)
+	} else if subcommand == "show-patch" {
+		var (
+			html, noColor bool
+			contextWords  int
+			options       pdfpatch.Options
+		)
+		flags := flag.NewFlagSet(subcommand, flag.ExitOnError)
+		flags.BoolVar(&html, "html", false, "")
+		flags.IntVar(&contextWords, "context", pdfpatch.DefaultContextWords, "")
+		flags.BoolVar(&noColor, "no-color", false, "")
+		flags.StringVar(&options.Extractor, "extractor", "", "")
+		flags.StringVar(&options.Pages, "pages", "", "")
+		cache := cacheFlags(flags)
+		args := parseFlags(flags, showPatchUsage)
+		options.Cache = cache()
+		if len(args) == 0 || len(args)%2 != 0 {
+			checkArgs(args, 0, showPatchUsage)
+		}
+		if contextWords < 0 {
+			fmt.Fprintln(os.Stderr, "--context must not be negative")
+			os.Exit(2)
+		}
+		var patchDiffs []pdfpatch.PatchDiff
+		for i := 0; i < len(args); i += 2 {
+			patchDiff, err := pdfpatch.ShowPatch(args[i], args[i+1], contextWords, options)
+			exitOnError(err, "Could not show patch")
+			patchDiffs = append(patchDiffs, patchDiff)
+		}
+		var err error
+		if html {
+			err = pdfpatch.WriteHTMLReport(os.Stdout, patchDiffs)
+		} else {
+			err = pdfpatch.WriteDiff(os.Stdout, patchDiffs, !noColor && isTerminal(os.Stdout))
+		}
+		exitOnError(err, "Could not write patch diff")
 	} else if subcommand == "bind-pdf" {
-		checkArguments(5, bindPdfUsage)
-		err := pdfbinder.BindPdf(os.Args[2], os.Args[3], os.Args[4])
+		var options pdfbinder.Options
+		flags := flag.NewFlagSet(subcommand, flag.ExitOnError)
+		flags.StringVar(&options.Renderer, "renderer", "", "")
+		args := parseFlags(flags, bindPdfUsage)
+		checkArgs(args, 3, bindPdfUsage)
+		err := pdfbinder.BindPdf(args[0], args[1], args[2], options)
 		exitOnError(err, "Unable to bind PDF")
+	} else if subcommand == "bind-epub" {
+		var options epubbinder.Options
+		flags := flag.NewFlagSet(subcommand, flag.ExitOnError)
+		flags.StringVar(&options.Title, "title", "", "")
+		flags.StringVar(&options.Language, "language", "", "")
+		args := parseFlags(flags, bindEpubUsage)
+		checkArgs(args, 3, bindEpubUsage)
+		err := epubbinder.BindEpub(args[0], args[1], args[2], options)
+		exitOnError(err, "Unable to bind EPUB")
 	} else if subcommand == "patch-pdfs" {
-		checkArguments(7, patchPDFsUsage)
-		manifest := parseManifest(os.Args[2])
-		pdfFiles := manifest.SourceFileNames()
-		err := pdfpatch.PatchPDF(pdfFiles, os.Args[3], os.Args[4], os.Args[5], os.Args[6])
-		exitOnError(err, "Unable to patch PDF")
+		var options pdfpatch.Options
+		flags := flag.NewFlagSet(subcommand, flag.ExitOnError)
+		cache := patchFlags(flags, &options)
+		args := parseFlags(flags, patchPDFsUsage)
+		options.Cache = cache()
+		checkArgs(args, 5, patchPDFsUsage)
+		manifest := parseManifest(args[0])
+		if style, found := manifest.FindStyle(path.Base(args[3])); found && options.Renderer == "" {
+			options.Renderer = style.Renderer
+		}
+		options.Book = manifest.Book
+		results, err := pdfpatch.PatchPDF(manifest.Sources, args[1], args[2], args[3], args[4], options)
+		exitOnPatchError(err, results, options.AllowRejectedHunks, "Unable to patch PDF")
 	} else if subcommand == "patch-bundle" {
-		checkArguments(6, patchBundleUsage)
-		err := pdfpatch.PatchBundle(os.Args[2], os.Args[3], os.Args[4], os.Args[5])
-		exitOnError(err, "Unable to patch PDFs with bundle")
+		var options pdfpatch.Options
+		flags := flag.NewFlagSet(subcommand, flag.ExitOnError)
+		cache := patchFlags(flags, &options)
+		fetchSources := flags.Bool("fetch-sources", false, "")
+		sourceFetcher := fetchFlags(flags)
+		args := parseFlags(flags, patchBundleUsage)
+		options.Cache = cache()
+		if *fetchSources {
+			options.Fetcher = sourceFetcher()
+		}
+		checkArgs(args, 4, patchBundleUsage)
+		results, err := pdfpatch.PatchBundle(args[0], args[1], args[2], args[3], options)
+		exitOnPatchError(err, results, options.AllowRejectedHunks, "Unable to patch PDFs with bundle")
+	} else if subcommand == "fetch-sources" {
+		var options pdfpatch.Options
+		flags := flag.NewFlagSet(subcommand, flag.ExitOnError)
+		flags.IntVar(&options.Jobs, "jobs", 0, "")
+		sourceFetcher := fetchFlags(flags)
+		args := parseFlags(flags, fetchSourcesUsage)
+		checkArgs(args, 2, fetchSourcesUsage)
+		options.Fetcher = sourceFetcher()
+		var sources []manifest.Source
+		if _, isManifest := manifest.EncodingOfPath(args[0]); isManifest {
+			sources = parseManifest(args[0]).Sources
+		} else {
+			bundle, err := manifest.UnpackBundle(args[0])
+			exitOnError(err, "Could not unpack bundle")
+			sources = bundle.Manifest.Sources
+			bundle.Close()
+		}
+		results, err := pdfpatch.FetchSources(sources, args[1], options)
+		for _, result := range results {
+			if result.Status != "" {
+				fmt.Printf("%s: %s (%s)\n", result.FileName, result.Status, formatSize(result.Bytes))
+			}
+		}
+		exitOnError(err, "Could not fetch sources")
 	} else if subcommand == "serve" {
-		checkArguments(3, serveUsage)
-		err := api.ServeAPI(os.Args[2])
+		var config api.Config
+		flags := flag.NewFlagSet(subcommand, flag.ExitOnError)
+		flags.IntVar(&config.Workers, "workers", api.DefaultWorkers, "")
+		flags.IntVar(&config.QueueLength, "queue-length", api.DefaultQueueLength, "")
+		flags.StringVar(&config.Renderer, "renderer", "", "")
+		flags.DurationVar(&config.JobRetention, "job-retention", api.DefaultJobRetention, "")
+		flags.DurationVar(&config.JobTimeout, "job-timeout", api.DefaultJobTimeout, "")
+		flags.BoolVar(&config.KeepWorkDir, "keep-work-dir", false, "")
+		sourcesDir := flags.String("sources-dir", "", "")
+		cache := cacheFlags(flags)
+		args := parseFlags(flags, serveUsage)
+		config.Cache = cache()
+		if *sourcesDir != "" {
+			config.Sources = openSourceStore(*sourcesDir)
+		}
+		checkArgs(args, 1, serveUsage)
+		err := api.ServeAPI(args[0], config)
 		exitOnError(err, "Error running API server")
 		os.Exit(0)
+	} else if subcommand == "cache" {
+		flags := flag.NewFlagSet(subcommand, flag.ExitOnError)
+		cacheDir := flags.String("cache-dir", "", "")
+		maxSize := flags.String("max-size", "256MB", "")
+		args := parseFlags(flags, cacheUsage)
+		if len(args) > 0 {
+			flags.Parse(args[1:])
+			args = append(args[:1], flags.Args()...)
+		}
+		checkArgs(args, 1, cacheUsage)
+		cache := openCache(*cacheDir)
+		if cache == nil {
+			os.Exit(1)
+		}
+		switch args[0] {
+		case "show":
+			stats, err := cache.Stats()
+			exitOnError(err, "Could not read cache")
+			fmt.Printf("directory: %s\nentries:   %d\nsize:      %s\n", stats.Dir, stats.Entries, formatSize(stats.Size))
+		case "prune":
+			size, err := parseSize(*maxSize)
+			exitOnError(err, "Invalid --max-size")
+			removed, err := cache.Prune(size)
+			exitOnError(err, "Could not prune cache")
+			fmt.Printf("removed %d entries\n", removed)
+		case "clear":
+			err := cache.Clear()
+			exitOnError(err, "Could not clear cache")
+		default:
+			fmt.Print(cacheUsage)
+			os.Exit(2)
+		}
+	} else if subcommand == "manifest" {
+		flags := flag.NewFlagSet(subcommand, flag.ExitOnError)
+		to := flags.String("to", "", "")
+		args := parseFlags(flags, manifestUsage)
+		if len(args) > 0 {
+			flags.Parse(args[1:])
+			args = append(args[:1], flags.Args()...)
+		}
+		if len(args) == 0 {
+			checkArgs(args, 1, manifestUsage)
+		}
+		switch args[0] {
+		case "upgrade":
+			if len(args) < 2 {
+				checkArgs(args, 0, manifestUsage)
+			}
+			for _, manifestPath := range args[1:] {
+				fromVersion, err := manifest.UpgradeFile(manifestPath)
+				exitOnError(err, "Could not upgrade manifest")
+				if fromVersion == manifest.CurrentVersion {
+					fmt.Printf("%s: already version %d\n", manifestPath, manifest.CurrentVersion)
+				} else {
+					fmt.Printf("%s: upgraded from version %d to %d\n", manifestPath, fromVersion, manifest.CurrentVersion)
+				}
+			}
+		case "convert":
+			checkArgs(args, 3, manifestUsage)
+			encoding, known := manifest.EncodingOfPath(args[2])
+			if *to != "" {
+				var err error
+				encoding, err = manifest.ParseEncoding(*to)
+				exitOnError(err, "Invalid --to")
+			} else if !known {
+				fmt.Fprintf(os.Stderr, "Could not tell the encoding of %s from its extension, use --to\n", args[2])
+				os.Exit(2)
+			}
+			err := manifest.ConvertFile(args[1], args[2], encoding)
+			exitOnError(err, "Could not convert manifest")
+		default:
+			checkArgs(args, 0, manifestUsage)
+		}
 	} else {
-		fmt.Println(usage)
+		fmt.Print(usage)
 		os.Exit(2)
 	}
 }
@@ -160,17 +661,167 @@ func main() {
 // by convention, passing numArguments as 0 will print the usage and exist
 func checkArguments(numArguments int, usageMessage string) {
 	if len(os.Args) != numArguments {
-		fmt.Println(usageMessage)
+		fmt.Print(usageMessage)
+		os.Exit(2)
+	}
+}
+
+// parseFlags parses the flags following the subcommand and returns the remaining positional arguments
+func parseFlags(flags *flag.FlagSet, usageMessage string) []string {
+	flags.Usage = func() { fmt.Print(usageMessage) }
+	flags.Parse(os.Args[2:])
+	return flags.Args()
+}
+
+// patchFlags registers the flags shared by the subcommands that patch PDFs
+// The returned function opens the cache chosen by the flags once they are parsed (see cacheFlags).
+func patchFlags(flags *flag.FlagSet, options *pdfpatch.Options) func() *extractor.Cache {
+	flags.BoolVar(&options.AllowRejectedHunks, "allow-rejected", false, "")
+	flags.BoolVar(&options.SkipVerify, "skip-verify", false, "")
+	flags.StringVar(&options.Extractor, "extractor", "", "")
+	flags.BoolVar(&options.AllowExtractorMismatch, "allow-extractor-mismatch", false, "")
+	flags.StringVar(&options.Renderer, "renderer", "", "")
+	flags.StringVar(&options.Format, "format", pdfpatch.FormatPDF, "")
+	flags.BoolVar(&options.KeepWorkDir, "keep-work-dir", false, "")
+	flags.IntVar(&options.Jobs, "jobs", 0, "")
+	return cacheFlags(flags)
+}
+
+// fetchFlags registers the flags configuring how source PDFs are downloaded
+// The returned function makes the fetcher once the flags are parsed.
+func fetchFlags(flags *flag.FlagSet) func() *fetcher.Fetcher {
+	retries := flags.Int("retries", fetcher.DefaultRetries, "")
+	sourcesDir := flags.String("sources-dir", "", "")
+	return func() *fetcher.Fetcher {
+		var store sourcestore.Store
+		if *sourcesDir != "" {
+			store = openSourceStore(*sourcesDir)
+		}
+		sourceFetcher := fetcher.New(store)
+		sourceFetcher.Retries = *retries
+		return sourceFetcher
+	}
+}
+
+// auditFlags registers the flags setting the most source text a patch may reveal
+func auditFlags(flags *flag.FlagSet, limits *pdfpatch.AuditLimits) {
+	flags.IntVar(&limits.MaxContextChars, "max-context", pdfpatch.DefaultAuditLimits.MaxContextChars, "")
+	flags.IntVar(&limits.MaxDeletedChars, "max-deleted", pdfpatch.DefaultAuditLimits.MaxDeletedChars, "")
+	flags.IntVar(&limits.MaxDeletedRun, "max-deleted-run", pdfpatch.DefaultAuditLimits.MaxDeletedRun, "")
+	flags.IntVar(&limits.MaxVerbatimRun, "max-verbatim-run", pdfpatch.DefaultAuditLimits.MaxVerbatimRun, "")
+}
+
+// cacheFlags registers the flags choosing the cache of extracted text
+// The returned function opens the cache once the flags are parsed or returns nil for --no-cache.
+func cacheFlags(flags *flag.FlagSet) func() *extractor.Cache {
+	cacheDir := flags.String("cache-dir", "", "")
+	noCache := flags.Bool("no-cache", false, "")
+	return func() *extractor.Cache {
+		if *noCache {
+			return nil
+		}
+		return openCache(*cacheDir)
+	}
+}
+
+// openCache opens the cache in dir or the default directory, warning and returning nil if it cannot be used
+func openCache(dir string) *extractor.Cache {
+	var err error
+	if dir == "" {
+		dir, err = extractor.DefaultCacheDir()
+	}
+	if err == nil {
+		var cache *extractor.Cache
+		cache, err = extractor.NewCache(dir, extractor.DefaultCacheMaxSize)
+		if err == nil {
+			return cache
+		}
+	}
+	fmt.Fprintln(os.Stderr, "WARNING: not caching extracted text:", err)
+	return nil
+}
+
+// openSourceStore opens the store of source PDFs in dir
+func openSourceStore(dir string) sourcestore.Store {
+	store, err := sourcestore.NewLocalStore(dir)
+	exitOnError(err, "Could not open the source store")
+	return store
+}
+
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+
+// parseSize parses a size in bytes like "500KB", "100MB" or "1GB"
+func parseSize(size string) (bytes int64, err error) {
+	number, multiplier := strings.ToUpper(strings.TrimSpace(size)), int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(number, unit.suffix) {
+			number, multiplier = strings.TrimSuffix(number, unit.suffix), unit.bytes
+			break
+		}
+	}
+	bytes, err = strconv.ParseInt(strings.TrimSpace(number), 10, 64)
+	if err != nil || bytes < 0 {
+		return 0, fmt.Errorf("%q is not a size like 500KB, 100MB or 1GB", size)
+	}
+	return bytes * multiplier, nil
+}
+
+// formatSize formats a number of bytes in the largest unit it has at least one of
+func formatSize(bytes int64) string {
+	for _, unit := range sizeUnits {
+		if bytes >= unit.bytes && unit.bytes > 1 {
+			return fmt.Sprintf("%.1f%s", float64(bytes)/float64(unit.bytes), unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%dB", bytes)
+}
+
+// checkArgs checks the number of positional arguments left after parsing flags otherwise it prints the usage and exits
+// by convention, passing numArguments as 0 will print the usage and exit
+func checkArgs(args []string, numArguments int, usageMessage string) {
+	if len(args) != numArguments || numArguments == 0 {
+		fmt.Print(usageMessage)
 		os.Exit(2)
 	}
 }
 
+// isTerminal reports whether file is a terminal rather than a file or pipe
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
 func parseManifest(manifestPath string) manifest.Manifest {
 	theManifest, err := manifest.ParseFile(manifestPath)
 	exitOnError(err, "Could not parse manifest")
 	return theManifest
 }
 
+// exitOnPatchError exits if err is not for rejected hunks, otherwise it prints the summary of the results
+// first (see exitOnRejectedHunks)
+func exitOnPatchError(err error, results []pdfpatch.PatchResult, allowRejected bool, msg string) {
+	var rejectedErr *pdfpatch.RejectedHunksError
+	if !errors.As(err, &rejectedErr) {
+		exitOnError(err, msg)
+	}
+	exitOnRejectedHunks(results, allowRejected)
+	exitOnError(err, msg)
+}
+
+// exitOnRejectedHunks prints a summary of the applied patches and exits if any hunks were rejected
+func exitOnRejectedHunks(results []pdfpatch.PatchResult, allowRejected bool) {
+	pdfpatch.WriteSummary(os.Stderr, results)
+	for _, result := range results {
+		if len(result.Rejected()) > 0 && !allowRejected {
+			fmt.Fprintln(os.Stderr, "Some hunks could not be applied")
+			os.Exit(1)
+		}
+	}
+}
+
 func exitOnError(err error, msg string) {
 	if err != nil {
 		fmt.Printf("%s: %s\n", msg, err)
@@ -3,28 +3,20 @@ module github.com/motevets/pdfpatch
 go 1.13
 
 require (
-	code.sajari.com/docconv v1.1.0
-	github.com/JalfResi/justext v0.0.0-20170829062021-c0282dea7198 // indirect
-	github.com/MakeNowJust/heredoc/v2 v2.0.1
-	github.com/advancedlogic/GoOse v0.0.0-20191112112754-e742535969c1 // indirect
-	github.com/apcera/termtables v0.0.0-20170405184538-bcbc5dc54055 // indirect
-	github.com/cweill/gotests v1.5.3 // indirect
+	github.com/BurntSushi/toml v0.3.0
 	github.com/dsnet/compress v0.0.1 // indirect
 	github.com/golang/snappy v0.0.1 // indirect
+	github.com/gomarkdown/markdown v0.0.0-20200316172748-fd1f3374857d
 	github.com/ledongthuc/pdf v0.0.0-20200323191019-23c5852adbd2
-	github.com/levigross/exp-html v0.0.0-20120902181939-8df60c69a8f5 // indirect
-	github.com/lithammer/dedent v1.1.0
 	github.com/mholt/archiver v3.1.1+incompatible
 	github.com/nwaples/rardecode v1.1.0 // indirect
 	github.com/onsi/ginkgo v1.14.0
 	github.com/onsi/gomega v1.10.1
 	github.com/pierrec/lz4 v2.5.2+incompatible // indirect
-	github.com/pkg/errors v0.8.1
 	github.com/sergi/go-diff v1.1.0
 	github.com/their-sober-press/alcobinder v0.0.0-20200723202758-2dd9f32269e7
 	github.com/ulikunitz/xz v0.5.7 // indirect
 	github.com/xi2/xz v0.0.0-20171230120015-48954b6210f8 // indirect
-	golang.org/x/tools v0.0.0-20200722154247-704191308356 // indirect
-	gopkg.in/tomb.v2 v2.0.0-20161208151619-d5d1b5820637 // indirect
-	gopkg.in/yaml.v2 v2.3.0
+	golang.org/x/net v0.0.0-20200625001655-4c5254603344
+	gopkg.in/yaml.v3 v3.0.1
 )
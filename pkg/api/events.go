@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/motevets/pdfpatch/pkg/pdfpatch"
+)
+
+// jobEvent is a progress event of a job as sent to subscribers
+type jobEvent struct {
+	State        JobState `json:"state"`
+	Message      string   `json:"message"`
+	FileName     string   `json:"fileName,omitempty"`
+	Hunks        int      `json:"hunks"`
+	HunksApplied int      `json:"hunksApplied"`
+	Page         int      `json:"page,omitempty"`
+	Error        string   `json:"error,omitempty"`
+}
+
+func newJobEvent(event pdfpatch.ProgressEvent) jobEvent {
+	return jobEvent{
+		State:        JobState(event.Stage),
+		Message:      event.String(),
+		FileName:     event.FileName,
+		Hunks:        event.Hunks,
+		HunksApplied: event.HunksApplied,
+		Page:         event.Page,
+	}
+}
+
+// publish records an event and wakes up subscribers, the job must be locked
+func (job *Job) publish(event jobEvent) {
+	job.state = event.State
+	job.events = append(job.events, event)
+	close(job.changed)
+	job.changed = make(chan struct{})
+}
+
+// eventsSince returns the events from index next on, a channel closed when there are more,
+// and whether the job has finished so there will be no more
+func (job *Job) eventsSince(next int) (events []jobEvent, changed <-chan struct{}, finished bool) {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	if next < len(job.events) {
+		events = append(events, job.events[next:]...)
+	}
+	finished = job.state == JobDone || job.state == JobFailed
+	return events, job.changed, finished
+}
+
+// jobEvents streams the progress of a job as server-sent events until it finishes
+// Every event the job has published is sent, starting after the Last-Event-ID when reconnecting.
+func jobEvents(w http.ResponseWriter, r *http.Request, job *Job) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeErr(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	next := 0
+	if lastEventID, err := strconv.Atoi(r.Header.Get("Last-Event-ID")); err == nil {
+		next = lastEventID + 1
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	for {
+		events, changed, finished := job.eventsSince(next)
+		for _, event := range events {
+			data, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+			_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", next, data)
+			if err != nil {
+				return
+			}
+			next++
+		}
+		flusher.Flush()
+		if finished {
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
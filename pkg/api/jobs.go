@@ -0,0 +1,292 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/motevets/pdfpatch/pkg/pdfpatch"
+)
+
+// JobState is the progress of a patch job
+// The extracting, patching and rendering states are the stages reported by pdfpatch.
+type JobState string
+
+const (
+	JobQueued     JobState = "queued"
+	JobExtracting JobState = "extracting"
+	JobPatching   JobState = "patching"
+	JobRendering  JobState = "rendering"
+	JobDone       JobState = "done"
+	JobFailed     JobState = "failed"
+)
+
+// ErrQueueFull is returned when a job is submitted while every slot in the queue is taken
+var ErrQueueFull = errors.New("too many jobs are waiting, try again later")
+
+// Job is a bundle patched in the background by a JobQueue
+type Job struct {
+	ID     string
+	upload patchUpload
+
+	mutex   sync.Mutex
+	state   JobState
+	err     error
+	results []pdfpatch.PatchResult
+	events  []jobEvent
+	changed chan struct{}
+}
+
+// jobStatus is the JSON representation of a job
+type jobStatus struct {
+	ID      string         `json:"id"`
+	State   JobState       `json:"state"`
+	Error   string         `json:"error,omitempty"`
+	Sources []sourceStatus `json:"sources,omitempty"`
+}
+
+// sourceStatus lists how the patch for a source PDF applied
+// Warnings describe the hunks that were rejected or applied away from where they were expected.
+type sourceStatus struct {
+	FileName     string   `json:"fileName"`
+	Pages        string   `json:"pages,omitempty"`
+	Hunks        int      `json:"hunks"`
+	HunksApplied int      `json:"hunksApplied"`
+	Warnings     []string `json:"warnings,omitempty"`
+}
+
+// State returns the current state of the job
+func (job *Job) State() JobState {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	return job.state
+}
+
+func (job *Job) finish(results []pdfpatch.PatchResult, err error) {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	job.results = results
+	job.err = err
+	if err != nil {
+		job.publish(jobEvent{State: JobFailed, Message: "failed", Error: err.Error()})
+	} else {
+		job.publish(jobEvent{State: JobDone, Message: "done"})
+	}
+}
+
+func (job *Job) status() (status jobStatus) {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	status = jobStatus{ID: job.ID, State: job.state}
+	if job.err != nil {
+		status.Error = job.err.Error()
+	}
+	for _, result := range job.results {
+		source := sourceStatus{
+			FileName:     result.PDFFileName,
+			Pages:        result.Pages,
+			Hunks:        len(result.Hunks),
+			HunksApplied: result.Applied(),
+		}
+		for _, hunk := range result.Hunks {
+			if !hunk.Applied || hunk.Offset != 0 {
+				source.Warnings = append(source.Warnings, hunk.String())
+			}
+		}
+		status.Sources = append(status.Sources, source)
+	}
+	return
+}
+
+// run patches the bundle of the job, following each stage of progress, and stops it after timeout
+func (job *Job) run(timeout time.Duration) {
+	options := job.upload.options
+	options.Progress = func(event pdfpatch.ProgressEvent) {
+		job.mutex.Lock()
+		defer job.mutex.Unlock()
+		job.publish(newJobEvent(event))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	results, err := pdfpatch.PatchBundleContext(ctx, job.upload.bundleFilePath, job.upload.pdfsDir, job.upload.cssName, job.upload.outputPath(), options)
+	err = timeoutErr(err, timeout)
+	if err != nil {
+		log.Printf("job %s failed: %s", job.ID, err)
+	} else {
+		log.Printf("job %s output written to %s", job.ID, job.upload.outputPath())
+	}
+	job.finish(results, err)
+}
+
+// JobQueue runs patch jobs on a fixed number of workers
+type JobQueue struct {
+	mutex     sync.Mutex
+	jobs      map[string]*Job
+	pending   chan *Job
+	timeout   time.Duration
+	retention time.Duration
+}
+
+// NewJobQueue starts config.Workers workers that run jobs from a queue holding at most config.QueueLength waiting jobs
+// Jobs are stopped after config.JobTimeout, then forgotten and their files removed once config.JobRetention has passed.
+func NewJobQueue(config Config) *JobQueue {
+	queue := &JobQueue{
+		jobs:      map[string]*Job{},
+		pending:   make(chan *Job, config.QueueLength),
+		timeout:   config.JobTimeout,
+		retention: config.JobRetention,
+	}
+	for i := 0; i < config.Workers; i++ {
+		go queue.work()
+	}
+	return queue
+}
+
+func (queue *JobQueue) work() {
+	for job := range queue.pending {
+		job.run(queue.timeout)
+		job := job
+		time.AfterFunc(queue.retention, func() { queue.remove(job) })
+	}
+}
+
+// remove forgets a finished job and removes its upload and output
+func (queue *JobQueue) remove(job *Job) {
+	queue.mutex.Lock()
+	delete(queue.jobs, job.ID)
+	queue.mutex.Unlock()
+	err := job.upload.Close()
+	if err != nil {
+		log.Printf("could not remove the files of job %s: %s", job.ID, err)
+	}
+}
+
+// Submit queues a job for the upload or returns ErrQueueFull
+func (queue *JobQueue) Submit(upload patchUpload) (job *Job, err error) {
+	id, err := newJobID()
+	if err != nil {
+		return
+	}
+	job = &Job{ID: id, upload: upload, changed: make(chan struct{})}
+	job.publish(jobEvent{State: JobQueued, Message: "queued"})
+
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	select {
+	case queue.pending <- job:
+		queue.jobs[id] = job
+		return job, nil
+	default:
+		return nil, ErrQueueFull
+	}
+}
+
+// Job returns the job with the ID or nil if there is none
+func (queue *JobQueue) Job(id string) *Job {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	return queue.jobs[id]
+}
+
+func newJobID() (string, error) {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// submitJob handles POST /api/v1/jobs
+func (s *server) submitJob(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method != http.MethodPost {
+		writeErr(w, http.StatusMethodNotAllowed, fmt.Errorf("%s not allowed", r.Method))
+		return
+	}
+
+	upload, statusCode, err := saveUpload(r, s.config)
+	if err != nil {
+		writeErr(w, statusCode, err)
+		return
+	}
+
+	job, err := s.queue.Submit(upload)
+	if err != nil {
+		upload.Close()
+	}
+	if err == ErrQueueFull {
+		writeErr(w, http.StatusServiceUnavailable, err)
+		return
+	} else if err != nil {
+		writeErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	log.Printf("job %s queued", job.ID)
+
+	w.Header().Set("Location", "/api/v1/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job.status())
+}
+
+// jobRoutes handles GET /api/v1/jobs/{id}, GET /api/v1/jobs/{id}/output and GET /api/v1/jobs/{id}/events
+func (s *server) jobRoutes(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method != http.MethodGet {
+		writeErr(w, http.StatusMethodNotAllowed, fmt.Errorf("%s not allowed", r.Method))
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/jobs/"), "/")
+	job := s.queue.Job(parts[0])
+	if job == nil || len(parts) > 2 {
+		notFound(w, r)
+		return
+	}
+	if len(parts) == 1 {
+		writeJSON(w, http.StatusOK, job.status())
+		return
+	}
+	switch parts[1] {
+	case "output":
+		jobOutput(w, job)
+	case "events":
+		jobEvents(w, r, job)
+	default:
+		notFound(w, r)
+	}
+}
+
+func jobOutput(w http.ResponseWriter, job *Job) {
+	state := job.State()
+	if state != JobDone {
+		writeErr(w, http.StatusConflict, fmt.Errorf("job %s is %s", job.ID, state))
+		return
+	}
+
+	outputFile, err := os.Open(job.upload.outputPath())
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer outputFile.Close()
+
+	w.Header().Set("Content-Disposition", "attachment; filename="+job.upload.outputFileName())
+	w.Header().Set("Content-Type", job.upload.outputContentType())
+	io.Copy(w, outputFile)
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,329 @@
+package api_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/motevets/pdfpatch/pkg/api"
+	"github.com/motevets/pdfpatch/pkg/manifest"
+	"github.com/motevets/pdfpatch/pkg/pdfpatch"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	fixturesPath = "../../test/fixtures/multiple_patches"
+	pdfsDir      = fixturesPath + "/pdfs"
+	renderedPDF  = "../../test/fixtures/hello_from_page_1.pdf"
+)
+
+// jobStatus is the JSON body of GET /api/v1/jobs/{id}
+type jobStatus struct {
+	ID      string `json:"id"`
+	State   string `json:"state"`
+	Error   string `json:"error"`
+	Sources []struct {
+		FileName     string `json:"fileName"`
+		Hunks        int    `json:"hunks"`
+		HunksApplied int    `json:"hunksApplied"`
+	} `json:"sources"`
+}
+
+// jobEvent is an event streamed by GET /api/v1/jobs/{id}/events
+type jobEvent struct {
+	ID    string
+	State string `json:"state"`
+	Error string `json:"error"`
+}
+
+// multipartRequest returns a POST request with the fields and the files at the paths in files
+func multipartRequest(target string, fields map[string]string, files map[string][]string) *http.Request {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range fields {
+		Expect(writer.WriteField(name, value)).To(Succeed())
+	}
+	for name, filePaths := range files {
+		for _, filePath := range filePaths {
+			part, err := writer.CreateFormFile(name, path.Base(filePath))
+			Expect(err).NotTo(HaveOccurred())
+			contents, err := ioutil.ReadFile(filePath)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = part.Write(contents)
+			Expect(err).NotTo(HaveOccurred())
+		}
+	}
+	Expect(writer.Close()).To(Succeed())
+	request := httptest.NewRequest(http.MethodPost, target, &body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	return request
+}
+
+// makeBundle makes a bundle of the fixtures in dir with patches made with the gopdf extractor and returns its path
+func makeBundle(dir string) string {
+	bundlePath := path.Join(dir, "bundle.zip")
+	theManifest := manifest.Manifest{
+		Sources: []manifest.Source{
+			{FileName: "title_pages.pdf", PatchedFiles: []string{"title.md", "dedication.md"}},
+			{FileName: "chapter_1.pdf", PatchedFiles: []string{"chapter_1.md"}},
+		},
+		Styles: []manifest.Style{{Name: "Traditional", StyleSheet: "book.css"}},
+	}
+	err := pdfpatch.MakeBundle(theManifest, pdfsDir, path.Join(fixturesPath, "markdowns"), "../../test/fixtures/patch_bundle/css", bundlePath, pdfpatch.Options{Extractor: "gopdf"})
+	Expect(err).NotTo(HaveOccurred())
+	return bundlePath
+}
+
+// patchRequest returns a request patching the source PDFs with the bundle and the cssName
+func patchRequest(target string, bundlePath string, cssName string) *http.Request {
+	return multipartRequest(target, map[string]string{"cssName": cssName}, map[string][]string{
+		"pdfs":   {path.Join(pdfsDir, "title_pages.pdf"), path.Join(pdfsDir, "chapter_1.pdf")},
+		"bundle": {bundlePath},
+	})
+}
+
+// readEvents returns the server-sent events in body
+func readEvents(body string) (events []jobEvent) {
+	for _, block := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		var event jobEvent
+		for _, line := range strings.Split(block, "\n") {
+			if strings.HasPrefix(line, "id: ") {
+				event.ID = strings.TrimPrefix(line, "id: ")
+			} else if strings.HasPrefix(line, "data: ") {
+				Expect(json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event)).To(Succeed())
+			}
+		}
+		events = append(events, event)
+	}
+	return
+}
+
+var _ = Describe("jobs", func() {
+	var (
+		tempDir     string
+		bundlePath  string
+		oldPath     string
+		oldTempDir  string
+		releasePath string
+		config      api.Config
+		handler     http.Handler
+	)
+
+	serve := func(request *http.Request) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	submit := func(cssName string) (id string) {
+		response := serve(patchRequest("/api/v1/jobs", bundlePath, cssName))
+		Expect(response.Code).To(Equal(http.StatusAccepted), response.Body.String())
+		var status jobStatus
+		Expect(json.Unmarshal(response.Body.Bytes(), &status)).To(Succeed())
+		Expect(status.State).To(Equal("queued"))
+		Expect(response.Header().Get("Location")).To(Equal("/api/v1/jobs/" + status.ID))
+		return status.ID
+	}
+
+	getStatus := func(id string) (status jobStatus) {
+		response := serve(httptest.NewRequest(http.MethodGet, "/api/v1/jobs/"+id, nil))
+		Expect(response.Code).To(Equal(http.StatusOK))
+		Expect(json.Unmarshal(response.Body.Bytes(), &status)).To(Succeed())
+		return
+	}
+
+	state := func(id string) func() string {
+		return func() string { return getStatus(id).State }
+	}
+
+	release := func() {
+		Expect(ioutil.WriteFile(releasePath, nil, 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = ioutil.TempDir("", "api_test")
+		Expect(err).NotTo(HaveOccurred())
+		binDir := path.Join(tempDir, "bin")
+		workDir := path.Join(tempDir, "tmp")
+		Expect(os.Mkdir(binDir, 0755)).To(Succeed())
+		Expect(os.Mkdir(workDir, 0755)).To(Succeed())
+		releasePath = path.Join(tempDir, "release")
+		bundlePath = makeBundle(tempDir)
+
+		// the fake renderer waits to be released, so jobs can be seen rendering, then writes a fixture PDF
+		fixturePDF, err := filepath.Abs(renderedPDF)
+		Expect(err).NotTo(HaveOccurred())
+		script := fmt.Sprintf("#!/bin/sh\nwhile [ -d '%s' ] && [ ! -e '%s' ]; do sleep 0.01; done\nfor output; do :; done\ncp '%s' \"$output\"\n",
+			tempDir, releasePath, fixturePDF)
+		Expect(ioutil.WriteFile(path.Join(binDir, "wkhtmltopdf"), []byte(script), 0755)).To(Succeed())
+
+		oldPath, oldTempDir = os.Getenv("PATH"), os.Getenv("TMPDIR")
+		Expect(os.Setenv("PATH", binDir+string(os.PathListSeparator)+oldPath)).To(Succeed())
+		Expect(os.Setenv("TMPDIR", workDir)).To(Succeed())
+
+		config = api.Config{Workers: 1, QueueLength: 1, Renderer: "wkhtmltopdf"}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		handler, err = api.NewHandler(config)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.Setenv("PATH", oldPath)
+		os.Setenv("TMPDIR", oldTempDir)
+		os.RemoveAll(tempDir)
+	})
+
+	It("patches the bundle in the background and serves the output once it is done", func() {
+		release()
+		id := submit("book.css")
+
+		Eventually(state(id), 10*time.Second).Should(Equal("done"))
+		status := getStatus(id)
+		Expect(status.Error).To(BeEmpty())
+		Expect(status.Sources).To(HaveLen(2))
+		Expect(status.Sources[0].FileName).To(Equal("title_pages.pdf"))
+		Expect(status.Sources[1].FileName).To(Equal("chapter_1.pdf"))
+
+		response := serve(httptest.NewRequest(http.MethodGet, "/api/v1/jobs/"+id+"/output", nil))
+		Expect(response.Code).To(Equal(http.StatusOK))
+		Expect(response.Header().Get("Content-Type")).To(Equal("application/pdf"))
+		Expect(response.Header().Get("Content-Disposition")).To(Equal("attachment; filename=output.pdf"))
+		expected, err := ioutil.ReadFile(renderedPDF)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Body.Bytes()).To(Equal(expected))
+	})
+
+	It("runs as many jobs at a time as there are workers and refuses jobs once the queue is full", func() {
+		running := submit("book.css")
+		Eventually(state(running), 10*time.Second).Should(Equal("rendering"))
+		response := serve(httptest.NewRequest(http.MethodGet, "/api/v1/jobs/"+running+"/output", nil))
+		Expect(response.Code).To(Equal(http.StatusConflict))
+		Expect(response.Body.String()).To(ContainSubstring("is rendering"))
+
+		waiting := submit("book.css")
+		Consistently(state(waiting), 200*time.Millisecond).Should(Equal("queued"))
+		response = serve(patchRequest("/api/v1/jobs", bundlePath, "book.css"))
+		Expect(response.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(response.Body.String()).To(ContainSubstring(api.ErrQueueFull.Error()))
+
+		release()
+		Eventually(state(running), 10*time.Second).Should(Equal("done"))
+		Eventually(state(waiting), 10*time.Second).Should(Equal("done"))
+	})
+
+	It("fails jobs that cannot be patched and says why", func() {
+		id := submit("missing.css")
+
+		Eventually(state(id), 10*time.Second).Should(Equal("failed"))
+		Expect(getStatus(id).Error).To(ContainSubstring("missing.css"))
+		response := serve(httptest.NewRequest(http.MethodGet, "/api/v1/jobs/"+id+"/output", nil))
+		Expect(response.Code).To(Equal(http.StatusConflict))
+	})
+
+	When("the retention of a finished job has passed", func() {
+		BeforeEach(func() {
+			config.JobRetention = 50 * time.Millisecond
+		})
+
+		It("forgets the job", func() {
+			release()
+			id := submit("book.css")
+
+			Eventually(func() int {
+				return serve(httptest.NewRequest(http.MethodGet, "/api/v1/jobs/"+id, nil)).Code
+			}, 10*time.Second).Should(Equal(http.StatusNotFound))
+			response := serve(httptest.NewRequest(http.MethodGet, "/api/v1/jobs/"+id+"/output", nil))
+			Expect(response.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	It("responds 404 for jobs that do not exist", func() {
+		for _, target := range []string{"/api/v1/jobs/unknown", "/api/v1/jobs/unknown/output", "/api/v1/jobs/unknown/events"} {
+			Expect(serve(httptest.NewRequest(http.MethodGet, target, nil)).Code).To(Equal(http.StatusNotFound), target)
+		}
+	})
+
+	It("rejects requests missing a field", func() {
+		response := serve(multipartRequest("/api/v1/jobs", map[string]string{"cssName": "book.css"}, map[string][]string{
+			"pdfs": {path.Join(pdfsDir, "chapter_1.pdf")},
+		}))
+		Expect(response.Code).To(Equal(http.StatusBadRequest))
+		Expect(response.Body.String()).To(ContainSubstring(`Missing "bundle" file field`))
+
+		response = serve(httptest.NewRequest(http.MethodGet, "/api/v1/jobs", nil))
+		Expect(response.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+
+	Describe("events", func() {
+		It("streams the progress of the job until it is done", func() {
+			id := submit("book.css")
+			server := httptest.NewServer(handler)
+			defer server.Close()
+
+			response, err := http.Get(server.URL + "/api/v1/jobs/" + id + "/events")
+			Expect(err).NotTo(HaveOccurred())
+			defer response.Body.Close()
+			Expect(response.StatusCode).To(Equal(http.StatusOK))
+			Expect(response.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+
+			// the job is held rendering until the stream has shown it
+			var streamed strings.Builder
+			reader := bufio.NewReader(response.Body)
+			for !strings.Contains(streamed.String(), `"state":"rendering"`) {
+				line, err := reader.ReadString('\n')
+				Expect(err).NotTo(HaveOccurred())
+				streamed.WriteString(line)
+			}
+			release()
+			rest, err := ioutil.ReadAll(reader)
+			Expect(err).NotTo(HaveOccurred())
+			streamed.Write(rest)
+
+			events := readEvents(streamed.String())
+			var states []string
+			for i, event := range events {
+				Expect(event.ID).To(Equal(fmt.Sprint(i)))
+				if len(states) == 0 || states[len(states)-1] != event.State {
+					states = append(states, event.State)
+				}
+			}
+			Expect(states).To(Equal([]string{"queued", "extracting", "patching", "rendering", "done"}))
+		})
+
+		It("resumes after the Last-Event-ID", func() {
+			release()
+			id := submit("book.css")
+			Eventually(state(id), 10*time.Second).Should(Equal("done"))
+			all := readEvents(serve(httptest.NewRequest(http.MethodGet, "/api/v1/jobs/"+id+"/events", nil)).Body.String())
+
+			request := httptest.NewRequest(http.MethodGet, "/api/v1/jobs/"+id+"/events", nil)
+			request.Header.Set("Last-Event-ID", "1")
+			Expect(readEvents(serve(request).Body.String())).To(Equal(all[2:]))
+		})
+
+		It("ends with the error of a failed job", func() {
+			id := submit("missing.css")
+			Eventually(state(id), 10*time.Second).Should(Equal("failed"))
+
+			events := readEvents(serve(httptest.NewRequest(http.MethodGet, "/api/v1/jobs/"+id+"/events", nil)).Body.String())
+			last := events[len(events)-1]
+			Expect(last.State).To(Equal("failed"))
+			Expect(last.Error).To(ContainSubstring("missing.css"))
+		})
+	})
+})
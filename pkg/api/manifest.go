@@ -0,0 +1,129 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/motevets/pdfpatch/pkg/manifest"
+	"github.com/motevets/pdfpatch/pkg/workspace"
+)
+
+// manifestInfo is the manifest of a bundle as returned by POST /api/v1/manifest
+type manifestInfo struct {
+	Version  int          `json:"version"`
+	Book     bookInfo     `json:"book"`
+	Metadata metadataInfo `json:"metadata"`
+	Sources  []sourceInfo `json:"sources"`
+	Styles   []styleInfo  `json:"styles"`
+}
+
+type bookInfo struct {
+	Title       string   `json:"title,omitempty"`
+	Subtitle    string   `json:"subtitle,omitempty"`
+	Authors     []string `json:"authors,omitempty"`
+	Language    string   `json:"language,omitempty"`
+	Identifier  string   `json:"identifier,omitempty"`
+	Publisher   string   `json:"publisher,omitempty"`
+	Rights      string   `json:"rights,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+type metadataInfo struct {
+	Name        string   `json:"name,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Authors     []string `json:"authors,omitempty"`
+	License     string   `json:"license,omitempty"`
+	Homepage    string   `json:"homepage,omitempty"`
+}
+
+type sourceInfo struct {
+	FileName         string   `json:"fileName"`
+	URL              string   `json:"url,omitempty"`
+	Pages            string   `json:"pages,omitempty"`
+	PatchedFiles     []string `json:"patchedFiles"`
+	Extractor        string   `json:"extractor,omitempty"`
+	ExtractorVersion string   `json:"extractorVersion,omitempty"`
+}
+
+type styleInfo struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	StyleSheet  string   `json:"styleSheet"`
+	Renderer    string   `json:"renderer,omitempty"`
+	Formats     []string `json:"formats,omitempty"`
+}
+
+func newManifestInfo(theManifest manifest.Manifest) manifestInfo {
+	info := manifestInfo{
+		Version:  theManifest.Version,
+		Book:     bookInfo(theManifest.Book),
+		Metadata: metadataInfo(theManifest.Metadata),
+		Sources:  []sourceInfo{},
+		Styles:   []styleInfo{},
+	}
+	for _, source := range theManifest.Sources {
+		info.Sources = append(info.Sources, sourceInfo{
+			FileName:         source.FileName,
+			URL:              source.URL,
+			Pages:            source.Pages,
+			PatchedFiles:     source.PatchedFiles,
+			Extractor:        source.Extractor,
+			ExtractorVersion: source.ExtractorVersion,
+		})
+	}
+	for _, style := range theManifest.Styles {
+		info.Styles = append(info.Styles, styleInfo(style))
+	}
+	return info
+}
+
+// inspectManifest handles POST /api/v1/manifest
+func (s *server) inspectManifest(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method != http.MethodPost {
+		writeErr(w, http.StatusMethodNotAllowed, fmt.Errorf("%s not allowed", r.Method))
+		return
+	}
+
+	err := r.ParseMultipartForm(10 << 20) // use max 10mb of memory for upload
+	if err != nil {
+		writeErr(w, http.StatusBadRequest, err)
+		return
+	}
+	bundleFileHeaders := r.MultipartForm.File["bundle"]
+	if len(bundleFileHeaders) == 0 {
+		writeErr(w, http.StatusBadRequest, fmt.Errorf("Missing \"bundle\" file field"))
+		return
+	}
+
+	ws, err := workspace.New("bundle-inspect-", s.config.KeepWorkDir)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer ws.Close()
+	bundleFilePath := ws.Path(path.Base(bundleFileHeaders[0].Filename))
+	err = saveUploadedFile(bundleFileHeaders[0], bundleFilePath)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = manifest.VerifyBundle(bundleFilePath, manifest.DefaultBundleLimits)
+	if err != nil {
+		writeErr(w, http.StatusBadRequest, err)
+		return
+	}
+	bundle, err := manifest.UnpackBundleInto(bundleFilePath, ws.Path("bundle"))
+	var invalidErr manifest.InvalidBundleError
+	if errors.As(err, &invalidErr) {
+		writeErr(w, http.StatusBadRequest, err)
+		return
+	} else if err != nil {
+		writeErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newManifestInfo(bundle.Manifest))
+}
@@ -0,0 +1,74 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/motevets/pdfpatch/pkg/api"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("inspecting manifests", func() {
+	var handler http.Handler
+
+	serve := func(request *http.Request) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	BeforeEach(func() {
+		var err error
+		handler, err = api.NewHandler(api.Config{})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("returns the manifest of the bundle", func() {
+		response := serve(multipartRequest("/api/v1/manifest", nil, map[string][]string{
+			"bundle": {"../../test/fixtures/patch_bundle.zip"},
+		}))
+		Expect(response.Code).To(Equal(http.StatusOK))
+		Expect(response.Header().Get("Content-Type")).To(Equal("application/json"))
+
+		var info struct {
+			Sources []struct {
+				FileName     string   `json:"fileName"`
+				URL          string   `json:"url"`
+				PatchedFiles []string `json:"patchedFiles"`
+			} `json:"sources"`
+			Styles []struct {
+				Name       string `json:"name"`
+				StyleSheet string `json:"styleSheet"`
+			} `json:"styles"`
+		}
+		Expect(json.Unmarshal(response.Body.Bytes(), &info)).To(Succeed())
+		Expect(info.Sources).To(HaveLen(2))
+		Expect(info.Sources[0].FileName).To(Equal("title_pages.pdf"))
+		Expect(info.Sources[0].URL).To(Equal("http://example.com/title_pages.pdf"))
+		Expect(info.Sources[0].PatchedFiles).To(Equal([]string{"title.md", "dedication.md"}))
+		Expect(info.Styles).To(HaveLen(2))
+		Expect(info.Styles[1].Name).To(Equal("Large Print"))
+		Expect(info.Styles[1].StyleSheet).To(Equal("large_print.css"))
+	})
+
+	It("rejects requests without a bundle", func() {
+		response := serve(multipartRequest("/api/v1/manifest", map[string]string{"cssName": "book.css"}, nil))
+		Expect(response.Code).To(Equal(http.StatusBadRequest))
+		Expect(response.Body.String()).To(ContainSubstring(`Missing "bundle" file field`))
+	})
+
+	It("rejects bundles that are not safe to unpack", func() {
+		response := serve(multipartRequest("/api/v1/manifest", nil, map[string][]string{
+			"bundle": {"../../test/fixtures/malicious_bundles/stray_entry.zip"},
+		}))
+		Expect(response.Code).To(Equal(http.StatusBadRequest))
+		Expect(response.Body.String()).To(ContainSubstring("evil.sh"))
+	})
+
+	It("only allows POST", func() {
+		response := serve(httptest.NewRequest(http.MethodGet, "/api/v1/manifest", nil))
+		Expect(response.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
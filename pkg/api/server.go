@@ -1,173 +1,306 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
-	"mime/multipart"
 	"net/http"
 	"os"
-	"path"
 	"runtime/debug"
+	"time"
 
+	"github.com/motevets/pdfpatch/pkg/extractor"
+	"github.com/motevets/pdfpatch/pkg/manifest"
+	"github.com/motevets/pdfpatch/pkg/pdfbinder"
 	"github.com/motevets/pdfpatch/pkg/pdfpatch"
+	"github.com/motevets/pdfpatch/pkg/sourcestore"
 )
 
-func patch(w http.ResponseWriter, r *http.Request) {
+// server serves the API with its configuration and queue of jobs
+type server struct {
+	config Config
+	queue  *JobQueue
+}
+
+func (s *server) patch(w http.ResponseWriter, r *http.Request) {
 	var (
-		err                error
-		pdfFilesHeaders    []*multipart.FileHeader
-		bundleFileHeaders  []*multipart.FileHeader
-		uploadedBundleFile multipart.File
-		assetsDir          string
-		pdfsDir            string
-		bundleFilePath     string
-		bundleFile         *os.File
-		cssName            string
-		outputPDFPath      string
-		outputPDFFile      *os.File
+		err        error
+		upload     patchUpload
+		statusCode int
+		outputFile *os.File
 	)
 
 	enableCors(&w)
 
-	err = r.ParseMultipartForm(10 << 20) // use max 10mb of memory for upload
+	upload, statusCode, err = saveUpload(r, s.config)
 	if err != nil {
-		writeErr(w, http.StatusBadRequest, err)
-		return
-	}
-
-	cssName = r.FormValue("cssName")
-	if cssName == "" {
-		writeErr(w, http.StatusBadRequest, fmt.Errorf("Missing \"cssName\" field"))
+		writeErr(w, statusCode, err)
 		return
 	}
+	defer upload.Close()
 
-	pdfFilesHeaders = r.MultipartForm.File["pdfs"]
-	if pdfFilesHeaders == nil {
-		writeErr(w, http.StatusBadRequest, fmt.Errorf("Missing \"pdfs\" files field"))
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.JobTimeout)
+	defer cancel()
+	_, err = pdfpatch.PatchBundleContext(ctx, upload.bundleFilePath, upload.pdfsDir, upload.cssName, upload.outputPath(), upload.options)
+	if r.Context().Err() != nil {
+		log.Println("client disconnected, patching stopped:", err)
 		return
 	}
-
-	bundleFileHeaders = r.MultipartForm.File["bundle"]
-	if bundleFileHeaders == nil || len(bundleFileHeaders) == 0 {
-		writeErr(w, http.StatusBadRequest, fmt.Errorf("Missing \"bundle\" file field"))
+	if err != nil {
+		writeErr(w, patchErrStatus(err), timeoutErr(err, s.config.JobTimeout))
 		return
 	}
+	log.Println("output written to " + upload.outputPath())
 
-	assetsDir, err = ioutil.TempDir("", "bundle-assets-")
+	outputFile, err = os.Open(upload.outputPath())
 	if err != nil {
-		writeErr(w, http.StatusInternalServerError, err)
+		writeErr(w, http.StatusUnprocessableEntity, err)
 		return
 	}
+	defer outputFile.Close()
 
-	pdfsDir = path.Join(assetsDir, "pdfs")
-	err = os.Mkdir(pdfsDir, 0755)
+	w.Header().Set("Content-Disposition", "attachment; filename="+upload.outputFileName())
+	w.Header().Set("Content-Type", upload.outputContentType())
+	io.Copy(w, outputFile)
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	w.WriteHeader(http.StatusNotFound)
+	fmt.Fprintln(w, http.StatusText(http.StatusNotFound))
+}
+
+func enableCors(w *http.ResponseWriter) {
+	(*w).Header().Set("Access-Control-Allow-Origin", "*")
+}
+
+// Config configures the API server
+// Workers is the number of jobs patched at the same time
+// QueueLength is the number of jobs that may wait for a worker before new jobs are refused
+// Renderer is the name of the renderer used instead of the one named by each style (or the default)
+// JobRetention is how long a finished job and its output are kept before they are removed
+// JobTimeout is how long a patch request or job may run before it is stopped
+// KeepWorkDir leaves the uploads and intermediate files of every request in place, for debugging
+// Cache (optional) is where the text extracted from source PDFs is kept between requests
+// Sources (optional) stores the uploaded source PDFs so requests can refer to them by hash
+// Nothing is ever removed from it, so it is only for servers whose clients are trusted not to fill it.
+type Config struct {
+	Workers      int
+	QueueLength  int
+	Renderer     string
+	JobRetention time.Duration
+	JobTimeout   time.Duration
+	KeepWorkDir  bool
+	Cache        *extractor.Cache
+	Sources      sourcestore.Store
+}
+
+const (
+	DefaultWorkers      = 2
+	DefaultQueueLength  = 100
+	DefaultJobRetention = time.Hour
+	DefaultJobTimeout   = 10 * time.Minute
+)
+
+// ServeAPI starts an API server listening on PORT
+// This API serves these endpoints
+//
+//	POST /api/v0/patch
+//	  Request Headers:
+//	    Content-Type: multipart/form-data;
+//	  Body Parameters (all fields required unless noted):
+//	    cssName:       string  | the name of the CCS file in the bundle
+//	    pdfs:          []files | source PDF files enumerated in the bundle (stored for later requests if the
+//	                             server stores sources)
+//	    sources:       []strings | (optional) source PDFs stored on the server (see PUT /api/v1/sources/{hash})
+//	                               like FILE_NAME=HASH, needed for every source PDF not in pdfs
+//	    bundle:        file    | archive file (traditionally ZIP) with manifest, patch files, and CSS files
+//	    extractor:     string  | (optional) text extractor to use instead of the ones pinned in the manifest
+//	    allowRejected: string  | (optional) "true" to render the PDF even if some hunks could not be applied
+//	    format:        string  | (optional) "pdf" (the default) or "epub"
+//	  Response:
+//	    400 Bad Request:
+//	      a field is missing or invalid, or the bundle is not safe to unpack (an entry escapes the
+//	      bundle directory, is not one of manifest.yml, manifest.json, manifest.toml, css/ or patches/, or the
+//	      bundle has more than one manifest or is too large)
+//	    200 OK:
+//	      Response Headers:
+//	        Content-Disposition: attachment; filename=output.pdf (or output.epub)
+//	        Content-Type: application/pdf (or application/epub+zip)
+//	      Response Body:
+//	        output.pdf:  file | the remixed file
+//	    422 Unprocessable Entity:
+//	      a source PDF does not match the checksums in the manifest, was pinned to a different
+//	      extractor, or could not be patched, or the renderer failed (the error includes its stderr)
+//	    504 Gateway Timeout:
+//	      patching took longer than Config.JobTimeout
+//	  Patching is stopped, killing the extractor or renderer, if the client disconnects.
+//	POST /api/v1/jobs
+//	  Queues the same request as POST /api/v0/patch to be patched in the background
+//	  Jobs fail if they take longer than Config.JobTimeout to run.
+//	  Jobs and their output are removed once Config.JobRetention has passed since they finished,
+//	  after which their endpoints respond 404 Not Found.
+//	  Response:
+//	    400 Bad Request:
+//	      the same as POST /api/v0/patch
+//	    202 Accepted:
+//	      Response Headers:
+//	        Location: /api/v1/jobs/{id}
+//	      Response Body:
+//	        the job as returned by GET /api/v1/jobs/{id}
+//	    503 Service Unavailable:
+//	      the queue of jobs waiting for a worker is full
+//	GET /api/v1/jobs/{id}
+//	  Response:
+//	    200 OK:
+//	      Response Body (JSON):
+//	        id:      string | the job ID
+//	        state:   string | queued, extracting, patching, rendering, done, or failed
+//	        error:   string | why the job failed
+//	        sources: list of the patch results of each source PDF once patched
+//	          fileName:     string   | the source PDF
+//	          pages:        string   | the page ranges of the PDF that were patched
+//	          hunks:        number   | the number of hunks in the patch
+//	          hunksApplied: number   | the number of hunks that were applied
+//	          warnings:     []string | the hunks that were rejected or applied at an offset
+//	GET /api/v1/jobs/{id}/output
+//	  Response:
+//	    200 OK:
+//	      Response Headers:
+//	        Content-Disposition: attachment; filename=output.pdf (or output.epub)
+//	        Content-Type: application/pdf (or application/epub+zip)
+//	      Response Body:
+//	        output.pdf:  file | the remixed file
+//	    409 Conflict:
+//	      the job is not done
+//	GET /api/v1/jobs/{id}/events
+//	  Streams the progress of the job as server-sent events, ending once the job is done or failed
+//	  Request Headers:
+//	    Last-Event-ID: (optional) resume after the event with this id
+//	  Response:
+//	    200 OK:
+//	      Response Headers:
+//	        Content-Type: text/event-stream
+//	      Events (JSON data):
+//	        state:        string | queued, extracting, patching, rendering, done, or failed
+//	        message:      string | description like "extracted chapter_1.pdf", "applied 14/15 hunks to
+//	                               chapter_1.pdf" or "rendering page 3"
+//	        fileName:     string | the source PDF extracted or patched
+//	        hunks:        number | the number of hunks in the patch of a patched source PDF
+//	        hunksApplied: number | the number of those hunks that were applied
+//	        page:         number | the page being rendered
+//	        error:        string | why the job failed
+//	HEAD /api/v1/sources/{hash}
+//	  Checks whether the server has a source PDF so it need not be uploaded again (hash is its md5 or sha256)
+//	  Response:
+//	    200 OK:
+//	      the source is stored
+//	    404 Not Found:
+//	      the source is not stored, or the server does not store sources
+//	PUT /api/v1/sources/{hash}
+//	  Stores a source PDF for patch requests to refer to in their sources field
+//	  Request Body:
+//	    the PDF file, whose md5 or sha256 must be hash
+//	  Response:
+//	    201 Created:
+//	      the source is stored
+//	    200 OK:
+//	      the source was already stored
+//	    400 Bad Request:
+//	      hash is not an md5 or sha256 or is not the hash of the PDF
+//	    404 Not Found:
+//	      the server does not store sources
+//	    413 Request Entity Too Large:
+//	      the PDF is larger than 256MB
+//	POST /api/v1/manifest
+//	  Reads the manifest of a bundle, e.g. to show the book and its styles before patching
+//	  Request Headers:
+//	    Content-Type: multipart/form-data;
+//	  Body Parameters:
+//	    bundle: file | the same bundle as POST /api/v0/patch
+//	  Response:
+//	    200 OK:
+//	      Response Body (JSON):
+//	        version:  number | the version of the manifest format the bundle was made with
+//	        book:     the metadata of the book: title, subtitle, authors, language, identifier,
+//	                  publisher, rights and description (each only if set)
+//	        metadata: the metadata of the bundle: name, description, authors, license and homepage
+//	        sources:  list of the source PDFs: fileName, url, pages, patchedFiles, extractor and
+//	                  extractorVersion
+//	        styles:   list of the styles: name, description, styleSheet, renderer and formats
+//	    400 Bad Request:
+//	      the bundle is missing, is not safe to unpack or its manifest is invalid
+func ServeAPI(port string, config Config) (err error) {
+	config = config.withDefaults()
+	handler, err := NewHandler(config)
 	if err != nil {
-		writeErr(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	for _, pdfFileHeader := range pdfFilesHeaders {
-		var (
-			uploadedPdfFile multipart.File
-			savedPdfFile    *os.File
-		)
-		uploadedPdfFile, err = pdfFileHeader.Open()
-		if err != nil {
-			writeErr(w, http.StatusInternalServerError, err)
-			return
-		}
-		defer uploadedPdfFile.Close()
+	serverAddress := fmt.Sprintf(":%s", port)
+	log.Printf("pdfpatch server running and listening on %s with %d workers", port, config.Workers)
+	return http.ListenAndServe(serverAddress, handler)
+}
 
-		savedPdfFile, err = os.OpenFile(path.Join(pdfsDir, pdfFileHeader.Filename), os.O_WRONLY|os.O_CREATE, 0644)
-		if err != nil {
-			writeErr(w, http.StatusInternalServerError, err)
-			return
-		}
-		defer savedPdfFile.Close()
-		_, err = io.Copy(savedPdfFile, uploadedPdfFile)
+// NewHandler returns a handler serving the endpoints of the API (see ServeAPI) and starts the workers of its jobs
+// The defaults are used for the zero values of config.
+func NewHandler(config Config) (handler http.Handler, err error) {
+	config = config.withDefaults()
+	if config.Renderer != "" {
+		_, err = pdfbinder.NewRenderer(config.Renderer)
 		if err != nil {
-			writeErr(w, http.StatusInternalServerError, err)
 			return
 		}
 	}
-	log.Printf("pdfs written to %s", pdfsDir)
+	s := &server{config: config, queue: NewJobQueue(config)}
 
-	uploadedBundleFile, err = bundleFileHeaders[0].Open()
-	if err != nil {
-		writeErr(w, http.StatusInternalServerError, err)
-		return
-	}
-	defer uploadedBundleFile.Close()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v0/patch", s.patch)
+	mux.HandleFunc("/api/v1/jobs", s.submitJob)
+	mux.HandleFunc("/api/v1/jobs/", s.jobRoutes)
+	mux.HandleFunc("/api/v1/sources/", s.sourceRoutes)
+	mux.HandleFunc("/api/v1/manifest", s.inspectManifest)
+	mux.HandleFunc("/", notFound)
+	return mux, nil
+}
 
-	bundleFilePath = path.Join(assetsDir, bundleFileHeaders[0].Filename)
-	bundleFile, err = os.OpenFile(bundleFilePath, os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		writeErr(w, http.StatusInternalServerError, err)
-		return
+// withDefaults returns the config with the defaults in place of its zero values
+func (config Config) withDefaults() Config {
+	if config.Workers < 1 {
+		config.Workers = DefaultWorkers
 	}
-	defer bundleFile.Close()
-
-	_, err = io.Copy(bundleFile, uploadedBundleFile)
-	if err != nil {
-		writeErr(w, http.StatusInternalServerError, err)
-		return
+	if config.QueueLength < 1 {
+		config.QueueLength = DefaultQueueLength
 	}
-	log.Printf("bundle written to %s", bundleFile.Name())
-
-	outputPDFPath = path.Join(assetsDir, "output.pdf")
-
-	err = pdfpatch.PatchBundle(bundleFilePath, pdfsDir, cssName, outputPDFPath)
-	if err != nil {
-		writeErr(w, http.StatusUnprocessableEntity, err)
-		return
+	if config.JobRetention <= 0 {
+		config.JobRetention = DefaultJobRetention
 	}
-	log.Println("output PDF written to " + outputPDFPath)
-
-	outputPDFFile, err = os.Open(outputPDFPath)
-	if err != nil {
-		writeErr(w, http.StatusUnprocessableEntity, err)
-		return
+	if config.JobTimeout <= 0 {
+		config.JobTimeout = DefaultJobTimeout
 	}
-
-	w.Header().Set("Content-Disposition", "attachment; filename=output.pdf")
-	w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
-	io.Copy(w, outputPDFFile)
-}
-
-func notFound(w http.ResponseWriter, r *http.Request) {
-	enableCors(&w)
-	w.WriteHeader(http.StatusNotFound)
-	fmt.Fprintln(w, http.StatusText(http.StatusNotFound))
+	return config
 }
 
-func enableCors(w *http.ResponseWriter) {
-	(*w).Header().Set("Access-Control-Allow-Origin", "*")
+// patchErrStatus returns the status code for an error patching a bundle
+func patchErrStatus(err error) int {
+	var invalidErr manifest.InvalidBundleError
+	if errors.As(err, &invalidErr) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusUnprocessableEntity
 }
 
-// ServeAPI starts an API server listening on PORT
-// This API serves only one endpoint
-//   POST /api/v0/patch
-//     Request Headers:
-//       Content-Type: multipart/form-data;
-//     Body Parameters (all fields required):
-//       cssName: string  | the name of the CCS file in the bundle
-//       pdfs:    []files | source PDF files enumerated in the bundle
-//       bundle:  file    | archive file (traditionally ZIP) with manifest, patch files, and CSS files
-//     Response:
-//       200 OK:
-//         Response Headers:
-//           Content-Disposition: attachment; filename=output.pdf
-//           Content-Type: multipart/form-data; ...
-//         Response Body:
-//           output.pdf:  file | the remixed file
-func ServeAPI(port string) (err error) {
-	serverAddress := fmt.Sprintf(":%s", port)
-	http.HandleFunc("/api/v0/patch", patch)
-	http.HandleFunc("/", notFound)
-	log.Printf("pdfpatch server running and listening on %s", port)
-	return http.ListenAndServe(serverAddress, nil)
+// timeoutErr explains an error caused by patching taking longer than timeout
+func timeoutErr(err error, timeout time.Duration) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("patching took longer than %s: %w", timeout, err)
+	}
+	return err
 }
 
 func writeErr(w http.ResponseWriter, statusCode int, err error) {
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/motevets/pdfpatch/pkg/sourcestore"
+)
+
+// maxSourceSize is the largest source PDF that may be stored
+const maxSourceSize = 256 << 20
+
+// errSourceTooLarge is returned for a source PDF larger than maxSourceSize
+var errSourceTooLarge = fmt.Errorf("sources may be at most %d bytes", maxSourceSize)
+
+// sizeLimitedReader reads from r, failing with errSourceTooLarge once it has more than remaining bytes
+type sizeLimitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (reader *sizeLimitedReader) Read(p []byte) (n int, err error) {
+	if int64(len(p)) > reader.remaining+1 {
+		p = p[:reader.remaining+1]
+	}
+	n, err = reader.r.Read(p)
+	reader.remaining -= int64(n)
+	if reader.remaining < 0 {
+		return n + int(reader.remaining), errSourceTooLarge
+	}
+	return
+}
+
+// sourceRoutes handles HEAD /api/v1/sources/{hash} and PUT /api/v1/sources/{hash}
+func (s *server) sourceRoutes(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if s.config.Sources == nil {
+		notFound(w, r)
+		return
+	}
+	hash, err := sourcestore.CheckHash(strings.TrimPrefix(r.URL.Path, "/api/v1/sources/"))
+	if err != nil {
+		writeErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("Access-Control-Allow-Methods", "HEAD, PUT")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodHead:
+		found, err := s.config.Sources.Has(hash)
+		if err != nil {
+			writeErr(w, http.StatusInternalServerError, err)
+		} else if found {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case http.MethodPut:
+		s.putSource(w, r, hash)
+	default:
+		writeErr(w, http.StatusMethodNotAllowed, fmt.Errorf("%s not allowed", r.Method))
+	}
+}
+
+func (s *server) putSource(w http.ResponseWriter, r *http.Request, hash string) {
+	found, err := s.config.Sources.Has(hash)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	if found {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.ContentLength > maxSourceSize {
+		writeErr(w, http.StatusRequestEntityTooLarge, errSourceTooLarge)
+		return
+	}
+
+	_, err = s.config.Sources.Put(hash, &sizeLimitedReader{r: r.Body, remaining: maxSourceSize})
+	var mismatchErr *sourcestore.HashMismatchError
+	if errors.As(err, &mismatchErr) {
+		writeErr(w, http.StatusBadRequest, err)
+		return
+	} else if errors.Is(err, errSourceTooLarge) {
+		writeErr(w, http.StatusRequestEntityTooLarge, err)
+		return
+	} else if err != nil {
+		writeErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	log.Printf("source %s stored", hash)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// storeSource adds an uploaded source PDF to the store so later requests can refer to it by hash
+func storeSource(store sourcestore.Store, pdfPath string) {
+	pdfFile, err := os.Open(pdfPath)
+	if err == nil {
+		defer pdfFile.Close()
+		_, err = store.Put("", pdfFile)
+	}
+	if err != nil {
+		log.Printf("WARNING: could not store source %s: %s", path.Base(pdfPath), err)
+	}
+}
+
+// copyStoredSource writes the stored source named by a "FILE_NAME=HASH" reference to pdfsDir
+// The returned status code is the one to respond with if err is not nil.
+func copyStoredSource(store sourcestore.Store, reference string, pdfsDir string) (statusCode int, err error) {
+	parts := strings.SplitN(reference, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[0] != path.Base(parts[0]) || parts[0] == ".." {
+		return http.StatusBadRequest, fmt.Errorf("source %q must be like FILE_NAME=HASH", reference)
+	}
+	fileName := parts[0]
+	hash, err := sourcestore.CheckHash(parts[1])
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if store == nil {
+		return http.StatusBadRequest, fmt.Errorf("sources cannot be referred to by hash, the server does not store them")
+	}
+
+	source, err := store.Open(hash)
+	if err == sourcestore.ErrNotFound {
+		return http.StatusBadRequest, fmt.Errorf("source %s for %s is not stored, upload it with PUT /api/v1/sources/%s", hash, fileName, hash)
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer source.Close()
+
+	pdfFile, err := os.OpenFile(path.Join(pdfsDir, fileName), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	_, err = io.Copy(pdfFile, source)
+	if closeErr := pdfFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return
+}
@@ -0,0 +1,107 @@
+package api_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+
+	"github.com/motevets/pdfpatch/pkg/api"
+	"github.com/motevets/pdfpatch/pkg/sourcestore"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("sources", func() {
+	const (
+		md5Sum      = "a9933c03362f2b40fa4c28cb86bff14d"
+		otherSha256 = "0000000000000000000000000000000000000000000000000000000000000000"
+	)
+	var (
+		storeDir string
+		contents []byte
+		config   api.Config
+		handler  http.Handler
+	)
+
+	serve := func(method string, target string, body []byte) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(method, target, bytes.NewReader(body)))
+		return recorder
+	}
+
+	BeforeEach(func() {
+		var err error
+		storeDir, err = ioutil.TempDir("", "api_sources_test")
+		Expect(err).NotTo(HaveOccurred())
+		store, err := sourcestore.NewLocalStore(storeDir)
+		Expect(err).NotTo(HaveOccurred())
+		contents, err = ioutil.ReadFile(path.Join(pdfsDir, "chapter_1.pdf"))
+		Expect(err).NotTo(HaveOccurred())
+		config = api.Config{Sources: store}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		handler, err = api.NewHandler(config)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(storeDir)
+	})
+
+	It("stores a source PDF under its hash", func() {
+		Expect(serve(http.MethodHead, "/api/v1/sources/"+md5Sum, nil).Code).To(Equal(http.StatusNotFound))
+
+		Expect(serve(http.MethodPut, "/api/v1/sources/"+md5Sum, contents).Code).To(Equal(http.StatusCreated))
+		Expect(serve(http.MethodHead, "/api/v1/sources/"+md5Sum, nil).Code).To(Equal(http.StatusOK))
+
+		Expect(serve(http.MethodPut, "/api/v1/sources/"+md5Sum, contents).Code).To(Equal(http.StatusOK))
+	})
+
+	It("rejects a source PDF that does not match its hash", func() {
+		response := serve(http.MethodPut, "/api/v1/sources/"+otherSha256, contents)
+		Expect(response.Code).To(Equal(http.StatusBadRequest))
+		Expect(serve(http.MethodHead, "/api/v1/sources/"+otherSha256, nil).Code).To(Equal(http.StatusNotFound))
+		Expect(serve(http.MethodHead, "/api/v1/sources/"+md5Sum, nil).Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("rejects hashes that are not an md5 or sha256", func() {
+		for _, hash := range []string{"not-a-hash", md5Sum[:31], md5Sum + "/chapter_1.pdf"} {
+			Expect(serve(http.MethodPut, "/api/v1/sources/"+hash, contents).Code).To(Equal(http.StatusBadRequest), hash)
+		}
+	})
+
+	It("rejects source PDFs larger than 256MB", func() {
+		request := httptest.NewRequest(http.MethodPut, "/api/v1/sources/"+md5Sum, bytes.NewReader(contents))
+		request.ContentLength = 256<<20 + 1
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		Expect(recorder.Code).To(Equal(http.StatusRequestEntityTooLarge))
+		Expect(serve(http.MethodHead, "/api/v1/sources/"+md5Sum, nil).Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("rejects patch requests referring to sources that are not stored", func() {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, multipartRequest("/api/v1/jobs", map[string]string{
+			"cssName": "book.css",
+			"sources": "chapter_1.pdf=0000000000000000000000000000000a",
+		}, map[string][]string{"bundle": {"../../test/fixtures/patch_bundle.zip"}}))
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		Expect(recorder.Body.String()).To(ContainSubstring("is not stored"))
+	})
+
+	When("the server does not store sources", func() {
+		BeforeEach(func() {
+			config.Sources = nil
+		})
+
+		It("responds 404", func() {
+			Expect(serve(http.MethodHead, "/api/v1/sources/"+md5Sum, nil).Code).To(Equal(http.StatusNotFound))
+			Expect(serve(http.MethodPut, "/api/v1/sources/"+md5Sum, contents).Code).To(Equal(http.StatusNotFound))
+		})
+	})
+})
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+
+	"github.com/motevets/pdfpatch/pkg/manifest"
+	"github.com/motevets/pdfpatch/pkg/pdfpatch"
+	"github.com/motevets/pdfpatch/pkg/workspace"
+)
+
+// patchUpload is a bundle and its source PDFs saved from a multipart patch request
+// The workspace holding the upload and the patched document is removed with Close.
+type patchUpload struct {
+	workspace      *workspace.Workspace
+	pdfsDir        string
+	bundleFilePath string
+	cssName        string
+	options        pdfpatch.Options
+}
+
+// outputFileName is the name of the patched document, output.pdf or output.epub
+func (upload patchUpload) outputFileName() string {
+	if upload.options.Format == pdfpatch.FormatEPUB {
+		return "output.epub"
+	}
+	return "output.pdf"
+}
+
+// outputPath is where the patched document for the upload is written
+func (upload patchUpload) outputPath() string {
+	return upload.workspace.Path(upload.outputFileName())
+}
+
+// Close removes the files of the upload and its patched document
+func (upload patchUpload) Close() error {
+	if upload.workspace == nil {
+		return nil
+	}
+	return upload.workspace.Close()
+}
+
+// outputContentType is the media type of the patched document
+func (upload patchUpload) outputContentType() string {
+	if upload.options.Format == pdfpatch.FormatEPUB {
+		return "application/epub+zip"
+	}
+	return "application/pdf"
+}
+
+// saveUpload saves the bundle and PDFs of a patch request to a new workspace
+// The bundle is checked to be safe to unpack (see manifest.UnpackBundle) before it is used.
+// The returned status code is the one to respond with if err is not nil, in which case nothing is left behind.
+func saveUpload(r *http.Request, config Config) (upload patchUpload, statusCode int, err error) {
+	var (
+		pdfFilesHeaders   []*multipart.FileHeader
+		bundleFileHeaders []*multipart.FileHeader
+	)
+
+	err = r.ParseMultipartForm(10 << 20) // use max 10mb of memory for upload
+	if err != nil {
+		return upload, http.StatusBadRequest, err
+	}
+
+	upload.cssName = r.FormValue("cssName")
+	if upload.cssName == "" {
+		return upload, http.StatusBadRequest, fmt.Errorf("Missing \"cssName\" field")
+	}
+
+	upload.options.Extractor = r.FormValue("extractor")
+	upload.options.Renderer = config.Renderer
+	upload.options.Format = r.FormValue("format")
+	if upload.options.Format != "" && upload.options.Format != pdfpatch.FormatPDF && upload.options.Format != pdfpatch.FormatEPUB {
+		return upload, http.StatusBadRequest, fmt.Errorf("\"format\" must be one of %v", pdfpatch.Formats)
+	}
+	upload.options.AllowRejectedHunks = r.FormValue("allowRejected") == "true"
+	upload.options.KeepWorkDir = config.KeepWorkDir
+	upload.options.Cache = config.Cache
+
+	pdfFilesHeaders = r.MultipartForm.File["pdfs"]
+	sourceReferences := r.MultipartForm.Value["sources"]
+	if pdfFilesHeaders == nil && sourceReferences == nil {
+		return upload, http.StatusBadRequest, fmt.Errorf("Missing \"pdfs\" files field (or \"sources\" referring to stored PDFs)")
+	}
+
+	bundleFileHeaders = r.MultipartForm.File["bundle"]
+	if bundleFileHeaders == nil || len(bundleFileHeaders) == 0 {
+		return upload, http.StatusBadRequest, fmt.Errorf("Missing \"bundle\" file field")
+	}
+
+	upload.workspace, err = workspace.New("bundle-assets-", config.KeepWorkDir)
+	if err != nil {
+		return upload, http.StatusInternalServerError, err
+	}
+	defer func() {
+		if err != nil {
+			upload.Close()
+		}
+	}()
+
+	upload.pdfsDir, err = upload.workspace.Mkdir("pdfs")
+	if err != nil {
+		return upload, http.StatusInternalServerError, err
+	}
+
+	for _, pdfFileHeader := range pdfFilesHeaders {
+		pdfPath := path.Join(upload.pdfsDir, pdfFileHeader.Filename)
+		err = saveUploadedFile(pdfFileHeader, pdfPath)
+		if err != nil {
+			return upload, http.StatusInternalServerError, err
+		}
+		if config.Sources != nil {
+			storeSource(config.Sources, pdfPath)
+		}
+	}
+	for _, reference := range sourceReferences {
+		statusCode, err = copyStoredSource(config.Sources, reference, upload.pdfsDir)
+		if err != nil {
+			return upload, statusCode, err
+		}
+	}
+	log.Printf("pdfs written to %s", upload.pdfsDir)
+
+	upload.bundleFilePath = upload.workspace.Path(bundleFileHeaders[0].Filename)
+	err = saveUploadedFile(bundleFileHeaders[0], upload.bundleFilePath)
+	if err != nil {
+		return upload, http.StatusInternalServerError, err
+	}
+	log.Printf("bundle written to %s", upload.bundleFilePath)
+
+	err = manifest.VerifyBundle(upload.bundleFilePath, manifest.DefaultBundleLimits)
+	if err != nil {
+		return upload, http.StatusBadRequest, err
+	}
+	return
+}
+
+func saveUploadedFile(fileHeader *multipart.FileHeader, filePath string) (err error) {
+	uploadedFile, err := fileHeader.Open()
+	if err != nil {
+		return
+	}
+	defer uploadedFile.Close()
+
+	savedFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return
+	}
+	defer savedFile.Close()
+
+	_, err = io.Copy(savedFile, uploadedFile)
+	return
+}
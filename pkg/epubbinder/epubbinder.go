@@ -0,0 +1,335 @@
+package epubbinder
+
+import (
+	"archive/zip"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Options configures the package document of the EPUB
+// Title is the title of the book (default: Untitled)
+// Language is the language of the book as a BCP 47 tag (default: en)
+// Identifier identifies the book, like an ISBN or a URN (default: a new random UUID URN)
+// Subtitle, Authors, Publisher, Rights and Description (optional) are written into the package metadata
+type Options struct {
+	Title       string
+	Language    string
+	Identifier  string
+	Subtitle    string
+	Authors     []string
+	Publisher   string
+	Rights      string
+	Description string
+}
+
+// chapter is the XHTML document made from one markdown file
+type chapter struct {
+	ID       string
+	FileName string
+	Title    string
+	Body     string
+	Pages    []pageBreak
+}
+
+// pageBreak is where a numbered page of the printed book starts in a chapter
+type pageBreak struct {
+	ID     string
+	Number string
+}
+
+// markdownFilePrefix matches the order prefix of the markdown files written by pdfpatch like "0001_"
+var markdownFilePrefix = regexp.MustCompile(`^\d+_`)
+
+// BindEpub writes the markdown files in inputFolder into an EPUB 3 book styled with the CSS file
+// Each markdown file becomes one XHTML document of the book in the order of the file names
+// (the same order BindPdf uses) and is listed in the table of contents by its first heading,
+// or by its file name if it has no heading. "PAGE x" lines become page breaks in the page list.
+func BindEpub(inputFolder string, inputCSSFile string, outputEPUBPath string, options Options) (err error) {
+	if options.Title == "" {
+		options.Title = "Untitled"
+	}
+	if options.Language == "" {
+		options.Language = "en"
+	}
+
+	css, err := ioutil.ReadFile(inputCSSFile)
+	if err != nil {
+		return
+	}
+	chapters, err := readChapters(inputFolder)
+	if err != nil {
+		return
+	}
+	if len(chapters) == 0 {
+		return fmt.Errorf("no markdown files in %s", inputFolder)
+	}
+
+	outputFile, err := os.OpenFile(outputEPUBPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return
+	}
+	defer outputFile.Close()
+	err = writeEpub(outputFile, chapters, string(css), options)
+	if err != nil {
+		return
+	}
+	return outputFile.Close()
+}
+
+func readChapters(inputFolder string) (chapters []chapter, err error) {
+	err = filepath.Walk(inputFolder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".md" {
+			return nil
+		}
+		markdown, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		theChapter, err := makeChapter(len(chapters)+1, info.Name(), string(markdown))
+		if err != nil {
+			return fmt.Errorf("%s: %v", info.Name(), err)
+		}
+		chapters = append(chapters, theChapter)
+		return nil
+	})
+	return
+}
+
+func makeChapter(number int, markdownFileName string, markdown string) (theChapter chapter, err error) {
+	theChapter = chapter{
+		ID:       fmt.Sprintf("chapter-%04d", number),
+		FileName: fmt.Sprintf("chapter-%04d.xhtml", number),
+	}
+	var body strings.Builder
+	for _, page := range splitPages(markdown) {
+		xhtml, heading, err := markdownToXHTML(page.Markdown)
+		if err != nil {
+			return theChapter, err
+		}
+		if theChapter.Title == "" {
+			theChapter.Title = heading
+		}
+		if page.Number == "" {
+			body.WriteString(xhtml)
+			continue
+		}
+		pageID := fmt.Sprintf("%s-page-%d", theChapter.ID, len(theChapter.Pages)+1)
+		theChapter.Pages = append(theChapter.Pages, pageBreak{ID: pageID, Number: page.Number})
+		fmt.Fprintf(&body, `<section data-page-number="%s"><span epub:type="pagebreak" role="doc-pagebreak" id="%s" title="%s"/>%s</section>`,
+			escapeAttr(page.Number), pageID, escapeAttr(page.Number), xhtml)
+	}
+	theChapter.Body = body.String()
+	if theChapter.Title == "" {
+		theChapter.Title = strings.TrimSuffix(markdownFilePrefix.ReplaceAllString(markdownFileName, ""), ".md")
+	}
+	return
+}
+
+// book is the data for the templates of the package document and navigation document
+type book struct {
+	Identifier  string
+	Title       string
+	Subtitle    string
+	Authors     []string
+	Language    string
+	Publisher   string
+	Rights      string
+	Description string
+	Modified    string
+	CSS         string
+	Chapters    []chapter
+}
+
+// HasPages reports whether any chapter has numbered pages for the page list
+func (theBook book) HasPages() bool {
+	for _, theChapter := range theBook.Chapters {
+		if len(theChapter.Pages) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func writeEpub(w io.Writer, chapters []chapter, css string, options Options) (err error) {
+	identifier := options.Identifier
+	if identifier == "" {
+		identifier, err = newUUID()
+		if err != nil {
+			return
+		}
+	}
+	theBook := book{
+		Identifier:  identifier,
+		Title:       options.Title,
+		Subtitle:    options.Subtitle,
+		Authors:     options.Authors,
+		Language:    options.Language,
+		Publisher:   options.Publisher,
+		Rights:      options.Rights,
+		Description: options.Description,
+		Modified:    time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		CSS:         css,
+		Chapters:    chapters,
+	}
+
+	archive := zip.NewWriter(w)
+	// the mimetype must be the first file and must not be compressed or have an extra field, so it has
+	// no modification time (which archive/zip writes as an extended timestamp extra field)
+	mimetype, err := archive.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return
+	}
+	_, err = io.WriteString(mimetype, "application/epub+zip")
+	if err != nil {
+		return
+	}
+
+	files := []struct {
+		name     string
+		template *template.Template
+		data     interface{}
+	}{
+		{"META-INF/container.xml", containerTemplate, theBook},
+		{"EPUB/package.opf", packageTemplate, theBook},
+		{"EPUB/nav.xhtml", navTemplate, theBook},
+		{"EPUB/style.css", cssTemplate, theBook},
+	}
+	for _, file := range files {
+		err = writeTemplate(archive, file.name, file.template, file.data)
+		if err != nil {
+			return
+		}
+	}
+	for _, theChapter := range chapters {
+		err = writeTemplate(archive, "EPUB/"+theChapter.FileName, chapterTemplate, struct {
+			Book    book
+			Chapter chapter
+		}{theBook, theChapter})
+		if err != nil {
+			return
+		}
+	}
+	return archive.Close()
+}
+
+func writeTemplate(archive *zip.Writer, name string, fileTemplate *template.Template, data interface{}) (err error) {
+	file, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return
+	}
+	return fileTemplate.Execute(file, data)
+}
+
+// newUUID returns a random (version 4) UUID URN to identify the book
+func newUUID() (string, error) {
+	uuid := make([]byte, 16)
+	_, err := rand.Read(uuid)
+	if err != nil {
+		return "", err
+	}
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:]), nil
+}
+
+var containerTemplate = template.Must(template.New("container").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="EPUB/package.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`))
+
+var packageTemplate = template.Must(template.New("package").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="{{.Language | html}}">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">{{.Identifier | html}}</dc:identifier>
+    <dc:title>{{.Title | html}}</dc:title>
+{{- if .Subtitle}}
+    <dc:title id="subtitle">{{.Subtitle | html}}</dc:title>
+    <meta refines="#subtitle" property="title-type">subtitle</meta>
+{{- end}}
+{{- range $i, $author := .Authors}}
+    <dc:creator id="creator-{{$i}}">{{$author | html}}</dc:creator>
+    <meta refines="#creator-{{$i}}" property="role" scheme="marc:relators">aut</meta>
+{{- end}}
+    <dc:language>{{.Language | html}}</dc:language>
+{{- if .Publisher}}
+    <dc:publisher>{{.Publisher | html}}</dc:publisher>
+{{- end}}
+{{- if .Rights}}
+    <dc:rights>{{.Rights | html}}</dc:rights>
+{{- end}}
+{{- if .Description}}
+    <dc:description>{{.Description | html}}</dc:description>
+{{- end}}
+    <meta property="dcterms:modified">{{.Modified}}</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="style" href="style.css" media-type="text/css"/>
+{{- range .Chapters}}
+    <item id="{{.ID}}" href="{{.FileName}}" media-type="application/xhtml+xml"/>
+{{- end}}
+  </manifest>
+  <spine>
+{{- range .Chapters}}
+    <itemref idref="{{.ID}}"/>
+{{- end}}
+  </spine>
+</package>
+`))
+
+var navTemplate = template.Must(template.New("nav").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="{{.Language | html}}" lang="{{.Language | html}}">
+<head>
+  <title>{{.Title | html}}</title>
+</head>
+<body>
+  <nav epub:type="toc" id="toc">
+    <h1>{{.Title | html}}</h1>
+    <ol>
+{{- range .Chapters}}
+      <li><a href="{{.FileName}}">{{.Title | html}}</a></li>
+{{- end}}
+    </ol>
+  </nav>
+{{- if .HasPages}}
+  <nav epub:type="page-list" id="page-list" hidden="hidden">
+    <ol>
+{{- range $chapter := .Chapters}}{{range .Pages}}
+      <li><a href="{{$chapter.FileName}}#{{.ID}}">{{.Number | html}}</a></li>
+{{- end}}{{end}}
+    </ol>
+  </nav>
+{{- end}}
+</body>
+</html>
+`))
+
+var cssTemplate = template.Must(template.New("css").Parse(`{{.CSS}}`))
+
+var chapterTemplate = template.Must(template.New("chapter").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="{{.Book.Language | html}}" lang="{{.Book.Language | html}}">
+<head>
+  <title>{{.Chapter.Title | html}}</title>
+  <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+{{.Chapter.Body}}
+</body>
+</html>
+`))
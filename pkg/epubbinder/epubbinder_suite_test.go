@@ -0,0 +1,13 @@
+package epubbinder_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestEpubbinder(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Epubbinder Suite")
+}
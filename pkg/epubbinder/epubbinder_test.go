@@ -0,0 +1,179 @@
+package epubbinder_test
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/motevets/pdfpatch/pkg/epubbinder"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BindEpub", func() {
+	const cssPath = "../../test/fixtures/patch_bundle/css/book.css"
+	var (
+		tempDir    string
+		outputPath string
+		err        error
+	)
+
+	BeforeEach(func() {
+		tempDir, err = ioutil.TempDir("", "epubbinder_test")
+		Expect(err).NotTo(HaveOccurred())
+		outputPath = path.Join(tempDir, "book.epub")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tempDir)
+	})
+
+	When("binding the markdowns of a book", func() {
+		var files map[string]string
+
+		BeforeEach(func() {
+			err = epubbinder.BindEpub("../../test/fixtures/multiple_patches/markdowns", cssPath, outputPath, epubbinder.Options{Title: "Big & Book"})
+			Expect(err).NotTo(HaveOccurred())
+			files = readEpub(outputPath)
+		})
+
+		It("starts with the uncompressed mimetype", func() {
+			reader, err := zip.OpenReader(outputPath)
+			Expect(err).NotTo(HaveOccurred())
+			defer reader.Close()
+			Expect(reader.File[0].Name).To(Equal("mimetype"))
+			Expect(reader.File[0].Method).To(Equal(zip.Store))
+			Expect(files["mimetype"]).To(Equal("application/epub+zip"))
+		})
+
+		It("writes the mimetype without an extra field", func() {
+			reader, err := zip.OpenReader(outputPath)
+			Expect(err).NotTo(HaveOccurred())
+			defer reader.Close()
+			Expect(reader.File[0].Extra).To(BeEmpty())
+
+			// the extra field length of the local header of the first file
+			epub, err := ioutil.ReadFile(outputPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(binary.LittleEndian.Uint16(epub[28:30])).To(BeZero())
+		})
+
+		It("points the container at the package document", func() {
+			Expect(files["META-INF/container.xml"]).To(ContainSubstring(`full-path="EPUB/package.opf"`))
+		})
+
+		It("writes well formed XML documents", func() {
+			for _, name := range []string{"META-INF/container.xml", "EPUB/package.opf", "EPUB/nav.xhtml", "EPUB/chapter-0001.xhtml", "EPUB/chapter-0002.xhtml", "EPUB/chapter-0003.xhtml"} {
+				Expect(isWellFormed(files[name])).To(Succeed(), name)
+			}
+		})
+
+		It("has one chapter for each markdown file in order of the file names", func() {
+			opf := files["EPUB/package.opf"]
+			Expect(opf).To(ContainSubstring("<dc:title>Big &amp; Book</dc:title>"))
+			Expect(opf).To(ContainSubstring("<dc:language>en</dc:language>"))
+			Expect(opf).To(MatchRegexp(`(?s)<spine>\s*<itemref idref="chapter-0001"/>\s*<itemref idref="chapter-0002"/>\s*<itemref idref="chapter-0003"/>\s*</spine>`))
+			Expect(files["EPUB/chapter-0001.xhtml"]).To(ContainSubstring("<p>This is chapter 1.</p>"))
+			Expect(files["EPUB/chapter-0002.xhtml"]).To(ContainSubstring("<p>Dedicated to my fellows.</p>"))
+			Expect(files["EPUB/chapter-0003.xhtml"]).To(ContainSubstring("<p>NEW TITLE PAGE</p>"))
+		})
+
+		It("lists the chapters and pages in the navigation document", func() {
+			nav := files["EPUB/nav.xhtml"]
+			Expect(nav).To(ContainSubstring(`<li><a href="chapter-0001.xhtml">chapter_1</a></li>`))
+			Expect(nav).To(ContainSubstring(`<li><a href="chapter-0002.xhtml">dedication</a></li>`))
+			Expect(nav).To(ContainSubstring(`<li><a href="chapter-0001.xhtml#chapter-0001-page-1">3</a></li>`))
+			Expect(files["EPUB/chapter-0001.xhtml"]).To(ContainSubstring(`<section data-page-number="3"><span epub:type="pagebreak" role="doc-pagebreak" id="chapter-0001-page-1" title="3"/>`))
+		})
+
+		It("includes the style sheet", func() {
+			css, err := ioutil.ReadFile(cssPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files["EPUB/style.css"]).To(Equal(string(css)))
+		})
+	})
+
+	When("the book has metadata", func() {
+		It("writes it into the package document", func() {
+			err = epubbinder.BindEpub("../../test/fixtures/multiple_patches/markdowns", cssPath, outputPath, epubbinder.Options{
+				Title:       "Big Book",
+				Subtitle:    "Stories & More",
+				Authors:     []string{"Jane Doe", "John Smith"},
+				Language:    "de",
+				Identifier:  "urn:isbn:9780000000000",
+				Publisher:   "Example Press",
+				Rights:      "Public domain",
+				Description: "A book of stories.",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			opf := readEpub(outputPath)["EPUB/package.opf"]
+			Expect(isWellFormed(opf)).To(Succeed())
+			Expect(opf).To(ContainSubstring(`<dc:identifier id="book-id">urn:isbn:9780000000000</dc:identifier>`))
+			Expect(opf).To(ContainSubstring(`<dc:title id="subtitle">Stories &amp; More</dc:title>`))
+			Expect(opf).To(ContainSubstring(`<dc:creator id="creator-0">Jane Doe</dc:creator>`))
+			Expect(opf).To(ContainSubstring(`<dc:creator id="creator-1">John Smith</dc:creator>`))
+			Expect(opf).To(ContainSubstring(`<dc:language>de</dc:language>`))
+			Expect(opf).To(ContainSubstring(`<dc:publisher>Example Press</dc:publisher>`))
+			Expect(opf).To(ContainSubstring(`<dc:rights>Public domain</dc:rights>`))
+			Expect(opf).To(ContainSubstring(`<dc:description>A book of stories.</dc:description>`))
+		})
+	})
+
+	When("a markdown file has a heading and HTML", func() {
+		BeforeEach(func() {
+			markdown := "# It's \"Bill's Story\"\n\nWe & they&nbsp;agreed<br>\n\n    indented\n"
+			Expect(ioutil.WriteFile(path.Join(tempDir, "0000_story.pdf.md"), []byte(markdown), 0644)).To(Succeed())
+			err = epubbinder.BindEpub(tempDir, cssPath, outputPath, epubbinder.Options{})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("titles the chapter by its heading and writes well formed XHTML", func() {
+			files := readEpub(outputPath)
+			Expect(files["EPUB/nav.xhtml"]).To(ContainSubstring(`<a href="chapter-0001.xhtml">It&#39;s &#34;Bill&#39;s Story&#34;</a>`))
+			Expect(files["EPUB/nav.xhtml"]).NotTo(ContainSubstring("page-list"))
+			Expect(isWellFormed(files["EPUB/chapter-0001.xhtml"])).To(Succeed())
+			Expect(files["EPUB/chapter-0001.xhtml"]).To(ContainSubstring("<br/>"))
+		})
+	})
+
+	When("there are no markdown files", func() {
+		It("returns an error", func() {
+			err = epubbinder.BindEpub(tempDir, cssPath, outputPath, epubbinder.Options{})
+			Expect(err).To(MatchError("no markdown files in " + tempDir))
+		})
+	})
+})
+
+func readEpub(epubPath string) map[string]string {
+	reader, err := zip.OpenReader(epubPath)
+	Expect(err).NotTo(HaveOccurred())
+	defer reader.Close()
+	files := map[string]string{}
+	for _, file := range reader.File {
+		contents, err := file.Open()
+		Expect(err).NotTo(HaveOccurred())
+		data, err := ioutil.ReadAll(contents)
+		Expect(err).NotTo(HaveOccurred())
+		contents.Close()
+		files[file.Name] = string(data)
+	}
+	return files
+}
+
+func isWellFormed(document string) error {
+	decoder := xml.NewDecoder(strings.NewReader(document))
+	decoder.Strict = true
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package epubbinder
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/gomarkdown/markdown"
+	htmlrenderer "github.com/gomarkdown/markdown/html"
+	"github.com/gomarkdown/markdown/parser"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// voidElements are the elements written as empty XML tags
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+)
+
+// markdownPage is the markdown of a page of the book numbered by a "PAGE x" line
+// Number is empty for text before the first "PAGE x" line.
+type markdownPage struct {
+	Number   string
+	Markdown string
+}
+
+// splitPages divides markdown into pages at each "PAGE x" line, like alcobinder does for PDFs
+func splitPages(markdown string) (pages []markdownPage) {
+	page := markdownPage{}
+	for _, line := range strings.Split(markdown, "\n") {
+		if strings.HasPrefix(line, "PAGE ") {
+			if strings.TrimSpace(page.Markdown) != "" || page.Number != "" {
+				pages = append(pages, page)
+			}
+			page = markdownPage{Number: strings.TrimSpace(line[5:])}
+			continue
+		}
+		page.Markdown += line + "\n"
+	}
+	if strings.TrimSpace(page.Markdown) != "" || page.Number != "" {
+		pages = append(pages, page)
+	}
+	return
+}
+
+// markdownToXHTML renders markdown with the same extensions and paragraph classes alcobinder uses
+// and serializes it as XHTML (entities are replaced by characters and empty elements are closed)
+// heading is the text of the first heading, if there is one.
+func markdownToXHTML(md string) (xhtml string, heading string, err error) {
+	renderer := htmlrenderer.NewRenderer(htmlrenderer.RendererOptions{Flags: htmlrenderer.UseXHTML})
+	extensions := parser.Attributes | parser.Tables | parser.OrderedListStart
+	rendered := markdown.ToHTML([]byte(decorateWithClasses(md)), parser.NewWithExtensions(extensions), renderer)
+
+	nodes, err := html.ParseFragment(bytes.NewReader(rendered), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+	if err != nil {
+		return
+	}
+	var builder strings.Builder
+	for _, node := range nodes {
+		err = writeXHTML(&builder, node)
+		if err != nil {
+			return
+		}
+	}
+	return builder.String(), firstHeading(nodes), nil
+}
+
+// decorateWithClasses marks indented paragraphs and footnotes so book style sheets apply to them
+func decorateWithClasses(pageText string) string {
+	var paragraphs []string
+	for _, paragraph := range strings.Split(pageText, "\n\n") {
+		paragraph = strings.Trim(paragraph, "\n")
+		if strings.HasPrefix(paragraph, " ") {
+			paragraph = "{.indented}\n" + paragraph
+		} else if strings.HasPrefix(paragraph, "\\*") {
+			paragraph = "{.footnote}\n" + paragraph
+		}
+		paragraphs = append(paragraphs, paragraph)
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
+
+func writeXHTML(builder *strings.Builder, node *html.Node) (err error) {
+	switch node.Type {
+	case html.TextNode:
+		builder.WriteString(textEscaper.Replace(node.Data))
+	case html.ElementNode:
+		builder.WriteString("<" + node.Data)
+		for _, attr := range node.Attr {
+			fmt.Fprintf(builder, ` %s="%s"`, attr.Key, escapeAttr(attr.Val))
+		}
+		if node.FirstChild == nil && voidElements[node.Data] {
+			builder.WriteString("/>")
+			return
+		}
+		builder.WriteString(">")
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			err = writeXHTML(builder, child)
+			if err != nil {
+				return
+			}
+		}
+		builder.WriteString("</" + node.Data + ">")
+	}
+	return
+}
+
+func escapeAttr(value string) string {
+	return attrEscaper.Replace(value)
+}
+
+// firstHeading returns the text of the first h1, h2 or h3 element
+func firstHeading(nodes []*html.Node) string {
+	for _, node := range nodes {
+		if node.Type == html.ElementNode && (node.DataAtom == atom.H1 || node.DataAtom == atom.H2 || node.DataAtom == atom.H3) {
+			return strings.TrimSpace(textContent(node))
+		}
+		if heading := firstHeading(children(node)); heading != "" {
+			return heading
+		}
+	}
+	return ""
+}
+
+func children(node *html.Node) (nodes []*html.Node) {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		nodes = append(nodes, child)
+	}
+	return
+}
+
+func textContent(node *html.Node) string {
+	if node.Type == html.TextNode {
+		return node.Data
+	}
+	var builder strings.Builder
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		builder.WriteString(textContent(child))
+	}
+	return builder.String()
+}
@@ -0,0 +1,251 @@
+package extractor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheMaxSize is the most bytes of extracted text kept by a cache unless it is given another size
+const DefaultCacheMaxSize = 256 << 20
+
+// cacheEntryExtension is the extension of the files holding the cached text of each PDF
+const cacheEntryExtension = ".json"
+
+// Cache stores the text extracted from PDFs on disk so the same PDF is only extracted once
+//
+// Entries are keyed by the sha256 of the PDF along with the name and version of the extractor,
+// so changing either the PDF or the extractor misses the cache. Once the entries take more than
+// MaxSize bytes the least recently used are removed (MaxSize 0 keeps everything).
+type Cache struct {
+	Dir     string
+	MaxSize int64
+
+	mutex sync.Mutex
+}
+
+// CacheStats describes the contents of a cache
+type CacheStats struct {
+	Dir     string
+	Entries int
+	Size    int64
+}
+
+// cacheEntry is the text of a PDF as extracted by TextFromPDF or PagesFromPDF
+type cacheEntry struct {
+	Text  string `json:"text,omitempty"`
+	Pages []Page `json:"pages,omitempty"`
+}
+
+// DefaultCacheDir returns the directory of the cache in the user's cache directory
+func DefaultCacheDir() (dir string, err error) {
+	dir, err = os.UserCacheDir()
+	if err != nil {
+		return
+	}
+	return filepath.Join(dir, "pdfpatch", "extracted"), nil
+}
+
+// NewCache returns a cache in dir, creating it if needed
+func NewCache(dir string, maxSize int64) (cache *Cache, err error) {
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return
+	}
+	return &Cache{Dir: dir, MaxSize: maxSize}, nil
+}
+
+// Stats counts the entries in the cache and their size
+func (cache *Cache) Stats() (stats CacheStats, err error) {
+	entries, err := cache.entries()
+	if err != nil {
+		return
+	}
+	stats = CacheStats{Dir: cache.Dir, Entries: len(entries)}
+	for _, entry := range entries {
+		stats.Size += entry.Size()
+	}
+	return
+}
+
+// Prune removes the least recently used entries until they take at most maxSize bytes
+func (cache *Cache) Prune(maxSize int64) (removed int, err error) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	entries, err := cache.entries()
+	if err != nil {
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ModTime().After(entries[j].ModTime())
+	})
+	var size int64
+	for _, entry := range entries {
+		size += entry.Size()
+		if size <= maxSize {
+			continue
+		}
+		err = os.Remove(filepath.Join(cache.Dir, entry.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			return
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Clear removes every entry from the cache
+func (cache *Cache) Clear() (err error) {
+	_, err = cache.Prune(0)
+	return
+}
+
+func (cache *Cache) entries() (entries []os.FileInfo, err error) {
+	files, err := ioutil.ReadDir(cache.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		if file.Mode().IsRegular() && strings.HasSuffix(file.Name(), cacheEntryExtension) {
+			entries = append(entries, file)
+		}
+	}
+	return
+}
+
+// get reads the entry with key, marking it as recently used
+func (cache *Cache) get(key string) (entry cacheEntry, found bool) {
+	entryPath := filepath.Join(cache.Dir, key+cacheEntryExtension)
+	data, err := ioutil.ReadFile(entryPath)
+	if err != nil {
+		return
+	}
+	if json.Unmarshal(data, &entry) != nil {
+		return
+	}
+	now := time.Now()
+	os.Chtimes(entryPath, now, now)
+	return entry, true
+}
+
+// put writes the entry with key, then evicts entries if the cache is over its size
+func (cache *Cache) put(key string, entry cacheEntry) (err error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	tempFile, err := ioutil.TempFile(cache.Dir, key+"-*.tmp")
+	if err != nil {
+		return
+	}
+	_, err = tempFile.Write(data)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), filepath.Join(cache.Dir, key+cacheEntryExtension))
+	}
+	if err != nil {
+		os.Remove(tempFile.Name())
+		return
+	}
+	if cache.MaxSize > 0 {
+		_, err = cache.Prune(cache.MaxSize)
+	}
+	return
+}
+
+// Cached returns an extractor that looks up the text of PDFs in the cache before extracting it with extractor
+// Failures to read or write the cache are logged and the text is extracted as if there were no cache.
+func Cached(extractor Extractor, cache *Cache) Extractor {
+	if cache == nil {
+		return extractor
+	}
+	return cachedExtractor{Extractor: extractor, cache: cache}
+}
+
+type cachedExtractor struct {
+	Extractor
+	cache *Cache
+}
+
+func (extractor cachedExtractor) TextFromPDF(path string) (string, error) {
+	return extractor.TextFromPDFContext(context.Background(), path)
+}
+
+func (extractor cachedExtractor) TextFromPDFContext(ctx context.Context, path string) (text string, err error) {
+	key, err := extractor.key(path, "text")
+	if err != nil {
+		return
+	}
+	if entry, found := extractor.cache.get(key); found {
+		return entry.Text, nil
+	}
+	text, err = TextFromPDFContext(ctx, extractor.Extractor, path)
+	if err != nil {
+		return
+	}
+	extractor.put(key, cacheEntry{Text: text})
+	return
+}
+
+func (extractor cachedExtractor) PagesFromPDF(path string) ([]Page, error) {
+	return extractor.PagesFromPDFContext(context.Background(), path)
+}
+
+func (extractor cachedExtractor) PagesFromPDFContext(ctx context.Context, path string) (pages []Page, err error) {
+	key, err := extractor.key(path, "pages")
+	if err != nil {
+		return
+	}
+	if entry, found := extractor.cache.get(key); found {
+		return entry.Pages, nil
+	}
+	pages, err = PagesFromPDFContext(ctx, extractor.Extractor, path)
+	if err != nil {
+		return
+	}
+	extractor.put(key, cacheEntry{Pages: pages})
+	return
+}
+
+func (extractor cachedExtractor) put(key string, entry cacheEntry) {
+	err := extractor.cache.put(key, entry)
+	if err != nil {
+		log.Println("WARNING: could not cache extracted text:", err)
+	}
+}
+
+// key identifies the text extracted from the PDF at path by the extractor in the way named by kind
+func (extractor cachedExtractor) key(path string, kind string) (key string, err error) {
+	pdfFile, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer pdfFile.Close()
+	pdfHash := sha256.New()
+	_, err = io.Copy(pdfHash, pdfFile)
+	if err != nil {
+		return
+	}
+	keyHash := sha256.New()
+	keyHash.Write(pdfHash.Sum(nil))
+	for _, part := range []string{extractor.Name(), extractor.Version(), kind} {
+		keyHash.Write([]byte{0})
+		keyHash.Write([]byte(part))
+	}
+	return hex.EncodeToString(keyHash.Sum(nil)), nil
+}
@@ -0,0 +1,126 @@
+package extractor_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/motevets/pdfpatch/pkg/extractor"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// countingExtractor extracts text with GoPDF, counting how many times it is called
+type countingExtractor struct {
+	goPDF   extractor.GoPDF
+	version string
+	calls   *int
+}
+
+func (e countingExtractor) Name() string {
+	return e.goPDF.Name()
+}
+
+func (e countingExtractor) Version() string {
+	return e.version
+}
+
+func (e countingExtractor) TextFromPDF(path string) (string, error) {
+	*e.calls++
+	return e.goPDF.TextFromPDF(path)
+}
+
+func (e countingExtractor) PagesFromPDF(path string) ([]extractor.Page, error) {
+	*e.calls++
+	return e.goPDF.PagesFromPDF(path)
+}
+
+var _ = Describe("Cache", func() {
+	const pdfPath = "../../test/fixtures/one_pdf_two_markdowns/original.pdf"
+	var (
+		cacheDir string
+		cache    *extractor.Cache
+		calls    int
+		counting countingExtractor
+	)
+
+	BeforeEach(func() {
+		var err error
+		cacheDir, err = ioutil.TempDir("", "extractor_cache")
+		Expect(err).NotTo(HaveOccurred())
+		cache, err = extractor.NewCache(path.Join(cacheDir, "extracted"), 0)
+		Expect(err).NotTo(HaveOccurred())
+		calls = 0
+		counting = countingExtractor{version: "1", calls: &calls}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(cacheDir)
+	})
+
+	It("extracts the text of a PDF once", func() {
+		cached := extractor.Cached(counting, cache)
+		for i := 0; i < 2; i++ {
+			text, err := cached.TextFromPDF(pdfPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(text).To(Equal("Hello from chapter 1. Hallo von Kapitel 2. "))
+			pages, err := cached.PagesFromPDF(pdfPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pages).To(Equal([]extractor.Page{
+				{Number: 1, Text: "Hello from chapter 1. "},
+				{Number: 2, Text: "Hallo von Kapitel 2. "},
+			}))
+		}
+		Expect(calls).To(Equal(2))
+		Expect(cached.Name()).To(Equal("gopdf"))
+	})
+
+	It("extracts the text again with another version of the extractor", func() {
+		_, err := extractor.Cached(counting, cache).TextFromPDF(pdfPath)
+		Expect(err).NotTo(HaveOccurred())
+		counting.version = "2"
+		_, err = extractor.Cached(counting, cache).TextFromPDF(pdfPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(calls).To(Equal(2))
+	})
+
+	It("counts, prunes and clears its entries", func() {
+		cached := extractor.Cached(counting, cache)
+		_, err := cached.TextFromPDF(pdfPath)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cached.PagesFromPDF(pdfPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		stats, err := cache.Stats()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.Entries).To(Equal(2))
+		Expect(stats.Size).To(BeNumerically(">", 0))
+
+		removed, err := cache.Prune(stats.Size)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removed).To(Equal(0))
+		removed, err = cache.Prune(stats.Size - 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removed).To(Equal(1))
+
+		Expect(cache.Clear()).To(Succeed())
+		stats, err = cache.Stats()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.Entries).To(Equal(0))
+	})
+
+	It("evicts entries once it is over its size", func() {
+		cache.MaxSize = 1
+		_, err := extractor.Cached(counting, cache).TextFromPDF(pdfPath)
+		Expect(err).NotTo(HaveOccurred())
+		stats, err := cache.Stats()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.Entries).To(Equal(0))
+	})
+
+	When("there is no cache", func() {
+		It("returns the extractor", func() {
+			Expect(extractor.Cached(extractor.GoPDF{}, nil)).To(Equal(extractor.GoPDF{}))
+		})
+	})
+})
@@ -0,0 +1,107 @@
+package extractor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultName is the name of the extractor used when none is chosen
+const DefaultName = "pdftotext"
+
+// Extractor extracts the text from a PDF
+//
+// Patches only apply against the exact text that the extractor used to generate them
+// produces, so Name and Version identify that text and are recorded in manifests.
+// TextFromPDF returns the whole PDF on a single line while PagesFromPDF returns the
+// text of each page separately (also without newlines).
+type Extractor interface {
+	Name() string
+	Version() string
+	TextFromPDF(path string) (string, error)
+	PagesFromPDF(path string) ([]Page, error)
+}
+
+// ContextExtractor is an Extractor that stops extracting once a context is done
+// Both extractors implement it, see TextFromPDFContext and PagesFromPDFContext.
+type ContextExtractor interface {
+	Extractor
+	TextFromPDFContext(ctx context.Context, path string) (string, error)
+	PagesFromPDFContext(ctx context.Context, path string) ([]Page, error)
+}
+
+// TextFromPDFContext extracts the text of a PDF with the extractor, stopping once ctx is done
+// Extractors that do not implement ContextExtractor only have ctx checked before they start.
+func TextFromPDFContext(ctx context.Context, extractor Extractor, path string) (string, error) {
+	if contextExtractor, ok := extractor.(ContextExtractor); ok {
+		return contextExtractor.TextFromPDFContext(ctx, path)
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return extractor.TextFromPDF(path)
+}
+
+// PagesFromPDFContext extracts the text of each page of a PDF with the extractor, stopping once ctx is done
+// Extractors that do not implement ContextExtractor only have ctx checked before they start.
+func PagesFromPDFContext(ctx context.Context, extractor Extractor, path string) ([]Page, error) {
+	if contextExtractor, ok := extractor.(ContextExtractor); ok {
+		return contextExtractor.PagesFromPDFContext(ctx, path)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return extractor.PagesFromPDF(path)
+}
+
+// contextErr returns the error of ctx if it is done, since that is why a command was killed, otherwise err
+func contextErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// Page is the text of a single page of a PDF
+// Number is the 1-based page number in the PDF
+type Page struct {
+	Number int
+	Text   string
+}
+
+// JoinPages concatenates the text of pages
+func JoinPages(pages []Page) string {
+	var builder strings.Builder
+	for _, page := range pages {
+		builder.WriteString(page.Text)
+	}
+	return builder.String()
+}
+
+var extractors = map[string]Extractor{
+	"pdftotext": Pdftotext{},
+	"gopdf":     GoPDF{},
+}
+
+// New returns the extractor with the given name
+// An empty name returns the default extractor.
+func New(name string) (Extractor, error) {
+	if name == "" {
+		name = DefaultName
+	}
+	extractor, ok := extractors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown extractor %q (must be one of %v)", name, Names())
+	}
+	return extractor, nil
+}
+
+// Names returns the names of the available extractors
+func Names() (names []string) {
+	for name := range extractors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
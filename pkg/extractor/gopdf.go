@@ -0,0 +1,72 @@
+package extractor
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// goPDFVersion identifies the ledongthuc/pdf release and the way its output is joined into text
+const goPDFVersion = "ledongthuc-pdf-20200323.1"
+
+// GoPDF extracts text with the pure Go ledongthuc/pdf library so no external tools are required
+type GoPDF struct{}
+
+// Name returns "gopdf"
+func (GoPDF) Name() string {
+	return "gopdf"
+}
+
+// Version returns the version of the library and text layout used by the extractor
+func (GoPDF) Version() string {
+	return goPDFVersion
+}
+
+// TextFromPDF returns the text of the PDF at path on a single line
+func (extractor GoPDF) TextFromPDF(path string) (text string, err error) {
+	return extractor.TextFromPDFContext(context.Background(), path)
+}
+
+// TextFromPDFContext is TextFromPDF stopping between pages if ctx is done
+func (extractor GoPDF) TextFromPDFContext(ctx context.Context, path string) (text string, err error) {
+	pages, err := extractor.PagesFromPDFContext(ctx, path)
+	if err != nil {
+		return
+	}
+	text = JoinPages(pages)
+	return
+}
+
+// PagesFromPDF returns the text of each page of the PDF at path
+// Pages without content are skipped but keep their page numbers.
+func (extractor GoPDF) PagesFromPDF(path string) (pages []Page, err error) {
+	return extractor.PagesFromPDFContext(context.Background(), path)
+}
+
+// PagesFromPDFContext is PagesFromPDF stopping between pages if ctx is done
+func (GoPDF) PagesFromPDFContext(ctx context.Context, path string) (pages []Page, err error) {
+	file, reader, err := pdf.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	for i := 1; i <= reader.NumPage(); i++ {
+		err = ctx.Err()
+		if err != nil {
+			return nil, err
+		}
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		var pageText string
+		pageText, err = page.GetPlainText(nil)
+		if err != nil {
+			return
+		}
+		pages = append(pages, Page{Number: i, Text: strings.ReplaceAll(pageText+"\n", "\n", " ")})
+	}
+	return
+}
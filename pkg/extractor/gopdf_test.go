@@ -0,0 +1,63 @@
+package extractor_test
+
+import (
+	"context"
+
+	"github.com/motevets/pdfpatch/pkg/extractor"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GoPDF", func() {
+	It("returns the text of every page on a single line", func() {
+		text, err := extractor.GoPDF{}.TextFromPDF("../../test/fixtures/one_pdf_two_markdowns/original.pdf")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(text).To(Equal("Hello from chapter 1. Hallo von Kapitel 2. "))
+	})
+
+	It("returns the text of each page with its page number", func() {
+		pages, err := extractor.GoPDF{}.PagesFromPDF("../../test/fixtures/one_pdf_two_markdowns/original.pdf")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pages).To(Equal([]extractor.Page{
+			{Number: 1, Text: "Hello from chapter 1. "},
+			{Number: 2, Text: "Hallo von Kapitel 2. "},
+		}))
+	})
+
+	When("the context is done", func() {
+		It("returns the error of the context", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err := extractor.PagesFromPDFContext(ctx, extractor.GoPDF{}, "../../test/fixtures/one_pdf_two_markdowns/original.pdf")
+			Expect(err).To(MatchError(context.Canceled))
+		})
+	})
+
+	When("the PDF does not exist", func() {
+		It("returns an error", func() {
+			_, err := extractor.GoPDF{}.TextFromPDF("../../test/fixtures/nope.pdf")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
+
+var _ = Describe("New", func() {
+	It("returns the default extractor when no name is given", func() {
+		textExtractor, err := extractor.New("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(textExtractor.Name()).To(Equal(extractor.DefaultName))
+	})
+
+	It("returns the extractor with the given name", func() {
+		textExtractor, err := extractor.New("gopdf")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(textExtractor).To(Equal(extractor.GoPDF{}))
+	})
+
+	When("the extractor does not exist", func() {
+		It("returns an error", func() {
+			_, err := extractor.New("ocr")
+			Expect(err).To(MatchError(`unknown extractor "ocr" (must be one of [gopdf pdftotext])`))
+		})
+	})
+})
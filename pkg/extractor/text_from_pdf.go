@@ -1,10 +1,11 @@
 package extractor
 
 import (
+	"context"
+	"os/exec"
 	"path"
 	"strings"
-
-	"code.sajari.com/docconv"
+	"sync"
 )
 
 func TextFromPDFs(directory string, files []string) (extractedText string, err error) {
@@ -19,11 +20,74 @@ func TextFromPDFs(directory string, files []string) (extractedText string, err e
 	return
 }
 
+// TextFromPDF extracts the text of a PDF with the default extractor
 func TextFromPDF(path string) (string, error) {
-	res, err := docconv.ConvertPath(path)
+	return Pdftotext{}.TextFromPDF(path)
+}
+
+// Pdftotext extracts text by running poppler's pdftotext
+type Pdftotext struct{}
+
+var (
+	pdftotextVersion     string
+	pdftotextVersionOnce sync.Once
+)
+
+// Name returns "pdftotext"
+func (Pdftotext) Name() string {
+	return "pdftotext"
+}
+
+// Version returns the version of the installed pdftotext or "unknown" if it cannot be determined
+func (Pdftotext) Version() string {
+	pdftotextVersionOnce.Do(func() {
+		pdftotextVersion = "unknown"
+		output, _ := exec.Command("pdftotext", "-v").CombinedOutput()
+		for _, line := range strings.Split(string(output), "\n") {
+			if strings.HasPrefix(line, "pdftotext version ") {
+				pdftotextVersion = strings.TrimSpace(strings.TrimPrefix(line, "pdftotext version "))
+				break
+			}
+		}
+	})
+	return pdftotextVersion
+}
+
+// TextFromPDF returns the text of the PDF at path on a single line
+func (extractor Pdftotext) TextFromPDF(path string) (string, error) {
+	return extractor.TextFromPDFContext(context.Background(), path)
+}
+
+// TextFromPDFContext is TextFromPDF killing pdftotext if ctx is done first
+// The arguments and trimming match docconv, which extracted the text of earlier patches.
+func (Pdftotext) TextFromPDFContext(ctx context.Context, path string) (string, error) {
+	output, err := exec.CommandContext(ctx, "pdftotext", "-q", "-nopgbrk", "-enc", "UTF-8", "-eol", "unix", path, "-").Output()
 	if err != nil {
-		return "", err
+		return "", contextErr(ctx, err)
 	}
-	output := strings.ReplaceAll(res.Body, "\n", " ")
-	return output, err
+	return strings.ReplaceAll(strings.TrimSpace(string(output)), "\n", " "), nil
+}
+
+// PagesFromPDF returns the text of each page of the PDF at path
+func (extractor Pdftotext) PagesFromPDF(path string) ([]Page, error) {
+	return extractor.PagesFromPDFContext(context.Background(), path)
+}
+
+// PagesFromPDFContext is PagesFromPDF killing pdftotext if ctx is done first
+// pdftotext separates pages with form feeds.
+func (Pdftotext) PagesFromPDFContext(ctx context.Context, path string) (pages []Page, err error) {
+	output, err := exec.CommandContext(ctx, "pdftotext", "-q", "-enc", "UTF-8", "-eol", "unix", path, "-").Output()
+	if err != nil {
+		err = contextErr(ctx, err)
+		return
+	}
+	pageTexts := strings.Split(string(output), "\f")
+	if len(pageTexts) > 1 && pageTexts[len(pageTexts)-1] == "" {
+		pageTexts = pageTexts[:len(pageTexts)-1]
+	}
+	pages = make([]Page, len(pageTexts))
+	for i, pageText := range pageTexts {
+		pages[i] = Page{Number: i + 1, Text: strings.ReplaceAll(pageText, "\n", " ")}
+	}
+	return
 }
@@ -0,0 +1,290 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/motevets/pdfpatch/pkg/manifest"
+	"github.com/motevets/pdfpatch/pkg/sourcestore"
+)
+
+// DefaultRetries is the number of times a failed download is tried again
+const DefaultRetries = 3
+
+// DefaultRetryDelay is how long the first retry waits, doubling for each one after it
+const DefaultRetryDelay = time.Second
+
+// Status is how a source PDF came to be in the destination directory
+type Status string
+
+// The statuses of fetched sources
+const (
+	// Present is a source that was already in the destination directory
+	Present Status = "present"
+	// Cached is a source copied from the download cache
+	Cached Status = "cached"
+	// Downloaded is a source downloaded from its URL
+	Downloaded Status = "downloaded"
+)
+
+// Result is the outcome of fetching a source PDF
+// Bytes is the size of the source PDF.
+type Result struct {
+	FileName string
+	Status   Status
+	Bytes    int64
+}
+
+// NoURLError is returned for a source that is missing and has no URL to download it from
+type NoURLError struct {
+	FileName string
+}
+
+func (e *NoURLError) Error() string {
+	return fmt.Sprintf("%s is missing and the manifest has no url for it", e.FileName)
+}
+
+// HTTPError is returned when the server of a source URL responds with an error status
+type HTTPError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("downloading %s: %d %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// temporary reports whether downloading again may succeed
+func (e *HTTPError) temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusRequestTimeout
+}
+
+// Fetcher downloads the source PDFs of manifests from their URLs
+// Client is the HTTP client used for downloads.
+// Store (optional) is the download cache: sources with a checksum are looked up in it before they are
+// downloaded and are kept in it once they are. Sources without a checksum are always downloaded.
+// Retries is the number of times a failed download is tried again, resuming from where it stopped if
+// the server supports range requests. Retries wait RetryDelay, doubling for each retry after the first.
+type Fetcher struct {
+	Client     *http.Client
+	Store      sourcestore.Store
+	Retries    int
+	RetryDelay time.Duration
+}
+
+// New returns a fetcher using store as its download cache (nil for none) and the default retries
+func New(store sourcestore.Store) *Fetcher {
+	return &Fetcher{
+		Client:     http.DefaultClient,
+		Store:      store,
+		Retries:    DefaultRetries,
+		RetryDelay: DefaultRetryDelay,
+	}
+}
+
+// FetchSource makes sure the source PDF is in destDir, copying it from the download cache or downloading it
+// from its URL if it is missing
+// A source PDF already in destDir is left as it is, failing with a *manifest.ChecksumMismatchError if it
+// does not match the manifest. Downloads are written to FILE_NAME.part in destDir until they are complete
+// and verified, so an interrupted download is resumed by the next FetchSource.
+func (fetcher *Fetcher) FetchSource(ctx context.Context, source manifest.Source, destDir string) (result Result, err error) {
+	result.FileName = source.FileName
+	destPath := filepath.Join(destDir, source.FileName)
+	if info, statErr := os.Stat(destPath); statErr == nil {
+		result.Status, result.Bytes = Present, info.Size()
+		return result, source.Verify(destPath)
+	}
+
+	found, err := fetcher.fromStore(source, destPath)
+	if err != nil {
+		log.Println("WARNING: not using the cached", source.FileName+":", err)
+	} else if found {
+		result.Status = Cached
+		result.Bytes, err = fileSize(destPath, nil)
+		return
+	}
+
+	if source.URL == "" {
+		return result, &NoURLError{FileName: source.FileName}
+	}
+	partPath := destPath + ".part"
+	for attempt := 0; ; attempt++ {
+		var resumed bool
+		resumed, err = fetcher.download(ctx, source.URL, partPath)
+		if err == nil {
+			err = source.Verify(partPath)
+			var mismatch *manifest.ChecksumMismatchError
+			if errors.As(err, &mismatch) {
+				os.Remove(partPath)
+				if !resumed {
+					return
+				}
+				// the file may have changed on the server since the part was downloaded
+			}
+		}
+		if err == nil || !retryable(err) || attempt >= fetcher.Retries {
+			break
+		}
+		log.Printf("WARNING: retrying %s after %v", source.URL, err)
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-time.After(fetcher.RetryDelay << uint(attempt)):
+		}
+	}
+	if err != nil {
+		return
+	}
+
+	fetcher.toStore(source, partPath)
+	err = os.Rename(partPath, destPath)
+	result.Status = Downloaded
+	result.Bytes, err = fileSize(destPath, err)
+	return
+}
+
+// download writes the content at url to partPath, continuing the part already there with a range request
+// resumed is true if it did.
+func (fetcher *Fetcher) download(ctx context.Context, url string, partPath string) (resumed bool, err error) {
+	var offset int64
+	if info, statErr := os.Stat(partPath); statErr == nil {
+		offset = info.Size()
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return
+	}
+	request.Header.Set("User-Agent", "pdfpatch")
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	response, err := fetcher.Client.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	switch {
+	case response.StatusCode == http.StatusPartialContent && offset > 0:
+		if rangeStart(response) != offset {
+			os.Remove(partPath)
+			return false, fmt.Errorf("downloading %s: the server did not resume at byte %d", url, offset)
+		}
+		flags, resumed = os.O_WRONLY|os.O_APPEND, true
+	case response.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// the part is already complete
+		return true, nil
+	case response.StatusCode != http.StatusOK:
+		return false, &HTTPError{URL: url, StatusCode: response.StatusCode}
+	}
+	part, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return
+	}
+	_, err = io.Copy(part, response.Body)
+	if closeErr := part.Close(); err == nil {
+		err = closeErr
+	}
+	return
+}
+
+// rangeStart returns the first byte of the content of a partial response, or -1 if it has none
+func rangeStart(response *http.Response) int64 {
+	contentRange := strings.TrimPrefix(response.Header.Get("Content-Range"), "bytes ")
+	start, err := strconv.ParseInt(strings.SplitN(contentRange, "-", 2)[0], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return start
+}
+
+// retryable reports whether downloading again may succeed after err
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.temporary()
+	}
+	var pathErr *os.PathError
+	return !errors.As(err, &pathErr)
+}
+
+// fromStore copies the source from the download cache to destPath, found is false if it is not cached
+func (fetcher *Fetcher) fromStore(source manifest.Source, destPath string) (found bool, err error) {
+	hash := sourceHash(source)
+	if fetcher.Store == nil || hash == "" {
+		return
+	}
+	contents, err := fetcher.Store.Open(hash)
+	if err == sourcestore.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return
+	}
+	defer contents.Close()
+	partPath := destPath + ".part"
+	part, err := os.Create(partPath)
+	if err != nil {
+		return
+	}
+	_, err = io.Copy(part, contents)
+	if closeErr := part.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = source.Verify(partPath)
+	}
+	if err != nil {
+		os.Remove(partPath)
+		return
+	}
+	return true, os.Rename(partPath, destPath)
+}
+
+// toStore keeps the downloaded source at partPath in the download cache, warning if it cannot
+func (fetcher *Fetcher) toStore(source manifest.Source, partPath string) {
+	hash := sourceHash(source)
+	if fetcher.Store == nil || hash == "" {
+		return
+	}
+	part, err := os.Open(partPath)
+	if err == nil {
+		_, err = fetcher.Store.Put(hash, part)
+		part.Close()
+	}
+	if err != nil {
+		log.Println("WARNING: not caching", source.FileName+":", err)
+	}
+}
+
+// sourceHash returns the checksum the source is kept under in the download cache, "" if it has none
+func sourceHash(source manifest.Source) string {
+	if source.Sha256Sum != "" {
+		return source.Sha256Sum
+	}
+	return source.Md5Sum
+}
+
+func fileSize(path string, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,199 @@
+package fetcher_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/motevets/pdfpatch/pkg/fetcher"
+	"github.com/motevets/pdfpatch/pkg/manifest"
+	"github.com/motevets/pdfpatch/pkg/sourcestore"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Fetcher", func() {
+	const (
+		pdfPath   = "../../test/fixtures/patch_bundle_pdfs/title_pages.pdf"
+		sha256Sum = "4f7698a2562733dc3cd17a0bda13374c3f8e781d16b18631f41a506fbeb1d935"
+	)
+	var (
+		contents      []byte
+		workDir       string
+		destDir       string
+		store         *sourcestore.LocalStore
+		sourceFetcher *fetcher.Fetcher
+		server        *httptest.Server
+		handle        func(w http.ResponseWriter, r *http.Request)
+		mutex         sync.Mutex
+		ranges        []string
+		source        manifest.Source
+	)
+
+	serveContents := func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "title_pages.pdf", time.Time{}, bytes.NewReader(contents))
+	}
+
+	BeforeEach(func() {
+		var err error
+		contents, err = ioutil.ReadFile(pdfPath)
+		Expect(err).NotTo(HaveOccurred())
+		workDir, err = ioutil.TempDir("", "fetcher_test")
+		Expect(err).NotTo(HaveOccurred())
+		destDir = path.Join(workDir, "pdfs")
+		Expect(os.Mkdir(destDir, 0755)).To(Succeed())
+		store, err = sourcestore.NewLocalStore(path.Join(workDir, "store"))
+		Expect(err).NotTo(HaveOccurred())
+
+		ranges = nil
+		handle = serveContents
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			ranges = append(ranges, r.Header.Get("Range"))
+			mutex.Unlock()
+			handle(w, r)
+		}))
+		sourceFetcher = fetcher.New(store)
+		sourceFetcher.Client = server.Client()
+		sourceFetcher.RetryDelay = time.Millisecond
+		source = manifest.Source{FileName: "title_pages.pdf", URL: server.URL + "/title_pages.pdf", Sha256Sum: sha256Sum}
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(workDir)
+	})
+
+	requests := func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(ranges)
+	}
+
+	expectFetched := func() {
+		fetched, err := ioutil.ReadFile(path.Join(destDir, "title_pages.pdf"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fetched).To(Equal(contents))
+		_, err = os.Stat(path.Join(destDir, "title_pages.pdf.part"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	}
+
+	It("downloads a missing source and keeps it in the download cache", func() {
+		result, err := sourceFetcher.FetchSource(context.Background(), source, destDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(fetcher.Result{FileName: "title_pages.pdf", Status: fetcher.Downloaded, Bytes: int64(len(contents))}))
+		expectFetched()
+		Expect(store.Has(sha256Sum)).To(BeTrue())
+	})
+
+	It("copies a cached source instead of downloading it again", func() {
+		_, err := sourceFetcher.FetchSource(context.Background(), source, destDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Remove(path.Join(destDir, "title_pages.pdf"))).To(Succeed())
+
+		result, err := sourceFetcher.FetchSource(context.Background(), source, destDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Status).To(Equal(fetcher.Cached))
+		Expect(requests()).To(Equal(1))
+		expectFetched()
+	})
+
+	It("leaves a source that is already there", func() {
+		Expect(ioutil.WriteFile(path.Join(destDir, "title_pages.pdf"), contents, 0644)).To(Succeed())
+
+		result, err := sourceFetcher.FetchSource(context.Background(), source, destDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Status).To(Equal(fetcher.Present))
+		Expect(requests()).To(Equal(0))
+	})
+
+	It("resumes a partial download with a range request", func() {
+		partPath := path.Join(destDir, "title_pages.pdf.part")
+		Expect(ioutil.WriteFile(partPath, contents[:1000], 0644)).To(Succeed())
+
+		result, err := sourceFetcher.FetchSource(context.Background(), source, destDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Status).To(Equal(fetcher.Downloaded))
+		Expect(ranges).To(Equal([]string{"bytes=1000-"}))
+		expectFetched()
+	})
+
+	It("retries an interrupted download from where it stopped", func() {
+		handle = func(w http.ResponseWriter, r *http.Request) {
+			if requests() == 1 {
+				w.Header().Set("Content-Length", strconv.Itoa(len(contents)))
+				w.Write(contents[:1000])
+				w.(http.Flusher).Flush()
+				panic(http.ErrAbortHandler)
+			}
+			serveContents(w, r)
+		}
+
+		_, err := sourceFetcher.FetchSource(context.Background(), source, destDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ranges).To(Equal([]string{"", "bytes=1000-"}))
+		expectFetched()
+	})
+
+	It("retries server errors", func() {
+		handle = func(w http.ResponseWriter, r *http.Request) {
+			if requests() <= 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			serveContents(w, r)
+		}
+
+		_, err := sourceFetcher.FetchSource(context.Background(), source, destDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(requests()).To(Equal(3))
+		expectFetched()
+	})
+
+	It("gives up after its retries", func() {
+		handle = func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		sourceFetcher.Retries = 2
+
+		_, err := sourceFetcher.FetchSource(context.Background(), source, destDir)
+		var httpErr *fetcher.HTTPError
+		Expect(errors.As(err, &httpErr)).To(BeTrue())
+		Expect(httpErr.StatusCode).To(Equal(http.StatusBadGateway))
+		Expect(requests()).To(Equal(3))
+	})
+
+	It("does not retry client errors", func() {
+		handle = http.NotFound
+
+		_, err := sourceFetcher.FetchSource(context.Background(), source, destDir)
+		Expect(err).To(MatchError(ContainSubstring("404 Not Found")))
+		Expect(requests()).To(Equal(1))
+	})
+
+	It("rejects a download that does not match the manifest", func() {
+		source.Sha256Sum = "0000000000000000000000000000000000000000000000000000000000000000"
+
+		_, err := sourceFetcher.FetchSource(context.Background(), source, destDir)
+		var mismatch *manifest.ChecksumMismatchError
+		Expect(errors.As(err, &mismatch)).To(BeTrue())
+		files, err := ioutil.ReadDir(destDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(BeEmpty())
+	})
+
+	It("fails for a missing source without a url", func() {
+		source.URL = ""
+
+		_, err := sourceFetcher.FetchSource(context.Background(), source, destDir)
+		Expect(err).To(MatchError(&fetcher.NoURLError{FileName: "title_pages.pdf"}))
+	})
+})
@@ -2,7 +2,9 @@ package manifest
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
 	"path"
 
 	"github.com/mholt/archiver"
@@ -10,6 +12,7 @@ import (
 
 // Bundle represents the contents of a packaged (compressed) bundle
 type Bundle struct {
+	Dir          string
 	Manifest     Manifest
 	ManifestPath string
 	CSSDir       string
@@ -27,45 +30,175 @@ type Bundle struct {
 //   │   ├── CSS_FILE_1.css
 //   │   ├── OPTIONAL_CSS_FILE_2.css
 //   │   └── ...
-//   ├── manifest.yml
+//   ├── manifest.yml (or manifest.json or manifest.toml)
 //   └── patches
 //       ├── PATCH_FILE_1.pdf.patch
 //       ├── OPTIONAL_PATCH_FILE_2.pdf.patch
 //       ├── OPTIONAL_PATCH_FILE_3.pdf.patch
 //       └── ...
+//
+// Bundles are often uploaded by users so every entry is checked before it is extracted. Archives
+// with entries that would escape the bundle directory (absolute paths, ".." or links), entries
+// other than those above at the top level, or more entries or bytes than DefaultBundleLimits
+// fail with an error implementing InvalidBundleError.
+//
+// The bundle is unpacked to a new temporary directory which is removed by Bundle.Close.
 func UnpackBundle(bundleFilePath string) (bundle Bundle, err error) {
-	var (
-		tempDir     string
-		theManifest Manifest
-	)
+	tempDir, err := ioutil.TempDir("", "manifest_bundle")
+	if err != nil {
+		return
+	}
+	bundle, err = UnpackBundleInto(bundleFilePath, tempDir)
+	if err != nil {
+		os.RemoveAll(tempDir)
+	}
+	return
+}
 
-	tempDir, err = ioutil.TempDir("", "manifest_bundle")
-	err = archiver.Unarchive(bundleFilePath, tempDir)
+// UnpackBundleInto unpacks a bundle like UnpackBundle but into dir, which must be empty or not exist
+func UnpackBundleInto(bundleFilePath string, dir string) (bundle Bundle, err error) {
+	var theManifest Manifest
+
+	err = unpackArchive(bundleFilePath, dir, DefaultBundleLimits)
+	if err != nil {
+		return
+	}
+	bundle.Dir = dir
+	bundle.ManifestPath, err = findManifest(dir)
 	if err != nil {
 		return
 	}
-	bundle.ManifestPath = path.Join(tempDir, "manifest.yml")
 	theManifest, err = ParseFile(bundle.ManifestPath)
 	bundle.Manifest = theManifest
-	bundle.CSSDir = path.Join(tempDir, "css")
-	bundle.PatchesDir = path.Join(tempDir, "patches")
+	bundle.CSSDir = path.Join(dir, "css")
+	bundle.PatchesDir = path.Join(dir, "patches")
 	return
 }
 
+// findManifest returns the path of the manifest of the bundle unpacked to dir
+// A bundle without a manifest gets the path of manifest.yml so reading it fails as the file does not exist.
+func findManifest(dir string) (manifestPath string, err error) {
+	var found []string
+	for _, name := range bundleManifestNames {
+		if _, statErr := os.Stat(path.Join(dir, name)); statErr == nil {
+			found = append(found, name)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return path.Join(dir, bundleManifestNames[0]), nil
+	case 1:
+		return path.Join(dir, found[0]), nil
+	}
+	return "", &MultipleManifestsError{Entries: found}
+}
+
+// Close removes the directory the bundle was unpacked to
+func (bundle Bundle) Close() error {
+	if bundle.Dir == "" {
+		return nil
+	}
+	return os.RemoveAll(bundle.Dir)
+}
+
 // CSSFilePath returns the path to the style sheet of an extracted bundle
 // note: currently there is no validation that the stylesheet exists and err will always be nil
 func (bundle Bundle) CSSFilePath(styleSheet string) (styleSheetPath string, err error) {
-	var foundStyleSheet = false
-	for _, style := range bundle.Manifest.Styles {
-		if style.StyleSheet == styleSheet {
-			foundStyleSheet = true
-			break
-		}
-	}
-	if foundStyleSheet {
+	if _, found := bundle.Manifest.FindStyle(styleSheet); found {
 		styleSheetPath = path.Join(bundle.CSSDir, styleSheet)
 	} else {
 		err = fmt.Errorf("%s is not a style sheet in the bundle", styleSheet)
 	}
 	return
 }
+
+// PackBundle writes a bundle archive to outputPath with the layout expected by UnpackBundle
+//
+// The archive format is chosen by the extension of outputPath (e.g. .zip, .tar or .tar.gz).
+// The md5 and sha256 sums of each source are computed from the PDFs in pdfsDir, only the
+// style sheets referenced by the manifest styles are copied from cssDir, and patchesDir must
+// contain a patch named like "input_pdf_file.pdf.patch" for every source (see Source.PatchFileName).
+func PackBundle(theManifest Manifest, pdfsDir string, patchesDir string, cssDir string, outputPath string) (err error) {
+	var (
+		stagingDir   string
+		manifestData []byte
+	)
+
+	if len(theManifest.Sources) == 0 {
+		return fmt.Errorf("manifest has no sources")
+	}
+	if len(theManifest.Styles) == 0 {
+		return fmt.Errorf("manifest has no styles")
+	}
+
+	stagingDir, err = ioutil.TempDir("", "manifest_bundle_staging")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(stagingDir)
+	stagedPatchesDir := path.Join(stagingDir, "patches")
+	stagedCSSDir := path.Join(stagingDir, "css")
+	for _, dir := range []string{stagedPatchesDir, stagedCSSDir} {
+		err = os.Mkdir(dir, 0755)
+		if err != nil {
+			return
+		}
+	}
+
+	theManifest.Sources = append([]Source(nil), theManifest.Sources...)
+	for i, source := range theManifest.Sources {
+		if source.FileName == "" {
+			return fmt.Errorf("source %d has no file_name", i+1)
+		}
+		theManifest.Sources[i].Md5Sum, theManifest.Sources[i].Sha256Sum, err = FileChecksums(path.Join(pdfsDir, source.FileName))
+		if err != nil {
+			return
+		}
+		patchFileName := source.PatchFileName()
+		err = copyFile(path.Join(patchesDir, patchFileName), path.Join(stagedPatchesDir, patchFileName))
+		if err != nil {
+			return
+		}
+	}
+
+	for _, style := range theManifest.Styles {
+		if style.StyleSheet == "" {
+			return fmt.Errorf("style %q has no style_sheet", style.Name)
+		}
+		err = copyFile(path.Join(cssDir, style.StyleSheet), path.Join(stagedCSSDir, style.StyleSheet))
+		if err != nil {
+			return
+		}
+	}
+
+	manifestData, err = Marshal(theManifest)
+	if err != nil {
+		return
+	}
+	stagedManifestPath := path.Join(stagingDir, "manifest.yml")
+	err = ioutil.WriteFile(stagedManifestPath, manifestData, 0644)
+	if err != nil {
+		return
+	}
+
+	err = archiver.Archive([]string{stagedManifestPath, stagedCSSDir, stagedPatchesDir}, outputPath)
+	return
+}
+
+func copyFile(sourcePath string, destinationPath string) (err error) {
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return
+	}
+	defer source.Close()
+
+	destination, err := os.OpenFile(destinationPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return
+	}
+	_, err = io.Copy(destination, source)
+	if closeErr := destination.Close(); err == nil {
+		err = closeErr
+	}
+	return
+}
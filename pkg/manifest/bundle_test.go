@@ -1,6 +1,8 @@
 package manifest_test
 
 import (
+	"io/ioutil"
+	"os"
 	"path"
 
 	"github.com/motevets/pdfpatch/pkg/manifest"
@@ -20,13 +22,27 @@ var _ = Describe("Bundle", func() {
 		Expect(err).NotTo(HaveOccurred())
 	})
 
+	AfterEach(func() {
+		bundle.Close()
+	})
+
+	Describe(".Close", func() {
+		It("removes the directory the bundle was unpacked to", func() {
+			Expect(bundle.Dir).To(BeADirectory())
+			Expect(bundle.Close()).To(Succeed())
+			Expect(bundle.Dir).NotTo(BeAnExistingFile())
+		})
+	})
+
 	Describe(".UnpackBundle", func() {
 		It("returns a struct with the manifest", func() {
 			Expect(bundle.Manifest).To(Equal(manifest.Manifest{
+				Version: 1,
 				Sources: []manifest.Source{
 					{
 						URL:      "http://example.com/title_pages.pdf",
 						FileName: "title_pages.pdf",
+						Md5Sum:   "663d57d25413c9da4808f89919436090",
 						PatchedFiles: []string{
 							"title.md",
 							"dedication.md",
@@ -35,6 +51,7 @@ var _ = Describe("Bundle", func() {
 					{
 						URL:      "http://example.com/chapter_1.pdf",
 						FileName: "chapter_1.pdf",
+						Md5Sum:   "a9933c03362f2b40fa4c28cb86bff14d",
 						PatchedFiles: []string{
 							"chapter_1.md",
 						},
@@ -84,3 +101,73 @@ var _ = Describe("Bundle", func() {
 		})
 	})
 })
+
+var _ = Describe("PackBundle", func() {
+	const fixturesPath = "../../test/fixtures/pdfs_patches_and_csses"
+	var (
+		outputDir   string
+		theManifest manifest.Manifest
+	)
+
+	BeforeEach(func() {
+		var err error
+		outputDir, err = ioutil.TempDir("", "pack_bundle_test")
+		Expect(err).NotTo(HaveOccurred())
+		theManifest = manifest.Manifest{
+			Sources: []manifest.Source{
+				{FileName: "title_pages.pdf", PatchedFiles: []string{"title.md", "dedication.md"}},
+				{FileName: "chapter_1.pdf", PatchedFiles: []string{"chapter_1.md"}},
+			},
+			Styles: []manifest.Style{
+				{Name: "Traditional", StyleSheet: "book.css"},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(outputDir)
+	})
+
+	for _, extension := range []string{".zip", ".tar.gz"} {
+		extension := extension
+		It("writes a "+extension+" bundle that can be unpacked with checksums filled in", func() {
+			bundlePath := path.Join(outputDir, "bundle"+extension)
+			err := manifest.PackBundle(theManifest, path.Join(fixturesPath, "pdfs"), path.Join(fixturesPath, "patches"), path.Join(fixturesPath, "css"), bundlePath)
+			Expect(err).NotTo(HaveOccurred())
+
+			bundle, err := manifest.UnpackBundle(bundlePath)
+			Expect(err).NotTo(HaveOccurred())
+			defer bundle.Close()
+			Expect(bundle.Manifest.Sources[0].Md5Sum).To(Equal("663d57d25413c9da4808f89919436090"))
+			Expect(bundle.Manifest.Sources[0].Sha256Sum).To(Equal("4f7698a2562733dc3cd17a0bda13374c3f8e781d16b18631f41a506fbeb1d935"))
+			Expect(bundle.Manifest.Sources[1].Md5Sum).To(Equal("a9933c03362f2b40fa4c28cb86bff14d"))
+			Expect(bundle.Manifest.Sources[1].PatchedFiles).To(Equal([]string{"chapter_1.md"}))
+			Expect(bundle.Manifest.Styles).To(Equal(theManifest.Styles))
+			Expect(path.Join(bundle.PatchesDir, "title_pages.pdf.patch")).To(BeARegularFile())
+			Expect(path.Join(bundle.PatchesDir, "chapter_1.pdf.patch")).To(BeARegularFile())
+			Expect(bundle.CSSFilePath("book.css")).To(BeARegularFile())
+		})
+	}
+
+	It("does not modify the sources of the given manifest", func() {
+		err := manifest.PackBundle(theManifest, path.Join(fixturesPath, "pdfs"), path.Join(fixturesPath, "patches"), path.Join(fixturesPath, "css"), path.Join(outputDir, "bundle.zip"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(theManifest.Sources[0].Md5Sum).To(BeEmpty())
+	})
+
+	When("a style sheet referenced by the manifest is missing", func() {
+		It("returns an error", func() {
+			theManifest.Styles = append(theManifest.Styles, manifest.Style{Name: "Large Print", StyleSheet: "large_print.css"})
+			err := manifest.PackBundle(theManifest, path.Join(fixturesPath, "pdfs"), path.Join(fixturesPath, "patches"), path.Join(fixturesPath, "css"), path.Join(outputDir, "bundle.zip"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	When("a patch is missing", func() {
+		It("returns an error", func() {
+			theManifest.Sources = append(theManifest.Sources, manifest.Source{FileName: "chapter_2.pdf"})
+			err := manifest.PackBundle(theManifest, path.Join(fixturesPath, "pdfs"), path.Join(fixturesPath, "patches"), path.Join(fixturesPath, "css"), path.Join(outputDir, "bundle.zip"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,67 @@
+package manifest
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// ChecksumMismatchError is returned when a source PDF does not match the checksum listed in the manifest
+type ChecksumMismatchError struct {
+	FileName  string
+	Algorithm string
+	Expected  string
+	Actual    string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("%s does not match the manifest: expected %s %s but got %s", e.FileName, e.Algorithm, e.Expected, e.Actual)
+}
+
+// FileChecksums returns the hex encoded md5 and sha256 sums of the file at path
+func FileChecksums(path string) (md5Sum string, sha256Sum string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	md5Hash := md5.New()
+	sha256Hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(md5Hash, sha256Hash), file)
+	if err != nil {
+		return
+	}
+	md5Sum = hexSum(md5Hash)
+	sha256Sum = hexSum(sha256Hash)
+	return
+}
+
+func hexSum(h hash.Hash) string {
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verify checks the PDF at pdfPath against the checksums of the source
+// Every checksum present in the source is compared; a source without checksums always verifies.
+// A mismatch is returned as a *ChecksumMismatchError.
+func (source Source) Verify(pdfPath string) (err error) {
+	if source.Md5Sum == "" && source.Sha256Sum == "" {
+		return
+	}
+	md5Sum, sha256Sum, err := FileChecksums(pdfPath)
+	if err != nil {
+		return
+	}
+	if source.Sha256Sum != "" && !strings.EqualFold(source.Sha256Sum, sha256Sum) {
+		return &ChecksumMismatchError{FileName: source.FileName, Algorithm: "sha256", Expected: source.Sha256Sum, Actual: sha256Sum}
+	}
+	if source.Md5Sum != "" && !strings.EqualFold(source.Md5Sum, md5Sum) {
+		return &ChecksumMismatchError{FileName: source.FileName, Algorithm: "md5", Expected: source.Md5Sum, Actual: md5Sum}
+	}
+	return
+}
@@ -0,0 +1,62 @@
+package manifest_test
+
+import (
+	"errors"
+
+	"github.com/motevets/pdfpatch/pkg/manifest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("checksums", func() {
+	const pdfPath = "../../test/fixtures/patch_bundle_pdfs/chapter_1.pdf"
+	const chapter1Md5 = "a9933c03362f2b40fa4c28cb86bff14d"
+	const chapter1Sha256 = "bbdfeac0de049de8a5e9f369c1fd74394cfba9b8b008ee8b8d04d534d02b195f"
+
+	Describe("FileChecksums", func() {
+		It("returns the md5 and sha256 sums of the file", func() {
+			md5Sum, sha256Sum, err := manifest.FileChecksums(pdfPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(md5Sum).To(Equal(chapter1Md5))
+			Expect(sha256Sum).To(Equal(chapter1Sha256))
+		})
+	})
+
+	Describe("Source#Verify", func() {
+		It("succeeds when the checksums match", func() {
+			source := manifest.Source{FileName: "chapter_1.pdf", Md5Sum: chapter1Md5, Sha256Sum: chapter1Sha256}
+			Expect(source.Verify(pdfPath)).To(Succeed())
+		})
+
+		It("succeeds when the source has no checksums", func() {
+			source := manifest.Source{FileName: "chapter_1.pdf"}
+			Expect(source.Verify(pdfPath)).To(Succeed())
+		})
+
+		When("the md5sum does not match", func() {
+			It("returns a mismatch error naming the file and the hashes", func() {
+				source := manifest.Source{FileName: "chapter_1.pdf", Md5Sum: "663d57d25413c9da4808f89919436090"}
+				err := source.Verify(pdfPath)
+				var mismatchErr *manifest.ChecksumMismatchError
+				Expect(errors.As(err, &mismatchErr)).To(BeTrue())
+				Expect(*mismatchErr).To(Equal(manifest.ChecksumMismatchError{
+					FileName:  "chapter_1.pdf",
+					Algorithm: "md5",
+					Expected:  "663d57d25413c9da4808f89919436090",
+					Actual:    chapter1Md5,
+				}))
+				Expect(err).To(MatchError("chapter_1.pdf does not match the manifest: expected md5 663d57d25413c9da4808f89919436090 but got " + chapter1Md5))
+			})
+		})
+
+		When("the sha256sum does not match", func() {
+			It("returns a mismatch error", func() {
+				source := manifest.Source{FileName: "chapter_1.pdf", Md5Sum: chapter1Md5, Sha256Sum: "00"}
+				err := source.Verify(pdfPath)
+				var mismatchErr *manifest.ChecksumMismatchError
+				Expect(errors.As(err, &mismatchErr)).To(BeTrue())
+				Expect(mismatchErr.Algorithm).To(Equal("sha256"))
+			})
+		})
+	})
+})
@@ -0,0 +1,228 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Encoding is the syntax a manifest is written in
+// Manifests mean the same whatever their encoding: the keys and values are those of the YAML format.
+type Encoding string
+
+// The encodings of manifests
+const (
+	YAML Encoding = "yaml"
+	JSON Encoding = "json"
+	TOML Encoding = "toml"
+)
+
+// bundleManifestNames are the file names a bundle can have its manifest in
+var bundleManifestNames = []string{"manifest.yml", "manifest.json", "manifest.toml"}
+
+// tomlLine matches the first line of TOML manifests: a table header or a key/value pair
+var tomlLine = regexp.MustCompile(`^(\[\[?\s*[A-Za-z0-9_."'-]+\s*\]\]?|[A-Za-z0-9_."'-]+\s*=)`)
+
+// EncodingOfPath returns the encoding for the extension of path, known is false for other extensions
+func EncodingOfPath(filePath string) (encoding Encoding, known bool) {
+	switch strings.ToLower(path.Ext(filePath)) {
+	case ".yml", ".yaml":
+		return YAML, true
+	case ".json":
+		return JSON, true
+	case ".toml":
+		return TOML, true
+	}
+	return "", false
+}
+
+// ParseEncoding returns the encoding with the name, like "json"
+func ParseEncoding(name string) (encoding Encoding, err error) {
+	switch encoding = Encoding(strings.ToLower(name)); encoding {
+	case YAML, JSON, TOML:
+		return encoding, nil
+	case "yml":
+		return YAML, nil
+	}
+	return "", fmt.Errorf("unknown manifest encoding %q (must be yaml, json or toml)", name)
+}
+
+// DetectEncoding returns the encoding of the manifest at path with content manifestData, by the
+// extension of path or else by sniffing the content (YAML if it looks like neither JSON nor TOML)
+func DetectEncoding(filePath string, manifestData []byte) Encoding {
+	if encoding, known := EncodingOfPath(filePath); known {
+		return encoding
+	}
+	content := strings.TrimPrefix(string(manifestData), "\ufeff")
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "{") {
+			return JSON
+		}
+		if tomlLine.MatchString(line) {
+			return TOML
+		}
+		break
+	}
+	return YAML
+}
+
+// parseDocument parses manifestData in the encoding into a YAML document
+// JSON is checked strictly and then read as the YAML it also is, so problems have the same positions.
+// TOML is read into a document without positions.
+func parseDocument(manifestData []byte, encoding Encoding) (root yaml.Node, err error) {
+	switch encoding {
+	case JSON:
+		var value interface{}
+		err = json.Unmarshal(manifestData, &value)
+		if err != nil {
+			return
+		}
+		err = yaml.Unmarshal(manifestData, &root)
+	case TOML:
+		var value map[string]interface{}
+		_, err = toml.Decode(string(manifestData), &value)
+		if err != nil {
+			return
+		}
+		var mapping yaml.Node
+		err = mapping.Encode(value)
+		root = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{&mapping}}
+	default:
+		err = yaml.Unmarshal(manifestData, &root)
+	}
+	return
+}
+
+// Unmarshal reads the manifest in manifestData written in the encoding, like ParseFile
+func Unmarshal(manifestData []byte, encoding Encoding) (theManifest Manifest, err error) {
+	root, err := parseDocument(manifestData, encoding)
+	if err != nil {
+		return
+	}
+	return validateDocument("", &root, ValidationOptions{})
+}
+
+// MarshalAs returns the manifest in the current version of the format written in the encoding
+func MarshalAs(theManifest Manifest, encoding Encoding) (manifestData []byte, err error) {
+	if encoding == YAML {
+		return Marshal(theManifest)
+	}
+	var node yaml.Node
+	err = node.Encode(theManifest)
+	if err != nil {
+		return
+	}
+	switch encoding {
+	case JSON:
+		manifestData, err = json.MarshalIndent(plainValue(&node, true), "", "  ")
+		return append(manifestData, '\n'), err
+	case TOML:
+		var buffer bytes.Buffer
+		err = toml.NewEncoder(&buffer).Encode(plainValue(&node, false))
+		return buffer.Bytes(), err
+	}
+	return nil, fmt.Errorf("unknown manifest encoding %q", encoding)
+}
+
+// MarshalJSON writes the manifest in the current version of the format
+func (m Manifest) MarshalJSON() ([]byte, error) {
+	var node yaml.Node
+	err := node.Encode(m)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(plainValue(&node, true))
+}
+
+// UnmarshalJSON reads a manifest of any version of the format, see Unmarshal
+func (m *Manifest) UnmarshalJSON(manifestData []byte) (err error) {
+	*m, err = Unmarshal(manifestData, JSON)
+	return
+}
+
+// UnmarshalYAML reads a manifest of any version of the format, see Unmarshal
+func (m *Manifest) UnmarshalYAML(node *yaml.Node) (err error) {
+	root := node
+	if node.Kind != yaml.DocumentNode {
+		root = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{node}}
+	}
+	*m, err = validateDocument("", root, ValidationOptions{})
+	return
+}
+
+// plainValue returns the value of node as maps, slices and scalars for the JSON and TOML encoders
+// Mappings are an orderedMapping if ordered is true so JSON keeps the order of the YAML format.
+func plainValue(node *yaml.Node, ordered bool) interface{} {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil
+		}
+		return plainValue(node.Content[0], ordered)
+	case yaml.MappingNode:
+		var mapping orderedMapping
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			mapping = append(mapping, mappingEntry{node.Content[i].Value, plainValue(node.Content[i+1], ordered)})
+		}
+		if ordered {
+			return mapping
+		}
+		unordered := make(map[string]interface{}, len(mapping))
+		for _, entry := range mapping {
+			unordered[entry.key] = entry.value
+		}
+		return unordered
+	case yaml.SequenceNode:
+		items := make([]interface{}, len(node.Content))
+		for i, item := range node.Content {
+			items[i] = plainValue(item, ordered)
+		}
+		return items
+	}
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return node.Value
+	}
+	return value
+}
+
+// orderedMapping is a JSON object that keeps the order of its keys
+type orderedMapping []mappingEntry
+
+type mappingEntry struct {
+	key   string
+	value interface{}
+}
+
+func (mapping orderedMapping) MarshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	for i, entry := range mapping {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		key, err := json.Marshal(entry.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(entry.value)
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(key)
+		buffer.WriteByte(':')
+		buffer.Write(value)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
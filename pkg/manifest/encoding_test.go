@@ -0,0 +1,212 @@
+package manifest_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/mholt/archiver"
+	"github.com/motevets/pdfpatch/pkg/manifest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v3"
+)
+
+const jsonManifest = `{
+  "version": 2,
+  "book": {"title": "Foo", "language": "en"},
+  "sources": [
+    {
+      "file_name": "foo.pdf",
+      "checksums": {"md5": "2b00042f7481c7b056c4b410d28f33cf"},
+      "pages": ["1-4", "9"],
+      "patched_files": ["foo.md"]
+    }
+  ],
+  "styles": [{"name": "Regular", "style_sheet": "book.css", "formats": ["pdf"]}]
+}
+`
+
+const tomlManifest = `# made by the CMS
+version = 2
+
+[book]
+title = "Foo"
+language = "en"
+
+[[sources]]
+file_name = "foo.pdf"
+pages = ["1-4", "9"]
+patched_files = ["foo.md"]
+
+  [sources.checksums]
+  md5 = "2b00042f7481c7b056c4b410d28f33cf"
+
+[[styles]]
+name = "Regular"
+style_sheet = "book.css"
+formats = ["pdf"]
+`
+
+var _ = Describe("manifest encodings", func() {
+	var expectedManifest = manifest.Manifest{
+		Version: 2,
+		Book:    manifest.Book{Title: "Foo", Language: "en"},
+		Sources: []manifest.Source{{
+			FileName:     "foo.pdf",
+			Md5Sum:       "2b00042f7481c7b056c4b410d28f33cf",
+			PatchedFiles: []string{"foo.md"},
+			Pages:        "1-4,9",
+		}},
+		Styles: []manifest.Style{{Name: "Regular", StyleSheet: "book.css", Formats: []string{"pdf"}}},
+	}
+
+	Describe("ParseFile", func() {
+		It("reads JSON and TOML manifests like YAML ones", func() {
+			for _, content := range []string{jsonManifest, tomlManifest} {
+				manifestFilePath := writeTmpFile(content)
+				defer os.Remove(manifestFilePath)
+
+				theManifest, err := manifest.ParseFile(manifestFilePath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(theManifest).To(Equal(expectedManifest))
+			}
+		})
+
+		It("reports problems in JSON manifests at their position", func() {
+			manifestFilePath := writeTmpFile(`{"version": 2, "sources": [{"file_name": "foo.pdf", "patched_file": ["foo.md"]}]}`)
+			defer os.Remove(manifestFilePath)
+
+			_, err := manifest.ParseFile(manifestFilePath)
+			Expect(err).To(MatchError(ContainSubstring(`1:53: unknown key "patched_file" in sources (did you mean "patched_files"?)`)))
+		})
+
+		It("reports problems in TOML manifests without a position", func() {
+			manifestFilePath := writeTmpFile("version = 2\n[[sources]]\nfile_name = \"foo.pdf\"\npatched_files = []\n")
+			defer os.Remove(manifestFilePath)
+
+			_, err := manifest.ParseFile(manifestFilePath)
+			var invalidErr *manifest.InvalidManifestError
+			Expect(errors.As(err, &invalidErr)).To(BeTrue())
+			Expect(invalidErr.Problems).To(Equal([]manifest.Problem{{Message: "source foo.pdf has no patched_files"}}))
+		})
+
+		It("rejects JSON that is only valid as YAML", func() {
+			manifestFilePath := path.Join(os.TempDir(), "pdfpatch-manifest-test.json")
+			Expect(ioutil.WriteFile(manifestFilePath, []byte("version: 2\nsources: []\n"), 0644)).To(Succeed())
+			defer os.Remove(manifestFilePath)
+
+			_, err := manifest.ParseFile(manifestFilePath)
+			var syntaxErr *json.SyntaxError
+			Expect(errors.As(err, &syntaxErr)).To(BeTrue())
+		})
+	})
+
+	Describe("DetectEncoding", func() {
+		It("uses the extension of the path", func() {
+			Expect(manifest.DetectEncoding("manifest.json", []byte("version: 2"))).To(Equal(manifest.JSON))
+			Expect(manifest.DetectEncoding("manifest.TOML", []byte("{}"))).To(Equal(manifest.TOML))
+			Expect(manifest.DetectEncoding("manifest.yaml", []byte("{}"))).To(Equal(manifest.YAML))
+		})
+
+		It("sniffs the content of paths with other extensions", func() {
+			Expect(manifest.DetectEncoding("manifest", []byte(jsonManifest))).To(Equal(manifest.JSON))
+			Expect(manifest.DetectEncoding("manifest", []byte(tomlManifest))).To(Equal(manifest.TOML))
+			Expect(manifest.DetectEncoding("manifest", []byte("[[sources]]\n"))).To(Equal(manifest.TOML))
+			Expect(manifest.DetectEncoding("manifest", []byte(version2Manifest))).To(Equal(manifest.YAML))
+			Expect(manifest.DetectEncoding("manifest", []byte(version1Manifest))).To(Equal(manifest.YAML))
+		})
+	})
+
+	Describe("MarshalAs", func() {
+		It("writes manifests that read back the same in every encoding", func() {
+			for _, encoding := range []manifest.Encoding{manifest.YAML, manifest.JSON, manifest.TOML} {
+				manifestData, err := manifest.MarshalAs(expectedManifest, encoding)
+				Expect(err).NotTo(HaveOccurred(), string(encoding))
+				Expect(manifest.DetectEncoding("manifest", manifestData)).To(Equal(encoding))
+
+				theManifest, err := manifest.Unmarshal(manifestData, encoding)
+				Expect(err).NotTo(HaveOccurred(), string(encoding))
+				Expect(theManifest).To(Equal(expectedManifest), string(encoding))
+			}
+		})
+
+		It("writes JSON with the keys in the order of the YAML format", func() {
+			manifestData, err := manifest.MarshalAs(expectedManifest, manifest.JSON)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(manifestData)).To(HavePrefix("{\n  \"version\": 2,\n  \"book\": {\n    \"title\": \"Foo\","))
+		})
+	})
+
+	Describe("Manifest", func() {
+		It("round trips through encoding/json", func() {
+			manifestData, err := json.Marshal(expectedManifest)
+			Expect(err).NotTo(HaveOccurred())
+			var theManifest manifest.Manifest
+			Expect(json.Unmarshal(manifestData, &theManifest)).To(Succeed())
+			Expect(theManifest).To(Equal(expectedManifest))
+		})
+
+		It("round trips through yaml", func() {
+			manifestData, err := yaml.Marshal(expectedManifest)
+			Expect(err).NotTo(HaveOccurred())
+			var theManifest manifest.Manifest
+			Expect(yaml.Unmarshal(manifestData, &theManifest)).To(Succeed())
+			Expect(theManifest).To(Equal(expectedManifest))
+		})
+
+		It("fails to unmarshal invalid manifests", func() {
+			var theManifest manifest.Manifest
+			err := json.Unmarshal([]byte(`{"version": 2, "sources": []}`), &theManifest)
+			Expect(err).To(MatchError("invalid manifest:\n  1:1: manifest has no sources"))
+		})
+	})
+
+	Describe("UnpackBundle", func() {
+		var workDir string
+
+		BeforeEach(func() {
+			var err error
+			workDir, err = ioutil.TempDir("", "manifest_encoding_test")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.Mkdir(path.Join(workDir, "css"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(path.Join(workDir, "css", "book.css"), []byte("body {}"), 0644)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(workDir)
+		})
+
+		It("reads the manifest.json or manifest.toml of a bundle", func() {
+			for name, content := range map[string]string{"manifest.json": jsonManifest, "manifest.toml": tomlManifest} {
+				manifestPath := path.Join(workDir, name)
+				Expect(ioutil.WriteFile(manifestPath, []byte(content), 0644)).To(Succeed())
+				bundlePath := path.Join(workDir, name+".zip")
+				Expect(archiver.Archive([]string{manifestPath, path.Join(workDir, "css")}, bundlePath)).To(Succeed())
+				os.Remove(manifestPath)
+
+				bundle, err := manifest.UnpackBundle(bundlePath)
+				Expect(err).NotTo(HaveOccurred(), name)
+				Expect(path.Base(bundle.ManifestPath)).To(Equal(name))
+				Expect(bundle.Manifest).To(Equal(expectedManifest))
+				bundle.Close()
+			}
+		})
+
+		It("rejects bundles with more than one manifest", func() {
+			jsonPath := path.Join(workDir, "manifest.json")
+			ymlPath := path.Join(workDir, "manifest.yml")
+			Expect(ioutil.WriteFile(jsonPath, []byte(jsonManifest), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(ymlPath, []byte(version2Manifest), 0644)).To(Succeed())
+			bundlePath := path.Join(workDir, "bundle.zip")
+			Expect(archiver.Archive([]string{jsonPath, ymlPath}, bundlePath)).To(Succeed())
+
+			_, err := manifest.UnpackBundle(bundlePath)
+			var invalidErr manifest.InvalidBundleError
+			Expect(errors.As(err, &invalidErr)).To(BeTrue())
+			Expect(err).To(MatchError("bundle has more than one manifest (manifest.yml, manifest.json)"))
+		})
+	})
+})
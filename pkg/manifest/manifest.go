@@ -1,61 +1,123 @@
 package manifest
 
-import (
-	"io/ioutil"
-
-	"gopkg.in/yaml.v2"
-)
+import "strings"
 
 // Manifest represents the manifest for a pdfpatch bundle
-// Example:
+// Manifests of every version of the format are read into a Manifest and written in the current version
+// (see CurrentVersion). Example:
+//   version: 2
+//   book:
+//     title: Foo
+//     subtitle: A Story
+//     authors: [John Smith]
+//     language: en
+//   metadata:
+//     name: Foo, corrected
+//     authors: [Jane Doe]
+//     license: CC-BY-4.0
 //   sources:
 //   - file_name: foo
 //     url: http://example.com/foo.md
-//     md5sum: a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a
+//     checksums:
+//       md5: a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1
+//       sha256: b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2
+//     extractor:
+//       name: pdftotext
+//       version: 22.12.0
+//     pages: [1-4, 9, 12-]
 //   styles:
 //   - name: Regular
 //     description: This is the regular formatting of the book.
 //     style_sheet: regular.css
+//     renderer: weasyprint
+//     formats: [pdf, epub]
+// Version is the version of the format the manifest was read from (0 if it was not read from a file)
 type Manifest struct {
-	Sources []Source
-	Styles  []Style
+	Version  int
+	Book     Book
+	Metadata Metadata
+	Sources  []Source
+	Styles   []Style
+}
+
+// Book describes the book the bundle makes, written into the output documents (version 2)
+// Title (optional) is the title of the book
+// Subtitle (optional) is the subtitle of the book
+// Authors (optional) are the authors of the book
+// Language (optional) is the language of the book as a BCP 47 tag like "en" or "de-CH"
+// Identifier (optional) identifies the book, like an ISBN or a URN
+// Publisher (optional) is the publisher of the book
+// Rights (optional) is the copyright statement of the book
+// Description (optional) is a summary of the book
+type Book struct {
+	Title       string   `yaml:",omitempty"`
+	Subtitle    string   `yaml:",omitempty"`
+	Authors     []string `yaml:",omitempty"`
+	Language    string   `yaml:",omitempty"`
+	Identifier  string   `yaml:",omitempty"`
+	Publisher   string   `yaml:",omitempty"`
+	Rights      string   `yaml:",omitempty"`
+	Description string   `yaml:",omitempty"`
+}
+
+// IsZero reports whether none of the metadata of the book is set
+func (book Book) IsZero() bool {
+	return book.Title == "" && book.Subtitle == "" && len(book.Authors) == 0 && book.Language == "" &&
+		book.Identifier == "" && book.Publisher == "" && book.Rights == "" && book.Description == ""
+}
+
+// Metadata describes the bundle itself rather than the book it patches (version 2)
+// Name (optional) is the human readable name of the bundle
+// Description (optional) is the human readable description of the bundle
+// Authors (optional) are the people who made the patches
+// License (optional) is the license of the patches and style sheets, like an SPDX identifier
+// Homepage (optional) is the URL where the bundle is published
+type Metadata struct {
+	Name        string   `yaml:",omitempty"`
+	Description string   `yaml:",omitempty"`
+	Authors     []string `yaml:",omitempty"`
+	License     string   `yaml:",omitempty"`
+	Homepage    string   `yaml:",omitempty"`
 }
 
 // Source represent a source file for patching
 // FileName (required) an is the filename (without an path) for the pdf file to be patched
 // Md5Sum (optional) is the check md5sum for the file
+// Sha256Sum (optional) is the check sha256sum for the file
 // URL (optional) is the URL from which the PDF can be obtained
 // PatchedFiles (required) are the PDFs from which file names of the patches in order that the PDF text should patch to
+// Extractor (optional) is the name of the text extractor the patch was generated with (default: pdftotext)
+// ExtractorVersion (optional) is the version of the extractor the patch was generated with
+// Pages (optional) limits the source to page ranges of the PDF like "1-4,9,12-" (default: all pages)
 type Source struct {
-	URL          string
-	FileName     string `yaml:"file_name"`
-	Md5Sum       string
-	PatchedFiles []string `yaml:"patched_files"`
+	URL              string
+	FileName         string
+	Md5Sum           string
+	Sha256Sum        string
+	PatchedFiles     []string
+	Extractor        string
+	ExtractorVersion string
+	Pages            string
 }
 
 // Style are a list of stylesheets that can be used to style the patched text
 // Name (required) is the human readable name for the style
 // Description (optional) is the human readable description for the style
 // StyleSheet (required) is the file name (no path) for the style_sheet used for the style
+// Renderer (optional) is the name of the renderer the style sheet was designed for (default: weasyprint)
+// Formats (optional) are the output formats the style sheet was designed for, like pdf or epub (default: all)
 type Style struct {
 	Name        string
 	Description string
-	StyleSheet  string `yaml:"style_sheet"`
+	StyleSheet  string
+	Renderer    string
+	Formats     []string
 }
 
 // ParseFile reads/parses a manifest from path
+// Unknown keys and invalid values are an *InvalidManifestError listing every problem, see ValidateFile.
 func ParseFile(path string) (theManifest Manifest, err error) {
-	manifestData, err := ioutil.ReadFile(path)
-	if err != nil {
-		return
-	}
-
-	err = yaml.Unmarshal(manifestData, &theManifest)
-	if err != nil {
-		return
-	}
-
-	return
+	return ValidateFile(path, ValidationOptions{})
 }
 
 // SourceFileNames returns an array of the source file name in the manifest
@@ -66,3 +128,26 @@ func (m Manifest) SourceFileNames() (fileNames []string) {
 	}
 	return
 }
+
+// SupportsFormat reports whether the style was designed for the output format
+func (style Style) SupportsFormat(format string) bool {
+	if len(style.Formats) == 0 {
+		return true
+	}
+	for _, supported := range style.Formats {
+		if strings.EqualFold(supported, format) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindStyle returns the style using the style sheet, found is false if there is none
+func (m Manifest) FindStyle(styleSheet string) (style Style, found bool) {
+	for _, style = range m.Styles {
+		if style.StyleSheet == styleSheet {
+			return style, true
+		}
+	}
+	return Style{}, false
+}
@@ -50,6 +50,25 @@ var _ = Describe("manifest", func() {
 			})
 		})
 
+		When("a source has a sha256sum", func() {
+			It("parses it", func() {
+				theManifest, err := manifest.ParseFile(writeTmpFile(`
+sources:
+- url: http://example.com/baz.pdf
+  sha256sum: 4f7698a2562733dc3cd17a0bda13374c3f8e781d16b18631f41a506fbeb1d935
+  file_name: the_baz.pdf
+  patched_files: [baz.md]
+`))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(theManifest.Sources).To(Equal([]manifest.Source{{
+					URL:          "http://example.com/baz.pdf",
+					Sha256Sum:    "4f7698a2562733dc3cd17a0bda13374c3f8e781d16b18631f41a506fbeb1d935",
+					FileName:     "the_baz.pdf",
+					PatchedFiles: []string{"baz.md"},
+				}}))
+			})
+		})
+
 	})
 
 	Describe("Manifest", func() {
@@ -70,6 +89,26 @@ var _ = Describe("manifest", func() {
 				Expect(theManifest.SourceFileNames()).To(Equal([]string{"the_foo.pdf", "the_bar.pdf"}))
 			})
 		})
+
+		Describe("#FindStyle", func() {
+			theManifest := manifest.Manifest{
+				Styles: []manifest.Style{
+					{Name: "Regular", StyleSheet: "regular.css"},
+					{Name: "Large Print", StyleSheet: "large.css", Renderer: "chromium"},
+				},
+			}
+
+			It("returns the style using the style sheet", func() {
+				style, found := theManifest.FindStyle("large.css")
+				Expect(found).To(BeTrue())
+				Expect(style).To(Equal(manifest.Style{Name: "Large Print", StyleSheet: "large.css", Renderer: "chromium"}))
+			})
+
+			It("returns false when no style uses the style sheet", func() {
+				_, found := theManifest.FindStyle("missing.css")
+				Expect(found).To(BeFalse())
+			})
+		})
 	})
 })
 
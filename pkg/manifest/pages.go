@@ -0,0 +1,72 @@
+package manifest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PageRange is an inclusive range of 1-based page numbers
+// Last is 0 for ranges that continue to the end of the PDF (e.g. "12-")
+type PageRange struct {
+	First int
+	Last  int
+}
+
+// PageRanges is a list of page ranges like "1-4,9,12-"
+type PageRanges []PageRange
+
+// ParsePageRanges parses a comma separated list of pages and page ranges like "1-4,9,12-"
+// An empty string returns no ranges, which contain every page.
+func ParsePageRanges(pages string) (ranges PageRanges, err error) {
+	if strings.TrimSpace(pages) == "" {
+		return
+	}
+	for _, part := range strings.Split(pages, ",") {
+		var pageRange PageRange
+		part = strings.TrimSpace(part)
+		bounds := strings.SplitN(part, "-", 2)
+		pageRange.First, err = strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil || pageRange.First < 1 {
+			return nil, fmt.Errorf("invalid page range %q in %q", part, pages)
+		}
+		if len(bounds) == 1 {
+			pageRange.Last = pageRange.First
+		} else if last := strings.TrimSpace(bounds[1]); last != "" {
+			pageRange.Last, err = strconv.Atoi(last)
+			if err != nil || pageRange.Last < pageRange.First {
+				return nil, fmt.Errorf("invalid page range %q in %q", part, pages)
+			}
+		}
+		ranges = append(ranges, pageRange)
+	}
+	return
+}
+
+// Contains reports whether page is in any of the ranges (or if there are no ranges)
+func (ranges PageRanges) Contains(page int) bool {
+	if len(ranges) == 0 {
+		return true
+	}
+	for _, pageRange := range ranges {
+		if page >= pageRange.First && (pageRange.Last == 0 || page <= pageRange.Last) {
+			return true
+		}
+	}
+	return false
+}
+
+// PatchFileName returns the name of the patch file for a PDF and its page ranges
+// Including the pages in the name allows the same PDF to be used by several sources.
+func PatchFileName(pdfFileName string, pages string) string {
+	if strings.TrimSpace(pages) == "" {
+		return pdfFileName + ".patch"
+	}
+	pages = strings.Replace(strings.Replace(pages, " ", "", -1), ",", "_", -1)
+	return fmt.Sprintf("%s.pages-%s.patch", pdfFileName, pages)
+}
+
+// PatchFileName returns the name of the patch file for the source
+func (source Source) PatchFileName() string {
+	return PatchFileName(source.FileName, source.Pages)
+}
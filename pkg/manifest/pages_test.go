@@ -0,0 +1,58 @@
+package manifest_test
+
+import (
+	"github.com/motevets/pdfpatch/pkg/manifest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("page ranges", func() {
+	Describe("ParsePageRanges", func() {
+		It("parses single pages, closed ranges and open ranges", func() {
+			ranges, err := manifest.ParsePageRanges("1-4, 9,12-")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ranges).To(Equal(manifest.PageRanges{{First: 1, Last: 4}, {First: 9, Last: 9}, {First: 12}}))
+		})
+
+		It("returns no ranges for an empty string", func() {
+			ranges, err := manifest.ParsePageRanges("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ranges).To(BeEmpty())
+		})
+
+		for _, invalid := range []string{"a", "0", "4-1", "1-b", "1,,2", "-3"} {
+			invalid := invalid
+			It("rejects "+invalid, func() {
+				_, err := manifest.ParsePageRanges(invalid)
+				Expect(err).To(HaveOccurred())
+			})
+		}
+	})
+
+	Describe("PageRanges#Contains", func() {
+		It("reports whether a page is in any of the ranges", func() {
+			ranges, err := manifest.ParsePageRanges("1-4,9,12-")
+			Expect(err).NotTo(HaveOccurred())
+			for _, page := range []int{1, 4, 9, 12, 300} {
+				Expect(ranges.Contains(page)).To(BeTrue())
+			}
+			for _, page := range []int{5, 8, 10, 11} {
+				Expect(ranges.Contains(page)).To(BeFalse())
+			}
+		})
+
+		It("contains every page when there are no ranges", func() {
+			Expect(manifest.PageRanges{}.Contains(42)).To(BeTrue())
+		})
+	})
+
+	Describe("Source#PatchFileName", func() {
+		It("is named after the PDF", func() {
+			Expect(manifest.Source{FileName: "book.pdf"}.PatchFileName()).To(Equal("book.pdf.patch"))
+		})
+
+		It("includes the pages so the same PDF can be used by several sources", func() {
+			Expect(manifest.Source{FileName: "book.pdf", Pages: "3-7, 9"}.PatchFileName()).To(Equal("book.pdf.pages-3-7_9.patch"))
+		})
+	})
+})
@@ -0,0 +1,246 @@
+package manifest
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mholt/archiver"
+)
+
+// BundleLimits bounds what UnpackBundle will extract from a bundle archive
+// MaxEntries is the most files and directories the archive may contain
+// MaxFileSize is the most bytes any one file may uncompress to
+// MaxTotalSize is the most bytes all of the files may uncompress to together
+type BundleLimits struct {
+	MaxEntries   int
+	MaxFileSize  int64
+	MaxTotalSize int64
+}
+
+// DefaultBundleLimits are the limits used by UnpackBundle and VerifyBundle
+var DefaultBundleLimits = BundleLimits{
+	MaxEntries:   1000,
+	MaxFileSize:  64 << 20,
+	MaxTotalSize: 256 << 20,
+}
+
+// bundleTopLevelEntries are the only entries allowed at the top of a bundle archive
+var bundleTopLevelEntries = map[string]bool{
+	"manifest.yml":  true,
+	"manifest.json": true,
+	"manifest.toml": true,
+	"css":           true,
+	"patches":       true,
+}
+
+// InvalidBundleError is implemented by the errors returned for bundle archives that are unsafe
+// to unpack or do not have the layout of a bundle, as opposed to errors reading the archive
+type InvalidBundleError interface {
+	error
+	invalidBundle()
+}
+
+// UnsafeEntryError is returned when an entry of a bundle archive would be written outside of
+// the directory it is unpacked to, such as an absolute path, a path with "..", or a link
+type UnsafeEntryError struct {
+	Entry  string
+	Reason string
+}
+
+func (e *UnsafeEntryError) Error() string {
+	return fmt.Sprintf("unsafe entry %q in bundle: %s", e.Entry, e.Reason)
+}
+
+func (e *UnsafeEntryError) invalidBundle() {}
+
+// UnexpectedEntryError is returned when a bundle archive has an entry at its top level other
+// than its manifest (manifest.yml, manifest.json or manifest.toml), css and patches
+type UnexpectedEntryError struct {
+	Entry string
+}
+
+func (e *UnexpectedEntryError) Error() string {
+	return fmt.Sprintf("unexpected entry %q in bundle (only one of manifest.yml, manifest.json or manifest.toml, and css/ and patches/ are allowed)", e.Entry)
+}
+
+func (e *UnexpectedEntryError) invalidBundle() {}
+
+// MultipleManifestsError is returned when a bundle archive has more than one manifest, like both a
+// manifest.yml and a manifest.json
+type MultipleManifestsError struct {
+	Entries []string
+}
+
+func (e *MultipleManifestsError) Error() string {
+	return fmt.Sprintf("bundle has more than one manifest (%s)", strings.Join(e.Entries, ", "))
+}
+
+func (e *MultipleManifestsError) invalidBundle() {}
+
+// BundleLimitError is returned when a bundle archive exceeds one of its BundleLimits
+// Limit is "entries", "file size" or "total size".
+type BundleLimitError struct {
+	Entry string
+	Limit string
+	Max   int64
+}
+
+func (e *BundleLimitError) Error() string {
+	if e.Limit == "entries" {
+		return fmt.Sprintf("bundle has more than %d entries", e.Max)
+	}
+	return fmt.Sprintf("bundle exceeds the %s limit of %d bytes at %q", e.Limit, e.Max, e.Entry)
+}
+
+func (e *BundleLimitError) invalidBundle() {}
+
+// VerifyBundle checks a bundle archive can be safely unpacked within limits without extracting it
+func VerifyBundle(bundleFilePath string, limits BundleLimits) error {
+	return walkBundle(bundleFilePath, limits, func(name string, isDir bool, contents io.Reader) (err error) {
+		if !isDir {
+			_, err = io.Copy(ioutil.Discard, contents)
+		}
+		return
+	})
+}
+
+// unpackArchive extracts a bundle archive into dir, failing on the first entry that is not safe
+func unpackArchive(bundleFilePath string, dir string, limits BundleLimits) error {
+	return walkBundle(bundleFilePath, limits, func(name string, isDir bool, contents io.Reader) (err error) {
+		destination := filepath.Join(dir, filepath.FromSlash(name))
+		if isDir {
+			return os.MkdirAll(destination, 0755)
+		}
+		err = os.MkdirAll(filepath.Dir(destination), 0755)
+		if err != nil {
+			return
+		}
+		file, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return
+		}
+		defer file.Close()
+		_, err = io.Copy(file, contents)
+		return
+	})
+}
+
+// walkBundle calls visit with the cleaned name and contents of each entry of a bundle archive
+// after checking the entry is safe, stopping at the first error
+func walkBundle(bundleFilePath string, limits BundleLimits, visit func(name string, isDir bool, contents io.Reader) error) (err error) {
+	var (
+		walkErr   error
+		entries   int
+		totalSize int64
+	)
+	err = archiver.Walk(bundleFilePath, func(file archiver.File) error {
+		entries++
+		if entries > limits.MaxEntries {
+			walkErr = &BundleLimitError{Limit: "entries", Max: int64(limits.MaxEntries)}
+			return archiver.ErrStopWalk
+		}
+		var name string
+		name, walkErr = checkEntry(file)
+		if walkErr != nil {
+			return archiver.ErrStopWalk
+		}
+		if file.IsDir() {
+			walkErr = visit(name, true, nil)
+		} else {
+			fileContents := &limitReader{
+				reader:    file,
+				remaining: limits.MaxFileSize,
+				err:       &BundleLimitError{Entry: name, Limit: "file size", Max: limits.MaxFileSize},
+			}
+			contents := &limitReader{
+				reader:    fileContents,
+				remaining: limits.MaxTotalSize - totalSize,
+				err:       &BundleLimitError{Entry: name, Limit: "total size", Max: limits.MaxTotalSize},
+			}
+			walkErr = visit(name, false, contents)
+			totalSize = limits.MaxTotalSize - contents.remaining
+		}
+		if walkErr != nil {
+			return archiver.ErrStopWalk
+		}
+		return nil
+	})
+	if walkErr != nil {
+		return walkErr
+	}
+	return
+}
+
+// checkEntry returns the cleaned path of an archive entry or an error if it is not safe to extract
+func checkEntry(file archiver.File) (name string, err error) {
+	var isLink bool
+	switch header := file.Header.(type) {
+	case zip.FileHeader:
+		name = header.Name
+		isLink = header.Mode()&os.ModeSymlink != 0
+	case *tar.Header:
+		name = header.Name
+		isLink = header.Typeflag == tar.TypeSymlink || header.Typeflag == tar.TypeLink
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA && header.Typeflag != tar.TypeDir && !isLink {
+			return name, &UnsafeEntryError{Entry: name, Reason: "only files and directories are allowed"}
+		}
+	default:
+		return file.Name(), fmt.Errorf("unsupported bundle archive format")
+	}
+
+	slashed := strings.Replace(name, "\\", "/", -1)
+	switch {
+	case isLink:
+		return name, &UnsafeEntryError{Entry: name, Reason: "links are not allowed"}
+	case path.IsAbs(slashed):
+		return name, &UnsafeEntryError{Entry: name, Reason: "absolute paths are not allowed"}
+	case containsDotDot(slashed):
+		return name, &UnsafeEntryError{Entry: name, Reason: `paths with ".." are not allowed`}
+	}
+
+	cleaned := path.Clean(slashed)
+	topLevel := strings.SplitN(cleaned, "/", 2)[0]
+	if !bundleTopLevelEntries[topLevel] {
+		return name, &UnexpectedEntryError{Entry: name}
+	}
+	isDirTopLevel := topLevel == "css" || topLevel == "patches"
+	if isDirTopLevel && cleaned == topLevel && !file.IsDir() {
+		return name, &UnexpectedEntryError{Entry: name}
+	}
+	if !isDirTopLevel && (cleaned != topLevel || file.IsDir()) {
+		return name, &UnexpectedEntryError{Entry: name}
+	}
+	return cleaned, nil
+}
+
+func containsDotDot(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// limitReader fails with err once more than remaining bytes have been read
+type limitReader struct {
+	reader    io.Reader
+	remaining int64
+	err       error
+}
+
+func (r *limitReader) Read(p []byte) (n int, err error) {
+	n, err = r.reader.Read(p)
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		return n, r.err
+	}
+	return
+}
@@ -0,0 +1,101 @@
+package manifest_test
+
+import (
+	"errors"
+	"os"
+
+	"github.com/motevets/pdfpatch/pkg/manifest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("unpacking untrusted bundles", func() {
+	const maliciousBundlesDir = "../../test/fixtures/malicious_bundles/"
+
+	Describe(".UnpackBundle", func() {
+		It("rejects entries with .. in their path", func() {
+			_, err := manifest.UnpackBundle(maliciousBundlesDir + "zip_slip.zip")
+			var unsafeErr *manifest.UnsafeEntryError
+			Expect(errors.As(err, &unsafeErr)).To(BeTrue())
+			Expect(err).To(MatchError(`unsafe entry "patches/../../evil.txt" in bundle: paths with ".." are not allowed`))
+		})
+
+		It("rejects entries with absolute paths", func() {
+			_, err := manifest.UnpackBundle(maliciousBundlesDir + "absolute_path.tar")
+			var unsafeErr *manifest.UnsafeEntryError
+			Expect(errors.As(err, &unsafeErr)).To(BeTrue())
+			Expect(unsafeErr.Reason).To(Equal("absolute paths are not allowed"))
+			Expect(unsafeErr.Entry).To(Equal("/tmp/evil.txt"))
+		})
+
+		It("rejects symlinks in zip archives", func() {
+			_, err := manifest.UnpackBundle(maliciousBundlesDir + "symlink.zip")
+			var unsafeErr *manifest.UnsafeEntryError
+			Expect(errors.As(err, &unsafeErr)).To(BeTrue())
+			Expect(err).To(MatchError(`unsafe entry "css/large_print.css" in bundle: links are not allowed`))
+		})
+
+		It("rejects symlinks in tar archives before anything is written through them", func() {
+			_, err := manifest.UnpackBundle(maliciousBundlesDir + "symlink_escape.tar.gz")
+			var unsafeErr *manifest.UnsafeEntryError
+			Expect(errors.As(err, &unsafeErr)).To(BeTrue())
+			Expect(unsafeErr.Entry).To(Equal("patches/escape"))
+			_, statErr := os.Stat("/etc/evil.txt")
+			Expect(os.IsNotExist(statErr)).To(BeTrue())
+		})
+
+		It("rejects unexpected top level entries", func() {
+			_, err := manifest.UnpackBundle(maliciousBundlesDir + "stray_entry.zip")
+			var unexpectedErr *manifest.UnexpectedEntryError
+			Expect(errors.As(err, &unexpectedErr)).To(BeTrue())
+			Expect(unexpectedErr.Entry).To(Equal("evil.sh"))
+		})
+
+		It("rejects a file where the css or patches directory should be", func() {
+			_, err := manifest.UnpackBundle(maliciousBundlesDir + "css_file.zip")
+			var unexpectedErr *manifest.UnexpectedEntryError
+			Expect(errors.As(err, &unexpectedErr)).To(BeTrue())
+			Expect(unexpectedErr.Entry).To(Equal("css"))
+		})
+
+		It("stops extracting files that uncompress past the size limit", func() {
+			_, err := manifest.UnpackBundle(maliciousBundlesDir + "zip_bomb.zip")
+			var limitErr *manifest.BundleLimitError
+			Expect(errors.As(err, &limitErr)).To(BeTrue())
+			Expect(*limitErr).To(Equal(manifest.BundleLimitError{
+				Entry: "patches/title_pages.pdf.patch",
+				Limit: "file size",
+				Max:   manifest.DefaultBundleLimits.MaxFileSize,
+			}))
+		})
+
+		It("returns errors that are all InvalidBundleErrors", func() {
+			for _, bundle := range []string{"zip_slip.zip", "absolute_path.tar", "symlink.zip", "stray_entry.zip", "css_file.zip", "zip_bomb.zip"} {
+				_, err := manifest.UnpackBundle(maliciousBundlesDir + bundle)
+				var invalidErr manifest.InvalidBundleError
+				Expect(errors.As(err, &invalidErr)).To(BeTrue(), bundle)
+			}
+		})
+	})
+
+	Describe(".VerifyBundle", func() {
+		const bundlePath = "../../test/fixtures/patch_bundle.zip"
+
+		It("accepts a bundle within the limits", func() {
+			Expect(manifest.VerifyBundle(bundlePath, manifest.DefaultBundleLimits)).To(Succeed())
+		})
+
+		It("limits the number of entries", func() {
+			err := manifest.VerifyBundle(bundlePath, manifest.BundleLimits{MaxEntries: 6, MaxFileSize: 1000, MaxTotalSize: 10000})
+			Expect(err).To(MatchError("bundle has more than 6 entries"))
+		})
+
+		It("limits the total size of all files", func() {
+			err := manifest.VerifyBundle(bundlePath, manifest.BundleLimits{MaxEntries: 10, MaxFileSize: 1000, MaxTotalSize: 1000})
+			var limitErr *manifest.BundleLimitError
+			Expect(errors.As(err, &limitErr)).To(BeTrue())
+			Expect(limitErr.Limit).To(Equal("total size"))
+			Expect(limitErr.Entry).To(Equal("manifest.yml"))
+		})
+	})
+})
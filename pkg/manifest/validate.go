@@ -0,0 +1,384 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	md5Pattern    = regexp.MustCompile(`^[0-9a-fA-F]{32}$`)
+	sha256Pattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+	// languagePattern matches the shape of BCP 47 language tags like "en", "de-CH" or "zh-Hant-TW"
+	languagePattern = regexp.MustCompile(`^[A-Za-z]{2,8}(-[A-Za-z0-9]{1,8})*$`)
+	// typeErrorLine matches the line number yaml puts before the message of each type error
+	typeErrorLine = regexp.MustCompile(`^line (\d+): `)
+)
+
+// Problem is something wrong with a manifest at a line and column of its file (0 if it has no position)
+type Problem struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (problem Problem) String() string {
+	if problem.Line == 0 {
+		return problem.Message
+	}
+	return fmt.Sprintf("%d:%d: %s", problem.Line, problem.Column, problem.Message)
+}
+
+// InvalidManifestError lists every problem found in a manifest
+// A bundle with an invalid manifest is an invalid bundle.
+type InvalidManifestError struct {
+	Path     string
+	Problems []Problem
+}
+
+func (e *InvalidManifestError) Error() string {
+	lines := []string{"invalid manifest:"}
+	if e.Path != "" {
+		lines[0] = fmt.Sprintf("invalid manifest %s:", e.Path)
+	}
+	for _, problem := range e.Problems {
+		lines = append(lines, "  "+problem.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e *InvalidManifestError) invalidBundle() {}
+
+// ValidationOptions are the directories of the files a manifest refers to
+// CSSDir has the style sheets, MarkdownsDir the patched files and PatchesDir the patches of the sources.
+// The files of a directory are not checked if it is empty.
+type ValidationOptions struct {
+	CSSDir       string
+	MarkdownsDir string
+	PatchesDir   string
+}
+
+// ValidateFile parses the manifest at path like ParseFile and also checks the files it refers to exist
+// in the directories of options
+// The manifest can be YAML, JSON or TOML, see DetectEncoding. Problems in TOML manifests have no position.
+func ValidateFile(path string, options ValidationOptions) (theManifest Manifest, err error) {
+	manifestData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	root, err := parseDocument(manifestData, DetectEncoding(path, manifestData))
+	if err != nil {
+		return
+	}
+	return validateDocument(path, &root, options)
+}
+
+// validateDocument reads the manifest from the YAML document root of the file at path and checks it
+func validateDocument(path string, root *yaml.Node, options ValidationOptions) (theManifest Manifest, err error) {
+	format, problem := documentFormat(root)
+	if problem != nil {
+		return theManifest, &InvalidManifestError{Path: path, Problems: []Problem{*problem}}
+	}
+	doc := format.newDocument()
+	problems := checkKeys(root, reflect.TypeOf(doc).Elem(), "manifest")
+	err = root.Decode(doc)
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		for _, message := range typeErr.Errors {
+			problems = append(problems, typeProblem(message))
+		}
+	} else if err != nil {
+		return
+	}
+	theManifest = doc.manifest()
+	problems = append(problems, validate(theManifest, positions{root, format.keys}, options)...)
+
+	if len(problems) > 0 {
+		sort.SliceStable(problems, func(i, j int) bool {
+			return problems[i].Line < problems[j].Line || (problems[i].Line == problems[j].Line && problems[i].Column < problems[j].Column)
+		})
+		return theManifest, &InvalidManifestError{Path: path, Problems: problems}
+	}
+	return theManifest, nil
+}
+
+// ValidateBundle checks the manifest of a bundle along with its style sheets and patches
+func ValidateBundle(bundleFilePath string) (err error) {
+	bundle, err := UnpackBundle(bundleFilePath)
+	if err != nil {
+		return
+	}
+	defer bundle.Close()
+	_, err = ValidateFile(bundle.ManifestPath, ValidationOptions{CSSDir: bundle.CSSDir, PatchesDir: bundle.PatchesDir})
+	return
+}
+
+func typeProblem(message string) Problem {
+	match := typeErrorLine.FindStringSubmatch(message)
+	if match == nil {
+		return Problem{Message: message}
+	}
+	line, _ := strconv.Atoi(match[1])
+	return Problem{Line: line, Column: 1, Message: strings.TrimPrefix(message, match[0])}
+}
+
+// checkKeys reports the keys of node that are not fields of the struct type t (by their yaml names),
+// and those of the mappings within it
+func checkKeys(node *yaml.Node, t reflect.Type, context string) (problems []Problem) {
+	switch {
+	case node.Kind == yaml.DocumentNode:
+		for _, child := range node.Content {
+			problems = append(problems, checkKeys(child, t, context)...)
+		}
+	case node.Kind == yaml.SequenceNode && t.Kind() == reflect.Slice:
+		for _, item := range node.Content {
+			problems = append(problems, checkKeys(item, t.Elem(), context)...)
+		}
+	case node.Kind == yaml.MappingNode && t.Kind() == reflect.Struct:
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			field, found := fields[key.Value]
+			if !found {
+				problems = append(problems, at(key, "unknown key %q in %s%s", key.Value, context, suggestKey(key.Value, fields)))
+				continue
+			}
+			problems = append(problems, checkKeys(value, field.Type, key.Value)...)
+		}
+	}
+	return
+}
+
+// yamlFields returns the fields of a struct type by the key they are read from
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+// suggestKey returns a hint naming the known key an unknown key was probably meant to be
+// (one that starts with the other or is at most two edits away)
+func suggestKey(key string, fields map[string]reflect.StructField) string {
+	var names []string
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.HasPrefix(name, key) || strings.HasPrefix(key, name) || editDistance(key, name) <= 2 {
+			return fmt.Sprintf(" (did you mean %q?)", name)
+		}
+	}
+	return ""
+}
+
+// editDistance is the number of characters that have to be inserted, deleted or replaced to turn a into b
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func minInt(first int, rest ...int) int {
+	for _, n := range rest {
+		if n < first {
+			first = n
+		}
+	}
+	return first
+}
+
+// validate checks the values of a manifest and the files it refers to
+func validate(theManifest Manifest, where positions, options ValidationOptions) (problems []Problem) {
+	add := func(node *yaml.Node, format string, args ...interface{}) {
+		problems = append(problems, at(node, format, args...))
+	}
+
+	if len(theManifest.Sources) == 0 {
+		add(where.root(), "manifest has no sources")
+	}
+	if language := theManifest.Book.Language; language != "" && !languagePattern.MatchString(language) {
+		add(where.key(where.root(), "book.language"), "book language %q is not a BCP 47 language tag like en or de-CH", language)
+	}
+	firstSource := map[string]*yaml.Node{}
+	for i, source := range theManifest.Sources {
+		node := where.item("sources", i)
+		name := source.FileName
+		if source.Pages != "" {
+			name += " (pages " + source.Pages + ")"
+		}
+		switch {
+		case source.FileName == "":
+			add(node, "source %d has no file_name", i+1)
+		case !isFileName(source.FileName):
+			add(where.key(node, "file_name"), "file_name %q must be a file name without a directory", source.FileName)
+		}
+		if first, found := firstSource[name]; found && source.FileName != "" {
+			add(node, "source %s is listed more than once (first at line %d)", name, line(first))
+		} else {
+			firstSource[name] = node
+		}
+		if source.Md5Sum != "" && !md5Pattern.MatchString(source.Md5Sum) {
+			add(where.key(node, "md5sum"), "md5sum %q of source %s is not a hex md5 hash", source.Md5Sum, name)
+		}
+		if source.Sha256Sum != "" && !sha256Pattern.MatchString(source.Sha256Sum) {
+			add(where.key(node, "sha256sum"), "sha256sum %q of source %s is not a hex sha256 hash", source.Sha256Sum, name)
+		}
+		if source.Pages != "" {
+			if _, err := ParsePageRanges(source.Pages); err != nil {
+				add(where.key(node, "pages"), "pages of source %s: %v", name, err)
+			}
+		}
+		if len(source.PatchedFiles) == 0 {
+			add(node, "source %s has no patched_files", name)
+		}
+		for j, patchedFile := range source.PatchedFiles {
+			fileNode := where.keyItem(node, "patched_files", j)
+			if !isFileName(patchedFile) {
+				add(fileNode, "patched file %q of source %s must be a file name without a directory", patchedFile, name)
+			} else if options.MarkdownsDir != "" && !fileExists(path.Join(options.MarkdownsDir, patchedFile)) {
+				add(fileNode, "patched file %s of source %s is not in %s", patchedFile, name, options.MarkdownsDir)
+			}
+		}
+		if options.PatchesDir != "" && source.FileName != "" && !fileExists(path.Join(options.PatchesDir, source.PatchFileName())) {
+			add(node, "patch %s of source %s is missing", source.PatchFileName(), name)
+		}
+	}
+
+	firstStyleSheet := map[string]*yaml.Node{}
+	for i, style := range theManifest.Styles {
+		node := where.item("styles", i)
+		if style.Name == "" {
+			add(node, "style %d has no name", i+1)
+		}
+		switch {
+		case style.StyleSheet == "":
+			add(node, "style %d has no style_sheet", i+1)
+			continue
+		case !isFileName(style.StyleSheet):
+			add(where.key(node, "style_sheet"), "style_sheet %q must be a file name without a directory", style.StyleSheet)
+			continue
+		}
+		if first, found := firstStyleSheet[style.StyleSheet]; found {
+			add(where.key(node, "style_sheet"), "style sheet %s is used by more than one style (first at line %d)", style.StyleSheet, line(first))
+		} else {
+			firstStyleSheet[style.StyleSheet] = node
+		}
+		if options.CSSDir != "" && !fileExists(path.Join(options.CSSDir, style.StyleSheet)) {
+			add(where.key(node, "style_sheet"), "style sheet %s is not in %s", style.StyleSheet, options.CSSDir)
+		}
+	}
+	return
+}
+
+func isFileName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+func fileExists(filePath string) bool {
+	info, err := os.Stat(filePath)
+	return err == nil && !info.IsDir()
+}
+
+// positions finds the nodes of the parts of a manifest in its YAML, or nil if there are none
+// keys maps the keys of version 1 to their path in the version of the manifest, like "checksums.md5".
+type positions struct {
+	document *yaml.Node
+	keys     map[string]string
+}
+
+func (where positions) root() *yaml.Node {
+	if where.document == nil || len(where.document.Content) == 0 {
+		return where.document
+	}
+	return where.document.Content[0]
+}
+
+// item returns the node of item i of the list under key at the top of the manifest
+func (where positions) item(key string, i int) *yaml.Node {
+	return where.keyItem(where.root(), key, i)
+}
+
+// keyItem returns the node of item i of the list under key in mapping
+func (where positions) keyItem(mapping *yaml.Node, key string, i int) *yaml.Node {
+	list := mappingValue(mapping, key)
+	if list == nil || list.Kind != yaml.SequenceNode || i >= len(list.Content) {
+		return mapping
+	}
+	return list.Content[i]
+}
+
+// key returns the value of key in mapping, or mapping if it has no such key
+func (where positions) key(mapping *yaml.Node, key string) *yaml.Node {
+	if keyPath, found := where.keys[key]; found {
+		key = keyPath
+	}
+	value := mapping
+	for _, part := range strings.Split(key, ".") {
+		if value = mappingValue(value, part); value == nil {
+			return mapping
+		}
+	}
+	return value
+}
+
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// at returns a problem at the position of node
+func at(node *yaml.Node, format string, args ...interface{}) Problem {
+	problem := Problem{Message: fmt.Sprintf(format, args...)}
+	if node != nil {
+		problem.Line, problem.Column = node.Line, node.Column
+	}
+	return problem
+}
+
+func line(node *yaml.Node) int {
+	if node == nil {
+		return 0
+	}
+	return node.Line
+}
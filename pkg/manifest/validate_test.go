@@ -0,0 +1,117 @@
+package manifest_test
+
+import (
+	"errors"
+	"os"
+
+	"github.com/motevets/pdfpatch/pkg/manifest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const invalidManifest = `sources:
+- url: http://example.com/foo.pdf
+  file_name: foo.pdf
+  md5sum: not-a-hash
+  patched_file: [foo.md]
+- url: http://example.com/bar.pdf
+  patched_files: [bar.md]
+- file_name: foo.pdf
+  pages: 3-1
+  patched_files: [../foo.md]
+- file_name: foo.pdf
+  patched_files: [baz.md]
+styles:
+- name: Regular
+  style_sheet: book.css
+- description: no name
+  style_sheet: book.css
+`
+
+var _ = Describe("validation", func() {
+	problemsOf := func(err error) []string {
+		var invalid *manifest.InvalidManifestError
+		Expect(errors.As(err, &invalid)).To(BeTrue(), "expected an InvalidManifestError, got %v", err)
+		var problems []string
+		for _, problem := range invalid.Problems {
+			problems = append(problems, problem.String())
+		}
+		return problems
+	}
+
+	Describe("ParseFile", func() {
+		It("reports every problem in the manifest with its line and column", func() {
+			manifestFilePath := writeTmpFile(invalidManifest)
+			defer os.Remove(manifestFilePath)
+
+			_, err := manifest.ParseFile(manifestFilePath)
+			Expect(problemsOf(err)).To(Equal([]string{
+				`2:3: source foo.pdf has no patched_files`,
+				`4:11: md5sum "not-a-hash" of source foo.pdf is not a hex md5 hash`,
+				`5:3: unknown key "patched_file" in sources (did you mean "patched_files"?)`,
+				`6:3: source 2 has no file_name`,
+				`9:10: pages of source foo.pdf (pages 3-1): invalid page range "3-1" in "3-1"`,
+				`10:19: patched file "../foo.md" of source foo.pdf (pages 3-1) must be a file name without a directory`,
+				`11:3: source foo.pdf is listed more than once (first at line 2)`,
+				`16:3: style 2 has no name`,
+				`17:16: style sheet book.css is used by more than one style (first at line 14)`,
+			}))
+		})
+
+		It("reports values of the wrong type", func() {
+			manifestFilePath := writeTmpFile("sources:\n- file_name: foo.pdf\n  patched_files: foo.md\n")
+			defer os.Remove(manifestFilePath)
+
+			_, err := manifest.ParseFile(manifestFilePath)
+			problems := problemsOf(err)
+			Expect(problems).To(HaveLen(2))
+			Expect(problems[0]).To(HavePrefix("2:3: source foo.pdf has no patched_files"))
+			Expect(problems[1]).To(HavePrefix("3:1: cannot unmarshal"))
+		})
+
+		It("accepts a manifest without optional keys", func() {
+			manifestFilePath := writeTmpFile("sources:\n- file_name: foo.pdf\n  patched_files: [foo.md]\n")
+			defer os.Remove(manifestFilePath)
+
+			_, err := manifest.ParseFile(manifestFilePath)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Describe("ValidateFile", func() {
+		const fixturesPath = "../../test/fixtures/multiple_patches"
+
+		It("accepts a manifest whose files exist", func() {
+			_, err := manifest.ValidateFile(fixturesPath+"/manifest.yml", manifest.ValidationOptions{
+				MarkdownsDir: fixturesPath + "/markdowns",
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("reports patched files and style sheets that are missing", func() {
+			manifestFilePath := writeTmpFile(`sources:
+- file_name: title_pages.pdf
+  patched_files: [title.md, preface.md]
+styles:
+- name: Regular
+  style_sheet: book.css
+`)
+			defer os.Remove(manifestFilePath)
+
+			_, err := manifest.ValidateFile(manifestFilePath, manifest.ValidationOptions{
+				CSSDir:       fixturesPath + "/css",
+				MarkdownsDir: fixturesPath + "/markdowns",
+			})
+			Expect(problemsOf(err)).To(Equal([]string{
+				`3:29: patched file preface.md of source title_pages.pdf is not in ` + fixturesPath + `/markdowns`,
+				`6:16: style sheet book.css is not in ` + fixturesPath + `/css`,
+			}))
+		})
+	})
+
+	Describe("ValidateBundle", func() {
+		It("accepts a valid bundle", func() {
+			Expect(manifest.ValidateBundle("../../test/fixtures/patch_bundle.zip")).To(Succeed())
+		})
+	})
+})
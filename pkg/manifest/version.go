@@ -0,0 +1,280 @@
+package manifest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the version of the manifest format written by pdfpatch
+//
+// Version 1 (manifests without a version key) has sources with flat checksums, extractor and pages keys:
+//
+//	sources:
+//	- file_name: foo.pdf
+//	  md5sum: a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1
+//	  extractor: pdftotext
+//	  extractor_version: 22.12.0
+//	  pages: 1-4,9,12-
+//	  patched_files: [foo.md]
+//
+// Version 2 adds metadata about the book and the bundle and the formats of each style, and groups the
+// checksums and extractor pin of each source, see Manifest.
+const CurrentVersion = 2
+
+// manifestFormat is how a version of the manifest format is read
+// newDocument returns a pointer to the type the YAML of the version is decoded into, and keys maps the
+// keys of version 1 used to report problems to their path in the version.
+type manifestFormat struct {
+	newDocument func() document
+	keys        map[string]string
+}
+
+// document is the YAML of a version of the manifest format
+type document interface {
+	manifest() Manifest
+}
+
+var manifestFormats = map[int]manifestFormat{
+	1: {newDocument: func() document { return &documentV1{} }},
+	2: {
+		newDocument: func() document { return &documentV2{} },
+		keys:        map[string]string{"md5sum": "checksums.md5", "sha256sum": "checksums.sha256"},
+	},
+}
+
+type documentV1 struct {
+	Version int `yaml:",omitempty"`
+	Sources []sourceV1
+	Styles  []styleV1
+}
+
+type sourceV1 struct {
+	URL              string   `yaml:",omitempty"`
+	FileName         string   `yaml:"file_name"`
+	Md5Sum           string   `yaml:",omitempty"`
+	Sha256Sum        string   `yaml:"sha256sum,omitempty"`
+	PatchedFiles     []string `yaml:"patched_files"`
+	Extractor        string   `yaml:",omitempty"`
+	ExtractorVersion string   `yaml:"extractor_version,omitempty"`
+	Pages            string   `yaml:",omitempty"`
+}
+
+type styleV1 struct {
+	Name        string
+	Description string `yaml:",omitempty"`
+	StyleSheet  string `yaml:"style_sheet"`
+	Renderer    string `yaml:",omitempty"`
+}
+
+func (doc *documentV1) manifest() (theManifest Manifest) {
+	theManifest.Version = 1
+	for _, source := range doc.Sources {
+		theManifest.Sources = append(theManifest.Sources, Source(source))
+	}
+	for _, style := range doc.Styles {
+		theManifest.Styles = append(theManifest.Styles, Style{
+			Name:        style.Name,
+			Description: style.Description,
+			StyleSheet:  style.StyleSheet,
+			Renderer:    style.Renderer,
+		})
+	}
+	return
+}
+
+type documentV2 struct {
+	Version  int
+	Book     *Book     `yaml:",omitempty"`
+	Metadata *Metadata `yaml:",omitempty"`
+	Sources  []sourceV2
+	Styles   []styleV2 `yaml:",omitempty"`
+}
+
+type sourceV2 struct {
+	FileName     string        `yaml:"file_name"`
+	URL          string        `yaml:",omitempty"`
+	Checksums    *checksumsV2  `yaml:",omitempty"`
+	Extractor    *extractorPin `yaml:",omitempty"`
+	Pages        []string      `yaml:",omitempty"`
+	PatchedFiles []string      `yaml:"patched_files"`
+}
+
+type checksumsV2 struct {
+	MD5    string `yaml:"md5,omitempty"`
+	SHA256 string `yaml:"sha256,omitempty"`
+}
+
+type extractorPin struct {
+	Name    string
+	Version string `yaml:",omitempty"`
+}
+
+type styleV2 struct {
+	Name        string
+	Description string   `yaml:",omitempty"`
+	StyleSheet  string   `yaml:"style_sheet"`
+	Renderer    string   `yaml:",omitempty"`
+	Formats     []string `yaml:",omitempty"`
+}
+
+func (doc *documentV2) manifest() (theManifest Manifest) {
+	theManifest.Version = 2
+	if doc.Book != nil {
+		theManifest.Book = *doc.Book
+	}
+	if doc.Metadata != nil {
+		theManifest.Metadata = *doc.Metadata
+	}
+	for _, source := range doc.Sources {
+		converted := Source{
+			URL:          source.URL,
+			FileName:     source.FileName,
+			PatchedFiles: source.PatchedFiles,
+			Pages:        strings.Join(source.Pages, ","),
+		}
+		if source.Checksums != nil {
+			converted.Md5Sum, converted.Sha256Sum = source.Checksums.MD5, source.Checksums.SHA256
+		}
+		if source.Extractor != nil {
+			converted.Extractor, converted.ExtractorVersion = source.Extractor.Name, source.Extractor.Version
+		}
+		theManifest.Sources = append(theManifest.Sources, converted)
+	}
+	for _, style := range doc.Styles {
+		theManifest.Styles = append(theManifest.Styles, Style(style))
+	}
+	return
+}
+
+// currentDocument returns the manifest in the current version of the format
+func currentDocument(theManifest Manifest) (doc documentV2) {
+	doc.Version = CurrentVersion
+	if !theManifest.Book.IsZero() {
+		book := theManifest.Book
+		doc.Book = &book
+	}
+	if !theManifest.Metadata.isEmpty() {
+		metadata := theManifest.Metadata
+		doc.Metadata = &metadata
+	}
+	for _, source := range theManifest.Sources {
+		converted := sourceV2{
+			FileName:     source.FileName,
+			URL:          source.URL,
+			PatchedFiles: source.PatchedFiles,
+		}
+		if source.Md5Sum != "" || source.Sha256Sum != "" {
+			converted.Checksums = &checksumsV2{MD5: source.Md5Sum, SHA256: source.Sha256Sum}
+		}
+		if source.Extractor != "" || source.ExtractorVersion != "" {
+			converted.Extractor = &extractorPin{Name: source.Extractor, Version: source.ExtractorVersion}
+		}
+		for _, pageRange := range strings.Split(source.Pages, ",") {
+			if pageRange = strings.TrimSpace(pageRange); pageRange != "" {
+				converted.Pages = append(converted.Pages, pageRange)
+			}
+		}
+		doc.Sources = append(doc.Sources, converted)
+	}
+	for _, style := range theManifest.Styles {
+		doc.Styles = append(doc.Styles, styleV2(style))
+	}
+	return
+}
+
+// MarshalYAML writes the manifest in the current version of the format whatever version it was read from
+func (m Manifest) MarshalYAML() (interface{}, error) {
+	return currentDocument(m), nil
+}
+
+// Marshal returns the YAML of the manifest in the current version of the format
+func Marshal(theManifest Manifest) (manifestData []byte, err error) {
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	err = encoder.Encode(theManifest)
+	if err != nil {
+		return
+	}
+	err = encoder.Close()
+	return buffer.Bytes(), err
+}
+
+// WriteFile writes the manifest to path in the current version of the format
+// The encoding is that of the extension of path, YAML for other extensions.
+func WriteFile(path string, theManifest Manifest) (err error) {
+	encoding, known := EncodingOfPath(path)
+	if !known {
+		encoding = YAML
+	}
+	return WriteFileAs(path, theManifest, encoding)
+}
+
+// WriteFileAs writes the manifest to path in the current version of the format written in the encoding
+func WriteFileAs(path string, theManifest Manifest, encoding Encoding) (err error) {
+	manifestData, err := MarshalAs(theManifest, encoding)
+	if err != nil {
+		return
+	}
+	return ioutil.WriteFile(path, manifestData, 0644)
+}
+
+// UpgradeFile rewrites the manifest at path in the current version of the format and returns the version
+// it was in. A manifest that is already current is left as it is. Comments in the manifest are not kept.
+// The manifest keeps its encoding.
+func UpgradeFile(path string) (fromVersion int, err error) {
+	manifestData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	theManifest, err := ParseFile(path)
+	if err != nil {
+		return
+	}
+	fromVersion = theManifest.Version
+	if fromVersion == CurrentVersion {
+		return
+	}
+	err = WriteFileAs(path, theManifest, DetectEncoding(path, manifestData))
+	return
+}
+
+// ConvertFile writes the manifest at inputPath to outputPath in the current version of the format written
+// in the encoding. Comments in the manifest are not kept.
+func ConvertFile(inputPath string, outputPath string, encoding Encoding) (err error) {
+	theManifest, err := ParseFile(inputPath)
+	if err != nil {
+		return
+	}
+	return WriteFileAs(outputPath, theManifest, encoding)
+}
+
+// documentFormat returns the format of the version of the manifest in root, or a problem if the version
+// is not one pdfpatch knows
+// Manifests without a version key are version 1.
+func documentFormat(root *yaml.Node) (format manifestFormat, problem *Problem) {
+	versionNode := mappingValue(positions{document: root}.root(), "version")
+	if versionNode == nil {
+		return manifestFormats[1], nil
+	}
+	version, err := strconv.Atoi(versionNode.Value)
+	if err != nil || versionNode.Kind != yaml.ScalarNode {
+		found := at(versionNode, "version must be a number")
+		return format, &found
+	}
+	format, known := manifestFormats[version]
+	if !known {
+		unknown := at(versionNode, "unknown manifest version %d (this pdfpatch reads versions 1 to %d)", version, CurrentVersion)
+		return format, &unknown
+	}
+	return format, nil
+}
+
+func (metadata Metadata) isEmpty() bool {
+	return metadata.Name == "" && metadata.Description == "" && len(metadata.Authors) == 0 &&
+		metadata.License == "" && metadata.Homepage == ""
+}
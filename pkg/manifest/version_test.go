@@ -0,0 +1,162 @@
+package manifest_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/motevets/pdfpatch/pkg/manifest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const version1Manifest = `sources:
+- url: http://example.com/foo.pdf
+  file_name: foo.pdf
+  md5sum: 2b00042f7481c7b056c4b410d28f33cf
+  extractor: gopdf
+  extractor_version: ledongthuc-pdf-20200323.1
+  pages: 1-4,9
+  patched_files: [foo.md]
+styles:
+- name: Regular
+  style_sheet: book.css
+  renderer: weasyprint
+`
+
+const version2Manifest = `version: 2
+metadata:
+  name: Foo, corrected
+  authors: [Jane Doe]
+  license: CC-BY-4.0
+sources:
+- file_name: foo.pdf
+  url: http://example.com/foo.pdf
+  checksums:
+    md5: 2b00042f7481c7b056c4b410d28f33cf
+  extractor:
+    name: gopdf
+    version: ledongthuc-pdf-20200323.1
+  pages: [1-4, 9]
+  patched_files: [foo.md]
+styles:
+- name: Regular
+  style_sheet: book.css
+  renderer: weasyprint
+  formats: [pdf]
+`
+
+var _ = Describe("manifest versions", func() {
+	var expectedSource = manifest.Source{
+		URL:              "http://example.com/foo.pdf",
+		FileName:         "foo.pdf",
+		Md5Sum:           "2b00042f7481c7b056c4b410d28f33cf",
+		PatchedFiles:     []string{"foo.md"},
+		Extractor:        "gopdf",
+		ExtractorVersion: "ledongthuc-pdf-20200323.1",
+		Pages:            "1-4,9",
+	}
+
+	parse := func(content string) (manifest.Manifest, error) {
+		manifestFilePath := writeTmpFile(content)
+		defer os.Remove(manifestFilePath)
+		return manifest.ParseFile(manifestFilePath)
+	}
+
+	Describe("ParseFile", func() {
+		It("reads a manifest without a version as version 1", func() {
+			theManifest, err := parse(version1Manifest)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(theManifest.Version).To(Equal(1))
+			Expect(theManifest.Sources).To(Equal([]manifest.Source{expectedSource}))
+			Expect(theManifest.Styles).To(Equal([]manifest.Style{{Name: "Regular", StyleSheet: "book.css", Renderer: "weasyprint"}}))
+		})
+
+		It("reads a version 2 manifest into the same model", func() {
+			theManifest, err := parse(version2Manifest)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(theManifest.Version).To(Equal(2))
+			Expect(theManifest.Metadata).To(Equal(manifest.Metadata{
+				Name:    "Foo, corrected",
+				Authors: []string{"Jane Doe"},
+				License: "CC-BY-4.0",
+			}))
+			Expect(theManifest.Sources).To(Equal([]manifest.Source{expectedSource}))
+			Expect(theManifest.Styles).To(Equal([]manifest.Style{{Name: "Regular", StyleSheet: "book.css", Renderer: "weasyprint", Formats: []string{"pdf"}}}))
+		})
+
+		It("reads the book of a version 2 manifest", func() {
+			theManifest, err := parse("version: 2\nbook:\n  title: Foo\n  subtitle: A Story\n  authors: [Jane Doe]\n  language: en-GB\nsources:\n- file_name: foo.pdf\n  patched_files: [foo.md]\n")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(theManifest.Book).To(Equal(manifest.Book{
+				Title:    "Foo",
+				Subtitle: "A Story",
+				Authors:  []string{"Jane Doe"},
+				Language: "en-GB",
+			}))
+		})
+
+		It("rejects a book language that is not a language tag", func() {
+			_, err := parse("version: 2\nbook:\n  language: English (UK)\nsources:\n- file_name: foo.pdf\n  patched_files: [foo.md]\n")
+			Expect(err).To(MatchError(ContainSubstring("3:13:")))
+		})
+
+		It("rejects keys of a different version", func() {
+			_, err := parse("version: 2\nsources:\n- file_name: foo.pdf\n  md5sum: 2b00042f7481c7b056c4b410d28f33cf\n  patched_files: [foo.md]\n")
+			Expect(err).To(MatchError(ContainSubstring(`4:3: unknown key "md5sum" in sources`)))
+		})
+
+		It("reports problems at their key in version 2", func() {
+			_, err := parse("version: 2\nsources:\n- file_name: foo.pdf\n  checksums:\n    md5: abc\n  patched_files: [foo.md]\n")
+			Expect(err).To(MatchError(ContainSubstring(`5:10: md5sum "abc" of source foo.pdf is not a hex md5 hash`)))
+		})
+
+		It("rejects versions it does not know", func() {
+			_, err := parse("version: 3\nsources: []\n")
+			Expect(err).To(MatchError(ContainSubstring("1:10: unknown manifest version 3 (this pdfpatch reads versions 1 to 2)")))
+		})
+	})
+
+	Describe("Marshal", func() {
+		It("writes the current version which reads back into the same manifest", func() {
+			theManifest, err := parse(version1Manifest)
+			Expect(err).NotTo(HaveOccurred())
+
+			manifestData, err := manifest.Marshal(theManifest)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(manifestData)).To(HavePrefix("version: 2\n"))
+
+			reread, err := parse(string(manifestData))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reread.Version).To(Equal(manifest.CurrentVersion))
+			reread.Version = theManifest.Version
+			Expect(reread).To(Equal(theManifest))
+		})
+	})
+
+	Describe("UpgradeFile", func() {
+		It("rewrites an old manifest in the current version", func() {
+			manifestFilePath := writeTmpFile(version1Manifest)
+			defer os.Remove(manifestFilePath)
+
+			fromVersion, err := manifest.UpgradeFile(manifestFilePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fromVersion).To(Equal(1))
+			theManifest, err := manifest.ParseFile(manifestFilePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(theManifest.Version).To(Equal(manifest.CurrentVersion))
+			Expect(theManifest.Sources).To(Equal([]manifest.Source{expectedSource}))
+		})
+
+		It("leaves a current manifest as it is", func() {
+			manifestFilePath := writeTmpFile(version2Manifest)
+			defer os.Remove(manifestFilePath)
+
+			fromVersion, err := manifest.UpgradeFile(manifestFilePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fromVersion).To(Equal(manifest.CurrentVersion))
+			content, err := ioutil.ReadFile(manifestFilePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal(version2Manifest))
+		})
+	})
+})
@@ -0,0 +1,297 @@
+package pdfbinder
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/ledongthuc/pdf"
+)
+
+var (
+	startXrefPattern = regexp.MustCompile(`startxref\s+(\d+)\s*%%EOF\s*$`)
+	sizePattern      = regexp.MustCompile(`/Size\s+(\d+)`)
+	rootPattern      = regexp.MustCompile(`/Root\s+(\d+)\s+(\d+)\s+R`)
+	idPattern        = regexp.MustCompile(`/ID\s*\[[^\]]*\]`)
+	metadataPattern  = regexp.MustCompile(`/Metadata\s+\d+\s+\d+\s+R`)
+	objStmPattern    = regexp.MustCompile(`/Type\s*/ObjStm`)
+	firstPattern     = regexp.MustCompile(`/First\s+(\d+)`)
+)
+
+// infoEntries are the entries of the document information dictionary for the metadata
+// The identifier, publisher and rights have no standard entry so they are written as custom entries.
+func (metadata Metadata) infoEntries() map[string]string {
+	entries := map[string]string{}
+	for key, value := range map[string]string{
+		"Title":      metadata.fullTitle(),
+		"Author":     strings.Join(metadata.Authors, ", "),
+		"Subject":    metadata.Description,
+		"Identifier": metadata.Identifier,
+		"Publisher":  metadata.Publisher,
+		"Rights":     metadata.Rights,
+	} {
+		if value != "" {
+			entries[key] = value
+		}
+	}
+	return entries
+}
+
+// WriteInfo writes the metadata into the document information dictionary and the XMP metadata stream
+// of the PDF at pdfPath
+// The PDF gets an incremental update with a new dictionary that keeps the string entries of the old one
+// the metadata does not replace, like the Producer written by the renderer, a new metadata stream and
+// the catalog pointing at it. The update has a cross reference table or stream like the one before it.
+func WriteInfo(pdfPath string, metadata Metadata) (err error) {
+	data, err := ioutil.ReadFile(pdfPath)
+	if err != nil {
+		return
+	}
+	match := startXrefPattern.FindSubmatch(data)
+	if match == nil {
+		return fmt.Errorf("%s has no startxref", pdfPath)
+	}
+	prevXref, _ := strconv.Atoi(string(match[1]))
+	if prevXref >= len(data) {
+		return fmt.Errorf("%s has a startxref past its end", pdfPath)
+	}
+	trailer, isStream := trailerDictionary(data[prevXref:])
+	if bytes.Contains(trailer, []byte("/Encrypt")) {
+		return fmt.Errorf("cannot write metadata into encrypted PDF %s", pdfPath)
+	}
+	sizeMatch, rootMatch := sizePattern.FindSubmatch(trailer), rootPattern.FindSubmatch(trailer)
+	if sizeMatch == nil || rootMatch == nil {
+		return fmt.Errorf("%s has no /Size or /Root in its trailer", pdfPath)
+	}
+	infoNumber, _ := strconv.Atoi(string(sizeMatch[1]))
+	xmpNumber := infoNumber + 1
+	rootNumber, _ := strconv.Atoi(string(rootMatch[1]))
+	rootGeneration, _ := strconv.Atoi(string(rootMatch[2]))
+	catalog, err := objectDictionary(data, rootNumber, rootGeneration)
+	if err != nil {
+		return
+	}
+	if catalog == nil {
+		return fmt.Errorf("%s has no catalog dictionary", pdfPath)
+	}
+	catalog = metadataPattern.ReplaceAll(catalog, nil)
+	catalog = append(catalog[:len(catalog)-2:len(catalog)-2], fmt.Sprintf("/Metadata %d 0 R>>", xmpNumber)...)
+
+	entries, err := oldInfoEntries(data)
+	if err != nil {
+		return
+	}
+	for key, value := range metadata.infoEntries() {
+		entries[key] = value
+	}
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var update bytes.Buffer
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		update.WriteByte('\n')
+	}
+	infoOffset := len(data) + update.Len()
+	fmt.Fprintf(&update, "%d 0 obj\n<<", infoNumber)
+	for _, key := range keys {
+		fmt.Fprintf(&update, "/%s %s", key, pdfString(entries[key]))
+	}
+	update.WriteString(">>\nendobj\n")
+	xmpOffset := len(data) + update.Len()
+	xmp := metadata.xmp()
+	fmt.Fprintf(&update, "%d 0 obj\n<</Type/Metadata/Subtype/XML/Length %d>>\nstream\n", xmpNumber, len(xmp))
+	update.Write(xmp)
+	update.WriteString("\nendstream\nendobj\n")
+	catalogOffset := len(data) + update.Len()
+	fmt.Fprintf(&update, "%d %d obj\n%s\nendobj\n", rootNumber, rootGeneration, catalog)
+
+	xrefOffset := len(data) + update.Len()
+	trailerEntries := fmt.Sprintf("/Root %d %d R/Info %d 0 R/Prev %d", rootNumber, rootGeneration, infoNumber, prevXref)
+	if id := idPattern.Find(trailer); id != nil {
+		trailerEntries += string(id)
+	}
+	// the catalog always has a lower number than the new objects, so its subsection comes first
+	if isStream {
+		// entries of type 1 (in use) with a 4 byte offset and a 2 byte generation for the catalog, the
+		// info, the metadata stream and the cross reference stream
+		var xrefEntries bytes.Buffer
+		for i, offset := range []int{catalogOffset, infoOffset, xmpOffset, xrefOffset} {
+			generation := 0
+			if i == 0 {
+				generation = rootGeneration
+			}
+			xrefEntries.WriteByte(1)
+			binary.Write(&xrefEntries, binary.BigEndian, uint32(offset))
+			binary.Write(&xrefEntries, binary.BigEndian, uint16(generation))
+		}
+		fmt.Fprintf(&update, "%d 0 obj\n<</Type/XRef/Size %d/W[1 4 2]/Index[%d 1 %d 3]%s/Length %d>>\nstream\n",
+			xmpNumber+1, xmpNumber+2, rootNumber, infoNumber, trailerEntries, xrefEntries.Len())
+		update.Write(xrefEntries.Bytes())
+		update.WriteString("\nendstream\nendobj\n")
+	} else {
+		fmt.Fprintf(&update, "xref\n%d 1\n%010d %05d n \n%d 2\n%010d 00000 n \n%010d 00000 n \ntrailer\n<</Size %d%s>>\n",
+			rootNumber, catalogOffset, rootGeneration, infoNumber, infoOffset, xmpOffset, xmpNumber+1, trailerEntries)
+	}
+	fmt.Fprintf(&update, "startxref\n%d\n%%%%EOF\n", xrefOffset)
+
+	pdfFile, err := os.OpenFile(pdfPath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	_, err = pdfFile.Write(update.Bytes())
+	if closeErr := pdfFile.Close(); err == nil {
+		err = closeErr
+	}
+	return
+}
+
+// trailerDictionary returns the text of the trailer of the cross reference section at the start of
+// data, which is the dictionary of the stream for cross reference streams
+func trailerDictionary(data []byte) (trailer []byte, isStream bool) {
+	end := bytes.Index(data, []byte("startxref"))
+	if end < 0 {
+		end = len(data)
+	}
+	if bytes.HasPrefix(data, []byte("xref")) {
+		start := bytes.Index(data[:end], []byte("trailer"))
+		if start < 0 {
+			return nil, false
+		}
+		return data[start:end], false
+	}
+	if streamStart := bytes.Index(data[:end], []byte("stream")); streamStart >= 0 {
+		end = streamStart
+	}
+	return data[:end], true
+}
+
+// objectDictionary returns the text of the last definition of the dictionary object with number and
+// generation in data, written directly or compressed in an object stream, or nil if there is none
+func objectDictionary(data []byte, number int, generation int) (dictionary []byte, err error) {
+	position := -1
+	pattern := regexp.MustCompile(fmt.Sprintf(`(?s)(?:^|\D)%d\s+%d\s+obj\s*(<<.*?>>)\s*endobj`, number, generation))
+	if matches := pattern.FindAllSubmatchIndex(data, -1); matches != nil {
+		match := matches[len(matches)-1]
+		position, dictionary = match[0], data[match[2]:match[3]]
+	}
+	if generation != 0 {
+		// objects in object streams have generation 0
+		return
+	}
+	for _, match := range objStmPattern.FindAllIndex(data, -1) {
+		if match[0] < position {
+			continue
+		}
+		compressed, err := objectStreamDictionary(data, match[0], number)
+		if err != nil {
+			return nil, err
+		}
+		if compressed != nil {
+			position, dictionary = match[0], compressed
+		}
+	}
+	return
+}
+
+// objectStreamDictionary returns the text of the dictionary object with number in the object stream whose
+// /Type entry is at typeOffset in data, or nil if the stream does not hold it
+func objectStreamDictionary(data []byte, typeOffset int, number int) (dictionary []byte, err error) {
+	dictionaryStart := bytes.LastIndex(data[:typeOffset], []byte("obj"))
+	streamKeyword := bytes.Index(data[typeOffset:], []byte("stream"))
+	if dictionaryStart < 0 || streamKeyword < 0 {
+		return nil, nil
+	}
+	header := data[dictionaryStart : typeOffset+streamKeyword]
+	content := bytes.TrimPrefix(bytes.TrimPrefix(data[typeOffset+streamKeyword+len("stream"):], []byte("\r")), []byte("\n"))
+	if end := bytes.Index(content, []byte("endstream")); end >= 0 {
+		content = content[:end]
+	}
+	if bytes.Contains(header, []byte("/FlateDecode")) {
+		zlibReader, err := zlib.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+		if content, err = ioutil.ReadAll(zlibReader); err != nil {
+			return nil, err
+		}
+	} else if bytes.Contains(header, []byte("/Filter")) {
+		return nil, nil
+	}
+	firstMatch := firstPattern.FindSubmatch(header)
+	if firstMatch == nil {
+		return nil, nil
+	}
+	first, _ := strconv.Atoi(string(firstMatch[1]))
+	if first > len(content) {
+		return nil, nil
+	}
+	// the stream starts with pairs of the number of each object and its offset from first
+	pairs := strings.Fields(string(content[:first]))
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i] != strconv.Itoa(number) {
+			continue
+		}
+		start, _ := strconv.Atoi(pairs[i+1])
+		end := len(content) - first
+		if i+3 < len(pairs) {
+			end, _ = strconv.Atoi(pairs[i+3])
+		}
+		if start > end || first+end > len(content) {
+			return nil, nil
+		}
+		dictionary = bytes.TrimSpace(content[first+start : first+end])
+		if !bytes.HasPrefix(dictionary, []byte("<<")) || !bytes.HasSuffix(dictionary, []byte(">>")) {
+			return nil, nil
+		}
+		return dictionary, nil
+	}
+	return nil, nil
+}
+
+// oldInfoEntries returns the string entries of the document information dictionary of the PDF in data
+func oldInfoEntries(data []byte) (entries map[string]string, err error) {
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return
+	}
+	entries = map[string]string{}
+	info := reader.Trailer().Key("Info")
+	for _, key := range info.Keys() {
+		if value := info.Key(key); value.Kind() == pdf.String {
+			entries[key] = value.Text()
+		}
+	}
+	return
+}
+
+// pdfString returns value as a PDF text string, a literal string if it is printable ASCII and otherwise
+// UTF-16BE with a byte order mark as a hex string
+func pdfString(value string) string {
+	ascii := true
+	for _, r := range value {
+		if r < ' ' || r > '~' {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return "(" + strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(value) + ")"
+	}
+	encoded := []byte{0xfe, 0xff}
+	for _, unit := range utf16.Encode([]rune(value)) {
+		encoded = append(encoded, byte(unit>>8), byte(unit))
+	}
+	return "<" + hex.EncodeToString(encoded) + ">"
+}
@@ -0,0 +1,219 @@
+package pdfbinder_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/ledongthuc/pdf"
+	"github.com/motevets/pdfpatch/pkg/pdfbinder"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// xrefStreamPDF returns a PDF with one empty page whose cross reference section is a stream
+func xrefStreamPDF() []byte {
+	var data bytes.Buffer
+	data.WriteString("%PDF-1.5\n")
+	var offsets []int
+	for _, object := range []string{
+		"<</Type/Catalog/Pages 2 0 R>>",
+		"<</Type/Pages/Kids[3 0 R]/Count 1>>",
+		"<</Type/Page/Parent 2 0 R/MediaBox[0 0 612 792]>>",
+		"<</Producer(test)>>",
+	} {
+		offsets = append(offsets, data.Len())
+		fmt.Fprintf(&data, "%d 0 obj\n%s\nendobj\n", len(offsets), object)
+	}
+	xrefOffset := data.Len()
+	offsets = append(offsets, xrefOffset)
+	var entries bytes.Buffer
+	entries.Write([]byte{0, 0, 0, 0, 0, 0xff, 0xff})
+	for _, offset := range offsets {
+		entries.WriteByte(1)
+		binary.Write(&entries, binary.BigEndian, uint32(offset))
+		binary.Write(&entries, binary.BigEndian, uint16(0))
+	}
+	fmt.Fprintf(&data, "5 0 obj\n<</Type/XRef/Size 6/W[1 4 2]/Root 1 0 R/Info 4 0 R/Length %d>>\nstream\n", entries.Len())
+	data.Write(entries.Bytes())
+	fmt.Fprintf(&data, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", xrefOffset)
+	return data.Bytes()
+}
+
+// objectStreamPDF returns a PDF with one empty page whose catalog is compressed in an object stream
+func objectStreamPDF() []byte {
+	var data bytes.Buffer
+	data.WriteString("%PDF-1.5\n")
+	offsets := map[int]int{}
+	for number, object := range map[int]string{
+		2: "<</Type/Pages/Kids[3 0 R]/Count 1>>",
+		3: "<</Type/Page/Parent 2 0 R/MediaBox[0 0 612 792]>>",
+		4: "<</Producer(test)>>",
+	} {
+		offsets[number] = data.Len()
+		fmt.Fprintf(&data, "%d 0 obj\n%s\nendobj\n", number, object)
+	}
+	var compressed bytes.Buffer
+	zlibWriter := zlib.NewWriter(&compressed)
+	zlibWriter.Write([]byte("1 0 <</Type/Catalog/Pages 2 0 R/Metadata 9 0 R>>"))
+	zlibWriter.Close()
+	offsets[5] = data.Len()
+	fmt.Fprintf(&data, "5 0 obj\n<</Type/ObjStm/N 1/First 4/Filter/FlateDecode/Length %d>>\nstream\n", compressed.Len())
+	data.Write(compressed.Bytes())
+	data.WriteString("\nendstream\nendobj\n")
+
+	xrefOffset := data.Len()
+	offsets[6] = xrefOffset
+	var entries bytes.Buffer
+	entries.Write([]byte{0, 0, 0, 0, 0, 0xff, 0xff})
+	// the catalog is object 0 of the object stream
+	entries.Write([]byte{2, 0, 0, 0, 5, 0, 0})
+	for number := 2; number <= 6; number++ {
+		entries.WriteByte(1)
+		binary.Write(&entries, binary.BigEndian, uint32(offsets[number]))
+		binary.Write(&entries, binary.BigEndian, uint16(0))
+	}
+	fmt.Fprintf(&data, "6 0 obj\n<</Type/XRef/Size 7/W[1 4 2]/Root 1 0 R/Info 4 0 R/Length %d>>\nstream\n", entries.Len())
+	data.Write(entries.Bytes())
+	fmt.Fprintf(&data, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", xrefOffset)
+	return data.Bytes()
+}
+
+var _ = Describe("WriteInfo", func() {
+	const fixturePDFPath = "../../test/fixtures/patch_bundle_pdfs/chapter_1.pdf"
+	var (
+		tempDir  string
+		pdfPath  string
+		metadata = pdfbinder.Metadata{
+			Title:       "Foo",
+			Subtitle:    "A Story",
+			Authors:     []string{"Jane Doe", "Jöhn Smith"},
+			Language:    "en-CA",
+			Identifier:  "urn:isbn:9780000000000",
+			Publisher:   "Example (Press)",
+			Rights:      "© 2020 Jane Doe",
+			Description: "A story about foo.",
+		}
+	)
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = ioutil.TempDir("", "pdfbinder_test")
+		Expect(err).NotTo(HaveOccurred())
+		pdfPath = path.Join(tempDir, "book.pdf")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tempDir)
+	})
+
+	readInfo := func() map[string]string {
+		file, reader, err := pdf.Open(pdfPath)
+		Expect(err).NotTo(HaveOccurred())
+		defer file.Close()
+		info := reader.Trailer().Key("Info")
+		entries := map[string]string{}
+		for _, key := range info.Keys() {
+			entries[key] = info.Key(key).Text()
+		}
+		return entries
+	}
+
+	readXMP := func() []byte {
+		file, reader, err := pdf.Open(pdfPath)
+		Expect(err).NotTo(HaveOccurred())
+		defer file.Close()
+		Expect(reader.NumPage()).To(Equal(1))
+		stream := reader.Trailer().Key("Root").Key("Metadata")
+		Expect(stream.Key("Subtype").Name()).To(Equal("XML"))
+		xmp, err := ioutil.ReadAll(stream.Reader())
+		Expect(err).NotTo(HaveOccurred())
+		return xmp
+	}
+
+	expectMetadata := func(producer string) {
+		xmp := readXMP()
+		decoder := xml.NewDecoder(bytes.NewReader(xmp))
+		for {
+			_, err := decoder.Token()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+		}
+		for _, value := range []string{
+			`<rdf:li xml:lang="x-default">Foo: A Story</rdf:li>`,
+			"<rdf:Seq><rdf:li>Jane Doe</rdf:li><rdf:li>Jöhn Smith</rdf:li></rdf:Seq>",
+			"<dc:identifier>urn:isbn:9780000000000</dc:identifier>",
+			"<rdf:li>Example (Press)</rdf:li>",
+			"<rdf:li>en-CA</rdf:li>",
+		} {
+			Expect(string(xmp)).To(ContainSubstring(value))
+		}
+
+		info := readInfo()
+		for key, value := range map[string]string{
+			"Title":      "Foo: A Story",
+			"Author":     "Jane Doe, Jöhn Smith",
+			"Subject":    "A story about foo.",
+			"Identifier": "urn:isbn:9780000000000",
+			"Publisher":  "Example (Press)",
+			"Rights":     "© 2020 Jane Doe",
+			"Producer":   producer,
+		} {
+			Expect(info).To(HaveKeyWithValue(key, value))
+		}
+	}
+
+	It("writes the metadata into a PDF with a cross reference table", func() {
+		original, err := ioutil.ReadFile(fixturePDFPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(pdfPath, original, 0644)).To(Succeed())
+		producer := readInfo()["Producer"]
+		Expect(producer).NotTo(BeEmpty())
+
+		Expect(pdfbinder.WriteInfo(pdfPath, metadata)).To(Succeed())
+		expectMetadata(producer)
+
+		file, reader, err := pdf.Open(pdfPath)
+		Expect(err).NotTo(HaveOccurred())
+		defer file.Close()
+		Expect(reader.NumPage()).To(Equal(1))
+		updated, err := ioutil.ReadFile(pdfPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(updated).To(HavePrefix(string(original)))
+	})
+
+	It("writes the metadata into a PDF with a cross reference stream", func() {
+		Expect(ioutil.WriteFile(pdfPath, xrefStreamPDF(), 0644)).To(Succeed())
+
+		Expect(pdfbinder.WriteInfo(pdfPath, metadata)).To(Succeed())
+		expectMetadata("test")
+	})
+
+	It("replaces the metadata written before", func() {
+		Expect(ioutil.WriteFile(pdfPath, xrefStreamPDF(), 0644)).To(Succeed())
+		Expect(pdfbinder.WriteInfo(pdfPath, pdfbinder.Metadata{Title: "Old", Rights: "CC-BY"})).To(Succeed())
+
+		Expect(pdfbinder.WriteInfo(pdfPath, metadata)).To(Succeed())
+		expectMetadata("test")
+		Expect(string(readXMP())).NotTo(ContainSubstring("Old"))
+	})
+
+	It("points a catalog compressed in an object stream at the metadata stream", func() {
+		original := objectStreamPDF()
+		Expect(ioutil.WriteFile(pdfPath, original, 0644)).To(Succeed())
+
+		Expect(pdfbinder.WriteInfo(pdfPath, metadata)).To(Succeed())
+		expectMetadata("test")
+		updated, err := ioutil.ReadFile(pdfPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(updated[len(original):])).To(ContainSubstring("<</Type/Catalog/Pages 2 0 R/Metadata 8 0 R>>"))
+	})
+})
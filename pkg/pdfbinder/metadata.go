@@ -0,0 +1,143 @@
+package pdfbinder
+
+import (
+	"os"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Metadata describes the book, written into the document information dictionary and XMP
+// metadata stream of the PDF by WriteInfo
+// The language, title, authors and description are also written into the head of the HTML file the PDF is
+// rendered from. Title is written with the subtitle after it, like "Foo: A Story".
+type Metadata struct {
+	Title       string
+	Subtitle    string
+	Authors     []string
+	Language    string
+	Identifier  string
+	Publisher   string
+	Rights      string
+	Description string
+}
+
+func (metadata Metadata) isEmpty() bool {
+	return metadata.Title == "" && metadata.Subtitle == "" && len(metadata.Authors) == 0 && metadata.Language == "" &&
+		metadata.Identifier == "" && metadata.Publisher == "" && metadata.Rights == "" && metadata.Description == ""
+}
+
+// fullTitle is the title with the subtitle after it, like "Foo: A Story"
+func (metadata Metadata) fullTitle() string {
+	if metadata.Title == "" || metadata.Subtitle == "" {
+		return metadata.Title + metadata.Subtitle
+	}
+	return metadata.Title + ": " + metadata.Subtitle
+}
+
+// metaTags are the names and contents of the meta tags for the metadata
+func (metadata Metadata) metaTags() (tags [][2]string) {
+	for _, tag := range [][2]string{
+		{"author", strings.Join(metadata.Authors, ", ")},
+		{"description", metadata.Description},
+	} {
+		if tag[1] != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return
+}
+
+// addMetadata writes the metadata into the head of the HTML file at htmlFilePath
+// The title and meta tags replace any the file already has and the language is set on the html element.
+func addMetadata(htmlFilePath string, metadata Metadata) (err error) {
+	htmlFile, err := os.Open(htmlFilePath)
+	if err != nil {
+		return
+	}
+	document, err := html.Parse(htmlFile)
+	htmlFile.Close()
+	if err != nil {
+		return
+	}
+
+	root := findElement(document, atom.Html)
+	head := findElement(document, atom.Head)
+	if root == nil || head == nil {
+		// html.Parse always adds the html and head elements
+		return nil
+	}
+	if metadata.Language != "" {
+		setAttribute(root, "lang", metadata.Language)
+	}
+	if title := metadata.fullTitle(); title != "" {
+		removeElements(head, func(node *html.Node) bool { return node.DataAtom == atom.Title })
+		titleElement := &html.Node{Type: html.ElementNode, Data: "title", DataAtom: atom.Title}
+		titleElement.AppendChild(&html.Node{Type: html.TextNode, Data: title})
+		head.AppendChild(titleElement)
+	}
+	for _, tag := range metadata.metaTags() {
+		name := tag[0]
+		removeElements(head, func(node *html.Node) bool {
+			return node.DataAtom == atom.Meta && attribute(node, "name") == name
+		})
+		head.AppendChild(&html.Node{Type: html.ElementNode, Data: "meta", DataAtom: atom.Meta, Attr: []html.Attribute{
+			{Key: "name", Val: name},
+			{Key: "content", Val: tag[1]},
+		}})
+	}
+
+	htmlFile, err = os.OpenFile(htmlFilePath, os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return
+	}
+	err = html.Render(htmlFile, document)
+	if closeErr := htmlFile.Close(); err == nil {
+		err = closeErr
+	}
+	return
+}
+
+// findElement returns the first element of the kind in the tree under node, or nil if there is none
+func findElement(node *html.Node, kind atom.Atom) *html.Node {
+	if node.Type == html.ElementNode && node.DataAtom == kind {
+		return node
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if found := findElement(child, kind); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// removeElements removes the children of node that match
+func removeElements(node *html.Node, match func(node *html.Node) bool) {
+	for child := node.FirstChild; child != nil; {
+		next := child.NextSibling
+		if child.Type == html.ElementNode && match(child) {
+			node.RemoveChild(child)
+		}
+		child = next
+	}
+}
+
+func attribute(node *html.Node, key string) string {
+	for _, attr := range node.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func setAttribute(node *html.Node, key string, value string) {
+	for i := range node.Attr {
+		if node.Attr[i].Key == key {
+			node.Attr[i].Val = value
+			return
+		}
+	}
+	node.Attr = append(node.Attr, html.Attribute{Key: key, Val: value})
+}
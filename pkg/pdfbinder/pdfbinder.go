@@ -1,32 +1,94 @@
 package pdfbinder
 
 import (
-	"io/ioutil"
+	"context"
 	"log"
-	"os/exec"
+	"regexp"
+	"strconv"
 
+	"github.com/motevets/pdfpatch/pkg/workspace"
 	"github.com/their-sober-press/alcobinder/pkg/alcobinder"
 )
 
-func BindPdf(inputFolder string, inputCSSFile string, outputPDFPath string) (err error) {
-	htmlFilePath, err := makeHTMLFile(inputFolder, inputCSSFile)
+// PageProgress is called with the number of each page as the PDF is laid out
+type PageProgress func(page int)
+
+// Options configures how PDFs are bound
+// Renderer is the name of the renderer to use (default: weasyprint)
+// OnPage (optional) is called as each page is rendered by renderers that report their progress
+// Workspace (optional) is where the intermediate HTML file is written, otherwise it is written to a
+// temporary directory that is removed once the PDF is bound
+// Metadata (optional) describes the book in the head of the HTML file and the document information and
+// XMP metadata of the PDF
+type Options struct {
+	Renderer  string
+	OnPage    PageProgress
+	Workspace *workspace.Workspace
+	Metadata  Metadata
+}
+
+// pageLogPattern matches the lines weasyprint logs in verbose mode as it lays out each page
+var pageLogPattern = regexp.MustCompile(`Page (\d+)`)
+
+// BindPdf renders the markdown files in inputFolder with the CSS file into a PDF
+// Failures of the renderer are returned as a *RenderError.
+func BindPdf(inputFolder string, inputCSSFile string, outputPDFPath string, options Options) (err error) {
+	return BindPdfContext(context.Background(), inputFolder, inputCSSFile, outputPDFPath, options)
+}
+
+// BindPdfContext is BindPdf killing the renderer if ctx is done before the PDF is written
+func BindPdfContext(ctx context.Context, inputFolder string, inputCSSFile string, outputPDFPath string, options Options) (err error) {
+	renderer, err := NewRenderer(options.Renderer)
+	if err != nil {
+		return
+	}
+	ws := options.Workspace
+	if ws == nil {
+		ws, err = workspace.New("pdfbinder-", false)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+	}
+	htmlFilePath, err := makeHTMLFile(ws, inputFolder, inputCSSFile)
+	if err != nil {
+		return
+	}
+	if !options.Metadata.isEmpty() {
+		err = addMetadata(htmlFilePath, options.Metadata)
+		if err != nil {
+			return
+		}
+	}
 	log.Println("HTML file written:", htmlFilePath)
-	err = renderPDF(htmlFilePath, outputPDFPath)
+	err = renderer.Render(ctx, htmlFilePath, outputPDFPath, options.OnPage)
+	if err != nil || options.Metadata.isEmpty() {
+		return
+	}
+	err = WriteInfo(outputPDFPath, options.Metadata)
 	return
 }
 
-func makeHTMLFile(inputFolder string, inputCSSFile string) (htmlFilePath string, err error) {
-	tempFile, err := ioutil.TempFile("", "bound-*.html")
+func makeHTMLFile(ws *workspace.Workspace, inputFolder string, inputCSSFile string) (htmlFilePath string, err error) {
+	tempFile, err := ws.TempFile("bound-*.html")
 	if err != nil {
 		return
 	}
 	htmlFilePath = tempFile.Name()
+	tempFile.Close()
 	err = alcobinder.BindMarkdownsToFile(inputFolder, inputCSSFile, htmlFilePath)
 	return
 }
 
-func renderPDF(pathToHTML string, outputPDFPath string) (err error) {
-	cmd := exec.Command("weasyprint", "--presentational-hints", pathToHTML, outputPDFPath)
-	err = cmd.Run()
-	return
+// reportPage calls onPage if line is weasyprint logging that it is laying out a page
+func reportPage(line string, onPage PageProgress) bool {
+	match := pageLogPattern.FindStringSubmatch(line)
+	if match == nil {
+		return false
+	}
+	page, err := strconv.Atoi(match[1])
+	if err == nil {
+		onPage(page)
+	}
+	return true
 }
@@ -0,0 +1,193 @@
+package pdfbinder
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Renderer renders an HTML file into a PDF
+type Renderer interface {
+	// Name is the name the renderer is chosen by in options and manifests
+	Name() string
+	// Render writes the PDF for htmlFilePath to outputPDFPath, stopping the renderer if ctx is done
+	// onPage (optional) is called as each page is laid out if the renderer reports its progress.
+	Render(ctx context.Context, htmlFilePath string, outputPDFPath string, onPage PageProgress) error
+}
+
+// DefaultRenderer is the name of the renderer used when none is chosen
+const DefaultRenderer = "weasyprint"
+
+// maxStderrLength is the most of a renderer's stderr included in a RenderError
+const maxStderrLength = 4096
+
+var renderers = map[string]Renderer{
+	"weasyprint":  Weasyprint{},
+	"wkhtmltopdf": Wkhtmltopdf{},
+	"chromium":    Chromium{},
+}
+
+// NewRenderer returns the renderer with the name or the default renderer if name is empty
+func NewRenderer(name string) (renderer Renderer, err error) {
+	if name == "" {
+		name = DefaultRenderer
+	}
+	renderer, ok := renderers[name]
+	if !ok {
+		err = fmt.Errorf("unknown renderer %q (must be one of %v)", name, RendererNames())
+	}
+	return
+}
+
+// RendererNames returns the names of all the renderers in alphabetical order
+func RendererNames() (names []string) {
+	for name := range renderers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// RenderError is returned when a renderer fails along with what it wrote to stderr
+// If the renderer was stopped because its context was done, Err is the error of the context.
+type RenderError struct {
+	Renderer string
+	Err      error
+	Stderr   string
+}
+
+func (e *RenderError) Error() string {
+	if e.Stderr == "" {
+		return fmt.Sprintf("%s failed: %v", e.Renderer, e.Err)
+	}
+	return fmt.Sprintf("%s failed: %v: %s", e.Renderer, e.Err, e.Stderr)
+}
+
+func (e *RenderError) Unwrap() error {
+	return e.Err
+}
+
+// runRenderer runs the command of a renderer, wrapping any failure in a *RenderError
+// onLine (optional) is called with each line written to stderr and returns true for progress
+// lines, which are left out of the error.
+func runRenderer(ctx context.Context, name string, cmd *exec.Cmd, onLine func(line string) bool) (err error) {
+	stderrPipe, err := cmd.StderrPipe()
+	if err != nil {
+		return
+	}
+	err = cmd.Start()
+	if err != nil {
+		return &RenderError{Renderer: name, Err: err}
+	}
+
+	// stderr is read to the end however long its lines are, the renderer blocks once the pipe is full
+	var stderr bytes.Buffer
+	lines := bufio.NewReader(stderrPipe)
+	for {
+		line, readErr := lines.ReadString('\n')
+		if line != "" {
+			line = strings.TrimRight(line, "\r\n")
+			if onLine == nil || !onLine(line) {
+				stderr.WriteString(line + "\n")
+			}
+		}
+		if readErr != nil {
+			break
+		}
+	}
+
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return &RenderError{Renderer: name, Err: ctx.Err()}
+	}
+	if err != nil {
+		return &RenderError{Renderer: name, Err: err, Stderr: tail(strings.TrimSpace(stderr.String()), maxStderrLength)}
+	}
+	return nil
+}
+
+func tail(text string, length int) string {
+	if len(text) <= length {
+		return text
+	}
+	return "..." + text[len(text)-length:]
+}
+
+// Weasyprint renders PDFs with WeasyPrint (https://weasyprint.org)
+// It is the only renderer that reports the progress of each page.
+type Weasyprint struct{}
+
+// Name returns "weasyprint"
+func (Weasyprint) Name() string {
+	return "weasyprint"
+}
+
+// Render runs weasyprint, in verbose mode to follow the pages laid out if onPage is set
+func (renderer Weasyprint) Render(ctx context.Context, htmlFilePath string, outputPDFPath string, onPage PageProgress) error {
+	if onPage == nil {
+		return runRenderer(ctx, renderer.Name(), exec.CommandContext(ctx, "weasyprint", "--presentational-hints", htmlFilePath, outputPDFPath), nil)
+	}
+	cmd := exec.CommandContext(ctx, "weasyprint", "--presentational-hints", "--verbose", htmlFilePath, outputPDFPath)
+	return runRenderer(ctx, renderer.Name(), cmd, func(line string) bool {
+		return reportPage(line, onPage) || strings.HasPrefix(line, "Step ")
+	})
+}
+
+// Wkhtmltopdf renders PDFs with wkhtmltopdf (https://wkhtmltopdf.org)
+type Wkhtmltopdf struct{}
+
+// Name returns "wkhtmltopdf"
+func (Wkhtmltopdf) Name() string {
+	return "wkhtmltopdf"
+}
+
+// Render runs wkhtmltopdf allowing the HTML file to load the local style sheet
+func (renderer Wkhtmltopdf) Render(ctx context.Context, htmlFilePath string, outputPDFPath string, onPage PageProgress) error {
+	cmd := exec.CommandContext(ctx, "wkhtmltopdf", "--quiet", "--enable-local-file-access", htmlFilePath, outputPDFPath)
+	return runRenderer(ctx, renderer.Name(), cmd, nil)
+}
+
+// Chromium renders PDFs with headless Chromium (or Google Chrome) using --print-to-pdf
+type Chromium struct{}
+
+// chromiumCommands are the names Chromium is installed under, in order of preference
+var chromiumCommands = []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable"}
+
+// Name returns "chromium"
+func (Chromium) Name() string {
+	return "chromium"
+}
+
+// Render prints the HTML file to a PDF with headless Chromium
+func (renderer Chromium) Render(ctx context.Context, htmlFilePath string, outputPDFPath string, onPage PageProgress) (err error) {
+	htmlFilePath, err = filepath.Abs(htmlFilePath)
+	if err != nil {
+		return
+	}
+	outputPDFPath, err = filepath.Abs(outputPDFPath)
+	if err != nil {
+		return
+	}
+	cmd := exec.CommandContext(ctx, chromiumCommand(),
+		"--headless",
+		"--disable-gpu",
+		"--no-pdf-header-footer",
+		"--print-to-pdf="+outputPDFPath,
+		"file://"+filepath.ToSlash(htmlFilePath),
+	)
+	return runRenderer(ctx, renderer.Name(), cmd, nil)
+}
+
+func chromiumCommand() string {
+	for _, command := range chromiumCommands {
+		if _, err := exec.LookPath(command); err == nil {
+			return command
+		}
+	}
+	return chromiumCommands[0]
+}
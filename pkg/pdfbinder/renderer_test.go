@@ -0,0 +1,47 @@
+package pdfbinder_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/motevets/pdfpatch/pkg/pdfbinder"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("renderers", func() {
+	var (
+		binDir  string
+		oldPath string
+	)
+
+	BeforeEach(func() {
+		var err error
+		binDir, err = ioutil.TempDir("", "renderer_test")
+		Expect(err).NotTo(HaveOccurred())
+		oldPath = os.Getenv("PATH")
+		Expect(os.Setenv("PATH", binDir+string(os.PathListSeparator)+oldPath)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.Setenv("PATH", oldPath)
+		os.RemoveAll(binDir)
+	})
+
+	It("reads all of stderr however long its lines are", func() {
+		script := "#!/bin/sh\nhead -c 200000 /dev/zero | tr '\\0' x >&2\necho >&2\necho 'could not render' >&2\nexit 1\n"
+		Expect(ioutil.WriteFile(path.Join(binDir, "wkhtmltopdf"), []byte(script), 0755)).To(Succeed())
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err := pdfbinder.Wkhtmltopdf{}.Render(ctx, "book.html", path.Join(binDir, "book.pdf"), nil)
+		var renderErr *pdfbinder.RenderError
+		Expect(errors.As(err, &renderErr)).To(BeTrue())
+		Expect(ctx.Err()).NotTo(HaveOccurred())
+		Expect(renderErr.Stderr).To(HaveSuffix("\ncould not render"))
+	})
+})
@@ -0,0 +1,62 @@
+package pdfbinder
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+)
+
+const (
+	xmpHeader = `<?xpacket begin="` + "\ufeff" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/">
+`
+	xmpFooter = `</rdf:Description>
+</rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+)
+
+// xmp is the metadata as an XMP packet of Dublin Core properties, the metadata stream of the PDF catalog
+func (metadata Metadata) xmp() []byte {
+	var packet bytes.Buffer
+	packet.WriteString(xmpHeader)
+	property := func(name string, container string, values ...string) {
+		var items []string
+		for _, value := range values {
+			if value != "" {
+				items = append(items, value)
+			}
+		}
+		if len(items) == 0 {
+			return
+		}
+		if container == "" {
+			fmt.Fprintf(&packet, "<dc:%s>", name)
+			xml.EscapeText(&packet, []byte(items[0]))
+			fmt.Fprintf(&packet, "</dc:%s>\n", name)
+			return
+		}
+		fmt.Fprintf(&packet, "<dc:%s><rdf:%s>", name, container)
+		for _, item := range items {
+			if container == "Alt" {
+				packet.WriteString(`<rdf:li xml:lang="x-default">`)
+			} else {
+				packet.WriteString("<rdf:li>")
+			}
+			xml.EscapeText(&packet, []byte(item))
+			packet.WriteString("</rdf:li>")
+		}
+		fmt.Fprintf(&packet, "</rdf:%s></dc:%s>\n", container, name)
+	}
+	property("title", "Alt", metadata.fullTitle())
+	property("creator", "Seq", metadata.Authors...)
+	property("description", "Alt", metadata.Description)
+	property("language", "Bag", metadata.Language)
+	property("identifier", "", metadata.Identifier)
+	property("publisher", "Bag", metadata.Publisher)
+	property("rights", "Alt", metadata.Rights)
+	packet.WriteString(xmpFooter)
+	return packet.Bytes()
+}
@@ -0,0 +1,312 @@
+package pdfpatch
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// contextPreviewLength is the maximum number of characters of hunk context shown in summaries
+const contextPreviewLength = 40
+
+// HunkResult describes the outcome of applying a single hunk of a patch
+// Number is the 1-based index of the hunk (after oversized hunks have been split)
+// Page is the page the hunk is anchored to for page anchored patches, otherwise 0
+// Expected is the 0-based character position where the patch expected the hunk to apply
+// (relative to the start of the page for page anchored patches)
+// Actual is the position where the hunk was applied or -1 if it was rejected
+// Offset is the drift between Actual and Expected
+// Context is the source text the hunk was anchored to (the text it matched against)
+// Diffs are the changes of an applied hunk along with the context around them, widened to whole words
+type HunkResult struct {
+	Number   int
+	Page     int
+	Applied  bool
+	Expected int
+	Actual   int
+	Offset   int
+	Context  string
+	Diffs    []diffmatchpatch.Diff
+}
+
+// PatchResult is the result of applying a patch to the text of a PDF
+// Pages are the page ranges of the PDF that were patched (empty for the whole PDF)
+type PatchResult struct {
+	PDFFileName string
+	Pages       string
+	Text        string
+	Hunks       []HunkResult
+}
+
+// Name returns the file name of the PDF along with its page ranges
+func (result PatchResult) Name() string {
+	if result.Pages == "" {
+		return result.PDFFileName
+	}
+	return fmt.Sprintf("%s (pages %s)", result.PDFFileName, result.Pages)
+}
+
+// Rejected returns the hunks that could not be applied
+func (result PatchResult) Rejected() (rejected []HunkResult) {
+	for _, hunk := range result.Hunks {
+		if !hunk.Applied {
+			rejected = append(rejected, hunk)
+		}
+	}
+	return
+}
+
+// Applied returns the number of hunks that were applied
+func (result PatchResult) Applied() int {
+	return len(result.Hunks) - len(result.Rejected())
+}
+
+// RejectedHunksError is returned when one or more hunks of a patch could not be applied
+type RejectedHunksError struct {
+	Results []PatchResult
+}
+
+func (e *RejectedHunksError) Error() string {
+	var rejectedFiles []string
+	for _, result := range e.Results {
+		if rejected := len(result.Rejected()); rejected > 0 {
+			rejectedFiles = append(rejectedFiles, fmt.Sprintf("%s (%d of %d hunks)", result.Name(), rejected, len(result.Hunks)))
+		}
+	}
+	return "rejected hunks in " + strings.Join(rejectedFiles, ", ")
+}
+
+// WriteSummary writes a human readable summary of patch results to w
+// Hunks that applied exactly where expected are not listed individually.
+func WriteSummary(w io.Writer, results []PatchResult) (err error) {
+	for _, result := range results {
+		_, err = fmt.Fprintf(w, "%s: %d/%d hunks applied\n", result.Name(), result.Applied(), len(result.Hunks))
+		if err != nil {
+			return
+		}
+		for _, hunk := range result.Hunks {
+			if hunk.Applied && hunk.Offset == 0 {
+				continue
+			}
+			_, err = fmt.Fprintf(w, "  %s\n", hunk)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// String describes where the hunk was applied or where it was rejected
+func (hunk HunkResult) String() string {
+	name := fmt.Sprintf("hunk #%d", hunk.Number)
+	if hunk.Page > 0 {
+		name += fmt.Sprintf(" (page %d)", hunk.Page)
+	}
+	if hunk.Applied {
+		return fmt.Sprintf("%s applied at %d (offset %+d)", name, hunk.Actual, hunk.Offset)
+	}
+	return fmt.Sprintf("%s REJECTED at %d: %q", name, hunk.Expected, previewContext(hunk.Context))
+}
+
+func previewContext(context string) string {
+	if len(context) <= contextPreviewLength {
+		return context
+	}
+	return context[:contextPreviewLength] + "..."
+}
+
+// ApplyPatchText applies a patch (in diff-match-patch text format) to text
+// Hashed patches are detected and applied with ApplyHashedPatchText.
+func ApplyPatchText(text string, patchText string) (result PatchResult, err error) {
+	if isPagePatch(patchText) {
+		err = fmt.Errorf("page anchored patches must be applied to the text of each page")
+		return
+	}
+	if isHashedPatch(patchText) {
+		return ApplyHashedPatchText(text, patchText)
+	}
+	dmp := diffmatchpatch.New()
+	patches, err := dmp.PatchFromText(patchText)
+	if err != nil {
+		return
+	}
+	result.Text, result.Hunks = applyPatches(dmp, patches, text)
+	return
+}
+
+// applyPatches mirrors diffmatchpatch.PatchApply but records where each hunk was applied
+func applyPatches(dmp *diffmatchpatch.DiffMatchPatch, patches []diffmatchpatch.Patch, text string) (string, []HunkResult) {
+	if len(patches) == 0 {
+		return text, []HunkResult{}
+	}
+
+	patches = dmp.PatchDeepCopy(patches)
+	nullPadding := dmp.PatchAddPadding(patches)
+	text = nullPadding + text + nullPadding
+	patches = dmp.PatchSplitMax(patches)
+
+	// delta is the offset between the expected and actual location of the previous hunk
+	delta := 0
+	results := make([]HunkResult, len(patches))
+	for x, aPatch := range patches {
+		diffs := hunkDiffs(aPatch)
+		expectedLoc := aPatch.Start2 + delta
+		text1 := dmp.DiffText1(diffs)
+		results[x] = HunkResult{
+			Number:   x + 1,
+			Expected: aPatch.Start2 - len(nullPadding),
+			Actual:   -1,
+			Context:  strings.TrimSuffix(strings.TrimPrefix(text1, nullPadding), nullPadding),
+		}
+
+		var startLoc int
+		endLoc := -1
+		if len(text1) > dmp.MatchMaxBits {
+			// PatchSplitMax will only provide an oversized pattern in the case of a monster delete
+			startLoc = dmp.MatchMain(text, text1[:dmp.MatchMaxBits], expectedLoc)
+			if startLoc != -1 {
+				endLoc = dmp.MatchMain(text, text1[len(text1)-dmp.MatchMaxBits:], expectedLoc+len(text1)-dmp.MatchMaxBits)
+				if endLoc == -1 || startLoc >= endLoc {
+					startLoc = -1
+				}
+			}
+		} else {
+			startLoc = dmp.MatchMain(text, text1, expectedLoc)
+		}
+
+		if startLoc == -1 {
+			delta -= aPatch.Length2 - aPatch.Length1
+			continue
+		}
+
+		delta = startLoc - expectedLoc
+		var text2 string
+		if endLoc == -1 {
+			text2 = text[startLoc:int(math.Min(float64(startLoc+len(text1)), float64(len(text))))]
+		} else {
+			text2 = text[startLoc:int(math.Min(float64(endLoc+dmp.MatchMaxBits), float64(len(text))))]
+		}
+		if text1 == text2 {
+			text = text[:startLoc] + dmp.DiffText2(diffs) + text[startLoc+len(text1):]
+		} else {
+			// imperfect match, diff to get a framework of equivalent indices
+			matchDiffs := dmp.DiffMain(text1, text2, false)
+			if len(text1) > dmp.MatchMaxBits && float64(dmp.DiffLevenshtein(matchDiffs))/float64(len(text1)) > dmp.PatchDeleteThreshold {
+				continue
+			}
+			matchDiffs = dmp.DiffCleanupSemanticLossless(matchDiffs)
+			index1 := 0
+			for _, aDiff := range diffs {
+				if aDiff.Type != diffmatchpatch.DiffEqual {
+					index2 := dmp.DiffXIndex(matchDiffs, index1)
+					if aDiff.Type == diffmatchpatch.DiffInsert {
+						text = text[:startLoc+index2] + aDiff.Text + text[startLoc+index2:]
+					} else if aDiff.Type == diffmatchpatch.DiffDelete {
+						startIndex := startLoc + index2
+						text = text[:startIndex] + text[startIndex+dmp.DiffXIndex(matchDiffs, index1+len(aDiff.Text))-index2:]
+					}
+				}
+				if aDiff.Type != diffmatchpatch.DiffDelete {
+					index1 += len(aDiff.Text)
+				}
+			}
+		}
+		results[x].Applied = true
+		results[x].Actual = startLoc - len(nullPadding)
+		results[x].Offset = startLoc - aPatch.Start2
+		results[x].Diffs = appliedDiffs(dmp, diffs, text, startLoc, nullPadding)
+	}
+
+	text = text[len(nullPadding) : len(text)-len(nullPadding)]
+	return text, results
+}
+
+// appliedDiffs returns the diffs of a hunk whose patched text starts at start in text, with the context
+// at either end widened to whole words of text and without the null padding of the patch
+func appliedDiffs(dmp *diffmatchpatch.DiffMatchPatch, diffs []diffmatchpatch.Diff, text string, start int, nullPadding string) []diffmatchpatch.Diff {
+	// the patched text of a hunk that matched imperfectly may be shorter than its diffs
+	end := int(math.Min(float64(start+len(dmp.DiffText2(diffs))), float64(len(text))))
+	before := start
+	for before > 0 && !isWordBoundary(text[before-1]) {
+		before--
+	}
+	after := end
+	for after < len(text) && !isWordBoundary(text[after]) {
+		after++
+	}
+
+	widened := appendContext(nil, text[before:start])
+	widened = append(widened, diffs...)
+	widened = appendContext(widened, text[end:after])
+	applied := make([]diffmatchpatch.Diff, 0, len(widened))
+	for i, diff := range widened {
+		if i == 0 && diff.Type == diffmatchpatch.DiffEqual {
+			diff.Text = strings.TrimLeft(diff.Text, nullPadding)
+		}
+		if i == len(widened)-1 && diff.Type == diffmatchpatch.DiffEqual {
+			diff.Text = strings.TrimRight(diff.Text, nullPadding)
+		}
+		switch {
+		case diff.Text == "":
+		case len(applied) > 0 && applied[len(applied)-1].Type == diff.Type:
+			applied[len(applied)-1].Text += diff.Text
+		default:
+			applied = append(applied, diff)
+		}
+	}
+	return dmp.DiffCleanupSemantic(applied)
+}
+
+// appendContext appends the unchanged context to diffs unless it is empty
+func appendContext(diffs []diffmatchpatch.Diff, context string) []diffmatchpatch.Diff {
+	if context == "" {
+		return diffs
+	}
+	return append(diffs, diffmatchpatch.Diff{Type: diffmatchpatch.DiffEqual, Text: context})
+}
+
+// isWordBoundary reports whether c separates words, which the null padding of patches also does
+func isWordBoundary(c byte) bool {
+	return c <= ' '
+}
+
+// hunkDiffs recovers the diffs of a patch, which diffmatchpatch does not export, from its text form
+func hunkDiffs(aPatch diffmatchpatch.Patch) (diffs []diffmatchpatch.Diff) {
+	lines := strings.Split(aPatch.String(), "\n")
+	for _, line := range lines[1:] {
+		if len(line) == 0 {
+			continue
+		}
+		text, err := url.QueryUnescape(strings.Replace(line[1:], "+", "%2b", -1))
+		if err != nil {
+			continue
+		}
+		switch line[0] {
+		case '-':
+			diffs = append(diffs, diffmatchpatch.Diff{Type: diffmatchpatch.DiffDelete, Text: text})
+		case '+':
+			diffs = append(diffs, diffmatchpatch.Diff{Type: diffmatchpatch.DiffInsert, Text: text})
+		case ' ':
+			diffs = append(diffs, diffmatchpatch.Diff{Type: diffmatchpatch.DiffEqual, Text: text})
+		}
+	}
+	return
+}
+
+// hunkStarts returns where each hunk starts in the text the patches were made against
+// diffmatchpatch starts each hunk where it applies once the hunks before it have been applied, so the change
+// in length made by those hunks is taken off.
+func hunkStarts(patches []diffmatchpatch.Patch) []int {
+	starts := make([]int, len(patches))
+	delta := 0
+	for i, aPatch := range patches {
+		starts[i] = aPatch.Start1 - delta
+		delta += aPatch.Length2 - aPatch.Length1
+	}
+	return starts
+}
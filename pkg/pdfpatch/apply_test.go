@@ -0,0 +1,96 @@
+package pdfpatch_test
+
+import (
+	"bytes"
+
+	"github.com/motevets/pdfpatch/pkg/pdfpatch"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+const sourceText = "Hello from chapter 1.  Hallo von Kapitel 2. "
+const patchedText = "\nPAGE 1\n\nGoodbye from chapter 1.\n\nPAGE 2\n\nAuf wiedersehen von Kapitel 2.\n"
+
+func makePatchText(from string, to string) string {
+	dmp := diffmatchpatch.New()
+	return dmp.PatchToText(dmp.PatchMake(from, to))
+}
+
+var _ = Describe("ApplyPatchText", func() {
+	var patchText = makePatchText(sourceText, patchedText)
+
+	It("applies every hunk to the text", func() {
+		result, err := pdfpatch.ApplyPatchText(sourceText, patchText)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Text).To(Equal(patchedText))
+		Expect(result.Hunks).NotTo(BeEmpty())
+		Expect(result.Rejected()).To(BeEmpty())
+		Expect(result.Applied()).To(Equal(len(result.Hunks)))
+		for _, hunk := range result.Hunks {
+			Expect(hunk.Offset).To(Equal(0))
+		}
+	})
+
+	When("the text has drifted from the text the patch was made against", func() {
+		It("reports the offset at which the hunks applied", func() {
+			result, err := pdfpatch.ApplyPatchText("Preface. "+sourceText, patchText)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Text).To(Equal("Preface. " + patchedText))
+			Expect(result.Rejected()).To(BeEmpty())
+			Expect(result.Hunks[0].Offset).To(Equal(len("Preface. ")))
+			Expect(result.Hunks[0].Actual).To(Equal(result.Hunks[0].Expected + len("Preface. ")))
+		})
+	})
+
+	When("the text does not match the patch", func() {
+		It("reports the rejected hunks with their context", func() {
+			result, err := pdfpatch.ApplyPatchText("Something else entirely. Nothing in common here. ", patchText)
+			Expect(err).NotTo(HaveOccurred())
+			rejected := result.Rejected()
+			Expect(rejected).NotTo(BeEmpty())
+			Expect(rejected[0].Applied).To(BeFalse())
+			Expect(rejected[0].Actual).To(Equal(-1))
+			Expect(rejected[0].Context).NotTo(BeEmpty())
+		})
+	})
+
+	When("the patch is malformed", func() {
+		It("returns an error", func() {
+			_, err := pdfpatch.ApplyPatchText(sourceText, "not a patch")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
+
+var _ = Describe("WriteSummary", func() {
+	It("lists the drifted and rejected hunks of each result", func() {
+		var buf bytes.Buffer
+		results := []pdfpatch.PatchResult{
+			{
+				PDFFileName: "chapter_1.pdf",
+				Hunks: []pdfpatch.HunkResult{
+					{Number: 1, Applied: true, Expected: 0, Actual: 0},
+					{Number: 2, Applied: true, Expected: 10, Actual: 14, Offset: 4},
+					{Number: 3, Applied: false, Expected: 30, Actual: -1, Context: "Hallo von"},
+				},
+			},
+		}
+		Expect(pdfpatch.WriteSummary(&buf, results)).To(Succeed())
+		Expect(buf.String()).To(Equal(
+			"chapter_1.pdf: 2/3 hunks applied\n" +
+				"  hunk #2 applied at 14 (offset +4)\n" +
+				"  hunk #3 REJECTED at 30: \"Hallo von\"\n",
+		))
+	})
+})
+
+var _ = Describe("RejectedHunksError", func() {
+	It("names the files with rejected hunks", func() {
+		err := &pdfpatch.RejectedHunksError{Results: []pdfpatch.PatchResult{
+			{PDFFileName: "title_pages.pdf", Hunks: []pdfpatch.HunkResult{{Applied: true}}},
+			{PDFFileName: "chapter_1.pdf", Hunks: []pdfpatch.HunkResult{{Applied: true}, {Applied: false}}},
+		}}
+		Expect(err).To(MatchError("rejected hunks in chapter_1.pdf (1 of 2 hunks)"))
+	})
+})
@@ -0,0 +1,186 @@
+package pdfpatch
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Leakage measures how much of the source text a patch reveals
+// ContextChars is the unchanged source text kept around hunks to locate them
+// DeletedChars is the source text the patch deletes, which it has to spell out
+// LongestDeletedRun is the longest single run of deleted text
+// LongestVerbatimRun is the longest run of source text the patch reveals in one piece, joining the context
+// and deletions of hunks that touch or overlap in the source
+type Leakage struct {
+	ContextChars       int
+	DeletedChars       int
+	LongestDeletedRun  int
+	LongestVerbatimRun int
+}
+
+// AuditLimits are the most source text a patch may reveal, a limit of 0 is not checked
+// The total context and deleted characters grow with the number of changes so they are not limited by default.
+type AuditLimits struct {
+	MaxContextChars int
+	MaxDeletedChars int
+	MaxDeletedRun   int
+	MaxVerbatimRun  int
+}
+
+// DefaultAuditLimits are the limits used by MakeBundle unless Options.AuditLimits is set
+var DefaultAuditLimits = AuditLimits{
+	MaxDeletedRun:  80,
+	MaxVerbatimRun: 120,
+}
+
+// PatchAudit is the leakage of a patch and the limits it exceeds
+type PatchAudit struct {
+	Name     string
+	Leakage  Leakage
+	Exceeded []string
+}
+
+func (audit PatchAudit) String() string {
+	leakage := audit.Leakage
+	description := fmt.Sprintf("%s: %d context chars, %d deleted chars (longest run %d), longest verbatim run %d",
+		audit.Name, leakage.ContextChars, leakage.DeletedChars, leakage.LongestDeletedRun, leakage.LongestVerbatimRun)
+	if len(audit.Exceeded) > 0 {
+		description += " EXCEEDS " + strings.Join(audit.Exceeded, ", ")
+	}
+	return description
+}
+
+// LeakageError is returned when patches reveal more source text than their AuditLimits allow
+type LeakageError struct {
+	Audits []PatchAudit
+}
+
+func (e *LeakageError) Error() string {
+	var names []string
+	for _, audit := range e.Audits {
+		names = append(names, fmt.Sprintf("%s (%s)", audit.Name, strings.Join(audit.Exceeded, ", ")))
+	}
+	return "patches reveal too much source text: " + strings.Join(names, ", ")
+}
+
+// Exceeded describes each limit the leakage is over, like "deleted run 120 > 80"
+func (limits AuditLimits) Exceeded(leakage Leakage) (exceeded []string) {
+	checks := []struct {
+		name  string
+		value int
+		max   int
+	}{
+		{"context chars", leakage.ContextChars, limits.MaxContextChars},
+		{"deleted chars", leakage.DeletedChars, limits.MaxDeletedChars},
+		{"deleted run", leakage.LongestDeletedRun, limits.MaxDeletedRun},
+		{"verbatim run", leakage.LongestVerbatimRun, limits.MaxVerbatimRun},
+	}
+	for _, check := range checks {
+		if check.max > 0 && check.value > check.max {
+			exceeded = append(exceeded, fmt.Sprintf("%s %d > %d", check.name, check.value, check.max))
+		}
+	}
+	return
+}
+
+// AuditPatch measures the leakage of a patch (flat or page anchored) and checks it against limits
+// err is only set if the patch cannot be parsed; the limits it exceeds are listed in the audit.
+func AuditPatch(name string, patchText string, limits AuditLimits) (audit PatchAudit, err error) {
+	audit.Name = name
+	audit.Leakage, err = AuditPatchText(patchText)
+	if err != nil {
+		return
+	}
+	audit.Exceeded = limits.Exceeded(audit.Leakage)
+	return
+}
+
+// auditPatches returns a *LeakageError listing the patches that exceed limits
+func auditPatches(patches []PDFPatch, limits AuditLimits) error {
+	var exceeded []PatchAudit
+	for _, patch := range patches {
+		audit, err := AuditPatch(patch.PatchFileName(), patch.Patch, limits)
+		if err != nil {
+			return err
+		}
+		if len(audit.Exceeded) > 0 {
+			exceeded = append(exceeded, audit)
+		}
+	}
+	if len(exceeded) > 0 {
+		return &LeakageError{Audits: exceeded}
+	}
+	return nil
+}
+
+func (options Options) auditLimits() AuditLimits {
+	if options.AuditLimits == (AuditLimits{}) {
+		return DefaultAuditLimits
+	}
+	return options.AuditLimits
+}
+
+// AuditPatchText measures how much source text a patch (in diff-match-patch text format) reveals
+// Hashed patches are not measured since they hold no source text, though short spans of it may be guessed
+// from their hashes (see MakeHashedPatchText).
+func AuditPatchText(patchText string) (leakage Leakage, err error) {
+	if isHashedPatch(patchText) {
+		_, err = parseHashedPatch(patchText)
+		return
+	}
+	if !isPagePatch(patchText) {
+		var patches []diffmatchpatch.Patch
+		patches, err = diffmatchpatch.New().PatchFromText(patchText)
+		if err != nil {
+			return
+		}
+		auditHunks(&leakage, patches)
+		return
+	}
+	sections, err := parsePageSections(patchText)
+	if err != nil {
+		return
+	}
+	for _, pageNumber := range sortedPageNumbers(sections) {
+		auditHunks(&leakage, sections[pageNumber])
+	}
+	return
+}
+
+// auditHunks adds the leakage of hunks that were made against the same text
+func auditHunks(leakage *Leakage, patches []diffmatchpatch.Patch) {
+	// spans are the ranges of the source text revealed by each hunk
+	type span struct{ start, end int }
+	var spans []span
+	starts := hunkStarts(patches)
+	for i, aPatch := range patches {
+		for _, diff := range hunkDiffs(aPatch) {
+			switch diff.Type {
+			case diffmatchpatch.DiffEqual:
+				leakage.ContextChars += len(diff.Text)
+			case diffmatchpatch.DiffDelete:
+				leakage.DeletedChars += len(diff.Text)
+				if len(diff.Text) > leakage.LongestDeletedRun {
+					leakage.LongestDeletedRun = len(diff.Text)
+				}
+			}
+		}
+		spans = append(spans, span{starts[i], starts[i] + aPatch.Length1})
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	for i := 0; i < len(spans); {
+		run := spans[i]
+		for i++; i < len(spans) && spans[i].start <= run.end; i++ {
+			if spans[i].end > run.end {
+				run.end = spans[i].end
+			}
+		}
+		if run.end-run.start > leakage.LongestVerbatimRun {
+			leakage.LongestVerbatimRun = run.end - run.start
+		}
+	}
+}
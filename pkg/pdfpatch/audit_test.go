@@ -0,0 +1,101 @@
+package pdfpatch_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/motevets/pdfpatch/pkg/extractor"
+	"github.com/motevets/pdfpatch/pkg/manifest"
+	"github.com/motevets/pdfpatch/pkg/pdfpatch"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("auditing patches", func() {
+	Describe("AuditPatchText", func() {
+		It("measures the context and deleted text of each hunk", func() {
+			Expect(pdfpatch.AuditPatchText(computedPatch)).To(Equal(pdfpatch.Leakage{
+				ContextChars:       23,
+				DeletedChars:       9,
+				LongestDeletedRun:  5,
+				LongestVerbatimRun: 15,
+			}))
+		})
+
+		It("measures a deletion as one verbatim run", func() {
+			sentence := strings.Repeat("All work and no play. ", 10)
+			leakage, err := pdfpatch.AuditPatchText(pdfpatch.MakePatchText("Chapter 1. "+sentence+"The end.", "Chapter 1. The end."))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(leakage.LongestDeletedRun).To(Equal(len(sentence)))
+			Expect(leakage.LongestVerbatimRun).To(BeNumerically(">", len(sentence)))
+		})
+
+		It("measures the hunks of each page of a page anchored patch", func() {
+			pages := []extractor.Page{{Number: 1, Text: "TITLE PAGE "}, {Number: 2, Text: "This is chapter 1. "}}
+			patchText, err := pdfpatch.MakePagePatchText(pages, "\nTITLE\n\nThis is chapter 1.\n")
+			Expect(err).NotTo(HaveOccurred())
+			leakage, err := pdfpatch.AuditPatchText(patchText)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(leakage.DeletedChars).To(BeNumerically(">=", len("PAGE")))
+			Expect(leakage.LongestVerbatimRun).To(BeNumerically("<=", len("This is chapter 1. ")))
+		})
+
+		When("the patch is malformed", func() {
+			It("returns an error", func() {
+				_, err := pdfpatch.AuditPatchText("@@ not a hunk\n")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("AuditPatch", func() {
+		It("lists the limits the patch exceeds", func() {
+			audit, err := pdfpatch.AuditPatch("original.pdf.patch", computedPatch, pdfpatch.AuditLimits{MaxDeletedRun: 4, MaxVerbatimRun: 20})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(audit.Exceeded).To(Equal([]string{"deleted run 5 > 4"}))
+			Expect(audit.String()).To(Equal("original.pdf.patch: 23 context chars, 9 deleted chars (longest run 5), longest verbatim run 15 EXCEEDS deleted run 5 > 4"))
+		})
+	})
+
+	Describe("MakeBundle", func() {
+		const fixturesPath = "../../test/fixtures/one_pdf_two_markdowns"
+		var (
+			theManifest = manifest.Manifest{
+				Sources: []manifest.Source{{FileName: "original.pdf", PatchedFiles: []string{"chapter_1.md", "chapter_2.md"}}},
+				Styles:  []manifest.Style{{Name: "Traditional", StyleSheet: "book.css"}},
+			}
+			outputDir  string
+			bundlePath string
+		)
+
+		BeforeEach(func() {
+			var err error
+			outputDir, err = ioutil.TempDir("", "audit_test")
+			Expect(err).NotTo(HaveOccurred())
+			bundlePath = path.Join(outputDir, "bundle.zip")
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(outputDir)
+		})
+
+		It("fails when a patch reveals more source text than the limits allow", func() {
+			options := pdfpatch.Options{Extractor: "gopdf", AuditLimits: pdfpatch.AuditLimits{MaxVerbatimRun: 5}}
+			err := pdfpatch.MakeBundle(theManifest, fixturesPath, fixturesPath, "../../test/fixtures/patch_bundle/css", bundlePath, options)
+			var leakageErr *pdfpatch.LeakageError
+			Expect(errors.As(err, &leakageErr)).To(BeTrue())
+			Expect(leakageErr.Audits[0].Name).To(Equal("original.pdf.patch"))
+			Expect(bundlePath).NotTo(BeAnExistingFile())
+		})
+
+		It("makes the bundle with SkipAudit", func() {
+			options := pdfpatch.Options{Extractor: "gopdf", AuditLimits: pdfpatch.AuditLimits{MaxVerbatimRun: 5}, SkipAudit: true}
+			err := pdfpatch.MakeBundle(theManifest, fixturesPath, fixturesPath, "../../test/fixtures/patch_bundle/css", bundlePath, options)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bundlePath).To(BeAnExistingFile())
+		})
+	})
+})
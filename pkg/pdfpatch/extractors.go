@@ -0,0 +1,85 @@
+package pdfpatch
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+
+	"github.com/motevets/pdfpatch/pkg/extractor"
+	"github.com/motevets/pdfpatch/pkg/manifest"
+)
+
+// ExtractorMismatchError is returned when a patch is applied with a different extractor than it was generated with
+type ExtractorMismatchError struct {
+	FileName string
+	Expected string
+	Actual   string
+}
+
+func (e *ExtractorMismatchError) Error() string {
+	return fmt.Sprintf("%s was patched with the %s extractor but the %s extractor was chosen", e.FileName, e.Expected, e.Actual)
+}
+
+// chooseExtractor returns the extractor named in the options, falling back to the pinned extractor and then the default
+// The extractor reads and writes options.Cache if it is set.
+func chooseExtractor(pinned string, options Options) (chosen extractor.Extractor, err error) {
+	name := pinned
+	if options.Extractor != "" {
+		name = options.Extractor
+	}
+	chosen, err = extractor.New(name)
+	if err != nil {
+		return
+	}
+	return extractor.Cached(chosen, options.Cache), nil
+}
+
+// checkExtractor compares the extractor pinned by a source with the one chosen to apply its patch
+// A different extractor is an error unless options.AllowExtractorMismatch is set; a different
+// version of the same extractor is only logged since its text is usually identical.
+func checkExtractor(source manifest.Source, chosen extractor.Extractor, options Options) error {
+	if source.Extractor != "" && source.Extractor != chosen.Name() {
+		err := &ExtractorMismatchError{FileName: source.FileName, Expected: source.Extractor, Actual: chosen.Name()}
+		if !options.AllowExtractorMismatch {
+			return err
+		}
+		log.Println("WARNING:", err)
+	} else if source.ExtractorVersion != "" && source.ExtractorVersion != chosen.Version() {
+		log.Printf("WARNING: %s was patched with %s %s but %s is installed", source.FileName, chosen.Name(), source.ExtractorVersion, chosen.Version())
+	}
+	return nil
+}
+
+// extractText returns the text of a PDF on a single line, limited to the page ranges if any are given
+func extractText(ctx context.Context, textExtractor extractor.Extractor, pdfPath string, pages string) (string, error) {
+	if pages == "" {
+		return extractor.TextFromPDFContext(ctx, textExtractor, pdfPath)
+	}
+	selected, err := extractPages(ctx, textExtractor, pdfPath, pages)
+	if err != nil {
+		return "", err
+	}
+	return extractor.JoinPages(selected), nil
+}
+
+// extractPages returns the text of the pages of a PDF that are within the page ranges
+func extractPages(ctx context.Context, textExtractor extractor.Extractor, pdfPath string, pages string) (selected []extractor.Page, err error) {
+	ranges, err := manifest.ParsePageRanges(pages)
+	if err != nil {
+		return
+	}
+	allPages, err := extractor.PagesFromPDFContext(ctx, textExtractor, pdfPath)
+	if err != nil {
+		return
+	}
+	for _, page := range allPages {
+		if ranges.Contains(page.Number) {
+			selected = append(selected, page)
+		}
+	}
+	if len(selected) == 0 {
+		err = fmt.Errorf("%s has no pages in %q", path.Base(pdfPath), pages)
+	}
+	return
+}
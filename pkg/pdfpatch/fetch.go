@@ -0,0 +1,47 @@
+package pdfpatch
+
+import (
+	"context"
+	"os"
+
+	"github.com/motevets/pdfpatch/pkg/fetcher"
+	"github.com/motevets/pdfpatch/pkg/manifest"
+)
+
+// FetchSources makes sure every source PDF is in destDir, downloading the missing ones from their URLs
+// with options.Fetcher (see fetcher.FetchSource)
+// Sources sharing a file name are fetched once. The results are in the order of the sources.
+func FetchSources(sources []manifest.Source, destDir string, options Options) (results []fetcher.Result, err error) {
+	return FetchSourcesContext(context.Background(), sources, destDir, options)
+}
+
+// FetchSourcesContext is FetchSources stopping once ctx is done
+func FetchSourcesContext(ctx context.Context, sources []manifest.Source, destDir string, options Options) (results []fetcher.Result, err error) {
+	sourceFetcher := options.Fetcher
+	if sourceFetcher == nil {
+		sourceFetcher = fetcher.New(nil)
+	}
+	err = os.MkdirAll(destDir, 0755)
+	if err != nil {
+		return
+	}
+
+	var (
+		unique    []manifest.Source
+		fileNames []string
+		seen      = map[string]bool{}
+	)
+	for _, source := range sources {
+		if !seen[source.FileName] {
+			seen[source.FileName] = true
+			unique = append(unique, source)
+			fileNames = append(fileNames, source.FileName)
+		}
+	}
+	results = make([]fetcher.Result, len(unique))
+	err = forEachSource(ctx, fileNames, options.jobs(), func(i int) (err error) {
+		results[i], err = sourceFetcher.FetchSource(ctx, unique[i], destDir)
+		return
+	})
+	return
+}
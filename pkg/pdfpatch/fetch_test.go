@@ -0,0 +1,86 @@
+package pdfpatch_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/motevets/pdfpatch/pkg/fetcher"
+	"github.com/motevets/pdfpatch/pkg/manifest"
+	"github.com/motevets/pdfpatch/pkg/pdfpatch"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FetchSources", func() {
+	const pdfsDir = "../../test/fixtures/patch_bundle_pdfs"
+	var (
+		destDir  string
+		server   *httptest.Server
+		mutex    sync.Mutex
+		requests []string
+		options  pdfpatch.Options
+	)
+
+	BeforeEach(func() {
+		var err error
+		destDir, err = ioutil.TempDir("", "fetch_sources_test")
+		Expect(err).NotTo(HaveOccurred())
+		requests = nil
+		files := http.FileServer(http.Dir(pdfsDir))
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			requests = append(requests, r.URL.Path)
+			mutex.Unlock()
+			files.ServeHTTP(w, r)
+		}))
+		options = pdfpatch.Options{Fetcher: fetcher.New(nil)}
+		options.Fetcher.Client = server.Client()
+		options.Fetcher.Retries = 0
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(destDir)
+	})
+
+	It("downloads each source once into the directory", func() {
+		sources := []manifest.Source{
+			{FileName: "title_pages.pdf", URL: server.URL + "/title_pages.pdf", Pages: "1"},
+			{FileName: "title_pages.pdf", URL: server.URL + "/title_pages.pdf", Pages: "2-"},
+			{FileName: "chapter_1.pdf", URL: server.URL + "/chapter_1.pdf"},
+		}
+
+		results, err := pdfpatch.FetchSources(sources, path.Join(destDir, "pdfs"), options)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(HaveLen(2))
+		Expect(results[0].FileName).To(Equal("title_pages.pdf"))
+		Expect(results[1].FileName).To(Equal("chapter_1.pdf"))
+		Expect(requests).To(ConsistOf("/title_pages.pdf", "/chapter_1.pdf"))
+		for _, fileName := range []string{"title_pages.pdf", "chapter_1.pdf"} {
+			expected, err := ioutil.ReadFile(path.Join(pdfsDir, fileName))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.ReadFile(path.Join(destDir, "pdfs", fileName))).To(Equal(expected))
+		}
+	})
+
+	It("fetches every source and reports each that fails", func() {
+		sources := []manifest.Source{
+			{FileName: "missing.pdf", URL: server.URL + "/missing.pdf"},
+			{FileName: "chapter_1.pdf", URL: server.URL + "/chapter_1.pdf"},
+			{FileName: "no_url.pdf"},
+		}
+
+		results, err := pdfpatch.FetchSources(sources, destDir, options)
+		var sourceErrs pdfpatch.SourceErrors
+		Expect(errors.As(err, &sourceErrs)).To(BeTrue())
+		Expect(sourceErrs).To(HaveLen(2))
+		Expect(sourceErrs[0].FileName).To(Equal("missing.pdf"))
+		Expect(sourceErrs[1].Err).To(MatchError(&fetcher.NoURLError{FileName: "no_url.pdf"}))
+		Expect(results[1].Status).To(Equal(fetcher.Downloaded))
+	})
+})
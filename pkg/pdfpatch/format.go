@@ -0,0 +1,59 @@
+package pdfpatch
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/motevets/pdfpatch/pkg/epubbinder"
+	"github.com/motevets/pdfpatch/pkg/pdfbinder"
+	"github.com/motevets/pdfpatch/pkg/workspace"
+)
+
+const (
+	// FormatPDF binds the patched text into a PDF with a pdfbinder renderer
+	FormatPDF = "pdf"
+	// FormatEPUB binds the patched text into an EPUB 3 book
+	FormatEPUB = "epub"
+)
+
+// Formats are the formats of output documents that can be made
+var Formats = []string{FormatPDF, FormatEPUB}
+
+// checkFormat checks the output format and, for PDFs, the renderer of options are known
+func checkFormat(options Options) (err error) {
+	switch options.Format {
+	case "", FormatPDF:
+		_, err = pdfbinder.NewRenderer(options.Renderer)
+	case FormatEPUB:
+	default:
+		err = fmt.Errorf("unknown format %q (must be one of %v)", options.Format, Formats)
+	}
+	return
+}
+
+// bind binds the patched markdowns into the output document in the format of options
+func bind(ctx context.Context, ws *workspace.Workspace, markdownsDir string, cssFile string, outputPath string, options Options) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	book := options.Book
+	if options.Format == FormatEPUB {
+		return epubbinder.BindEpub(markdownsDir, cssFile, outputPath, epubbinder.Options{
+			Title:       book.Title,
+			Language:    book.Language,
+			Identifier:  book.Identifier,
+			Subtitle:    book.Subtitle,
+			Authors:     book.Authors,
+			Publisher:   book.Publisher,
+			Rights:      book.Rights,
+			Description: book.Description,
+		})
+	}
+	bindOptions := pdfbinder.Options{Renderer: options.Renderer, Workspace: ws, Metadata: pdfbinder.Metadata(book)}
+	if options.Progress != nil {
+		bindOptions.OnPage = func(page int) {
+			options.report(ProgressEvent{Stage: StageRendering, Page: page})
+		}
+	}
+	return pdfbinder.BindPdfContext(ctx, markdownsDir, cssFile, outputPath, bindOptions)
+}
@@ -0,0 +1,300 @@
+package pdfpatch
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// hashedFormatHeader is the first line of a hashed patch
+//
+// Each hunk of a hashed patch starts with "@@ OFFSET @@", the byte offset of the hunk in the source text,
+// followed by one line for each part of the hunk in order:
+//
+//	=LENGTH HASH   LENGTH bytes of source text kept as context, whose hash is HASH
+//	-LENGTH HASH   LENGTH bytes of source text deleted, whose hash is HASH
+//	+TEXT          inserted text, URL encoded like diff-match-patch
+//
+// so the patch holds none of the source text, only the text it inserts. The hashes are neither salted nor
+// keyed, so they keep the source text out of sight rather than secret: a short span like a single deleted
+// word or the few characters of context around a change can be found by hashing guesses of it.
+const hashedFormatHeader = "#pdfpatch hashed"
+
+// hashedSearchDistance is how far from its expected offset a hunk of a hashed patch is looked for,
+// like the match distance of diff-match-patch
+const hashedSearchDistance = 1000
+
+// hashBase is the multiplier of the rolling hash (the 64 bit FNV prime)
+const hashBase = 1099511628211
+
+func isHashedPatch(patchText string) bool {
+	return strings.HasPrefix(patchText, hashedFormatHeader+"\n")
+}
+
+// hashedHunk is a hunk of a hashed patch
+// Offset is where the source text of the hunk starts in the text the patch was made against.
+type hashedHunk struct {
+	Offset int
+	Parts  []hashedPart
+}
+
+// hashedPart is a run of source text kept or deleted by a hunk (Length and Hash) or inserted text (Text)
+type hashedPart struct {
+	Type   diffmatchpatch.Operation
+	Length int
+	Hash   uint64
+	Text   string
+}
+
+// sourceLength is the length of the source text the hunk keeps or deletes
+func (hunk hashedHunk) sourceLength() (length int) {
+	for _, part := range hunk.Parts {
+		if part.Type != diffmatchpatch.DiffInsert {
+			length += part.Length
+		}
+	}
+	return
+}
+
+// matches reports whether the source text of the hunk is found in text at start
+func (hunk hashedHunk) matches(text string, start int) bool {
+	if start < 0 || start+hunk.sourceLength() > len(text) {
+		return false
+	}
+	for _, part := range hunk.Parts {
+		if part.Type == diffmatchpatch.DiffInsert {
+			continue
+		}
+		if mixHash(spanHash(text[start:start+part.Length])) != part.Hash {
+			return false
+		}
+		start += part.Length
+	}
+	return true
+}
+
+// MakeHashedPatchText makes a patch that turns text into target without holding any of text
+// The hunks are those of MakePatchText with the context and deleted text of each replaced by its length and hash.
+// Short spans of text may still be guessed from their hashes (see hashedFormatHeader).
+func MakeHashedPatchText(text string, target string) string {
+	dmp := diffmatchpatch.New()
+	patches := dmp.PatchMake(dmp.DiffMain(text, target, false))
+
+	var builder strings.Builder
+	builder.WriteString(hashedFormatHeader + "\n")
+	starts := hunkStarts(patches)
+	for i, aPatch := range patches {
+		fmt.Fprintf(&builder, "@@ %d @@\n", starts[i])
+		for _, diff := range hunkDiffs(aPatch) {
+			switch diff.Type {
+			case diffmatchpatch.DiffInsert:
+				builder.WriteString("+" + encodeInsertion(diff.Text) + "\n")
+			case diffmatchpatch.DiffDelete:
+				fmt.Fprintf(&builder, "-%d %016x\n", len(diff.Text), mixHash(spanHash(diff.Text)))
+			default:
+				fmt.Fprintf(&builder, "=%d %016x\n", len(diff.Text), mixHash(spanHash(diff.Text)))
+			}
+		}
+	}
+	return builder.String()
+}
+
+// ApplyHashedPatchText applies a hashed patch to text
+// Each hunk is only applied where the hashes of all of its source text match, near where it is expected,
+// and is otherwise rejected.
+func ApplyHashedPatchText(text string, patchText string) (result PatchResult, err error) {
+	hunks, err := parseHashedPatch(patchText)
+	if err != nil {
+		return
+	}
+	dmp := diffmatchpatch.New()
+	// shift is how far the text has moved from the text the patch was made against
+	shift := 0
+	result.Hunks = make([]HunkResult, len(hunks))
+	for i, hunk := range hunks {
+		expected := hunk.Offset + shift
+		result.Hunks[i] = HunkResult{Number: i + 1, Expected: expected, Actual: -1}
+		start := findHashedHunk(text, hunk, expected)
+		if start == -1 {
+			continue
+		}
+
+		var (
+			patched strings.Builder
+			diffs   []diffmatchpatch.Diff
+		)
+		patched.WriteString(text[:start])
+		end := start
+		for _, part := range hunk.Parts {
+			switch part.Type {
+			case diffmatchpatch.DiffInsert:
+				patched.WriteString(part.Text)
+				diffs = append(diffs, diffmatchpatch.Diff{Type: part.Type, Text: part.Text})
+			case diffmatchpatch.DiffDelete:
+				diffs = append(diffs, diffmatchpatch.Diff{Type: part.Type, Text: text[end : end+part.Length]})
+				end += part.Length
+			default:
+				patched.WriteString(text[end : end+part.Length])
+				diffs = append(diffs, diffmatchpatch.Diff{Type: part.Type, Text: text[end : end+part.Length]})
+				end += part.Length
+			}
+		}
+		patched.WriteString(text[end:])
+		newText := patched.String()
+
+		result.Hunks[i].Applied = true
+		result.Hunks[i].Actual = start
+		result.Hunks[i].Offset = start - expected
+		result.Hunks[i].Diffs = appliedDiffs(dmp, diffs, newText, start, "")
+		shift = start - hunk.Offset + len(newText) - len(text)
+		text = newText
+	}
+	result.Text = text
+	return
+}
+
+// findHashedHunk returns where the source text of a hunk is in text nearest to expected, or -1
+// Positions within hashedSearchDistance of expected are checked with a rolling hash of the first part
+// of the hunk before checking the hashes of every part.
+func findHashedHunk(text string, hunk hashedHunk, expected int) int {
+	var first *hashedPart
+	for i := range hunk.Parts {
+		if hunk.Parts[i].Type != diffmatchpatch.DiffInsert {
+			first = &hunk.Parts[i]
+			break
+		}
+	}
+	if first == nil {
+		if expected < 0 || expected > len(text) {
+			return -1
+		}
+		return expected
+	}
+
+	from, to := expected-hashedSearchDistance, expected+hashedSearchDistance
+	if from < 0 {
+		from = 0
+	}
+	if to > len(text)-first.Length {
+		to = len(text) - first.Length
+	}
+	if from > to {
+		return -1
+	}
+
+	best := -1
+	hash, power := spanHash(text[from:from+first.Length]), hashPower(first.Length)
+	for start := from; ; start++ {
+		if mixHash(hash) == first.Hash && hunk.matches(text, start) && (best == -1 || absInt(start-expected) < absInt(best-expected)) {
+			best = start
+		}
+		if start == to {
+			break
+		}
+		hash = (hash-uint64(text[start])*power)*hashBase + uint64(text[start+first.Length])
+	}
+	return best
+}
+
+// spanHash is the polynomial rolling hash of text, which can be moved along a string a byte at a time
+func spanHash(text string) (hash uint64) {
+	for i := 0; i < len(text); i++ {
+		hash = hash*hashBase + uint64(text[i])
+	}
+	return
+}
+
+// mixHash scrambles the bits of a rolling hash so the hash of a short span does not show its bytes
+// (the finalizer of SplitMix64)
+func mixHash(hash uint64) uint64 {
+	hash = (hash ^ (hash >> 30)) * 0xbf58476d1ce4e5b9
+	hash = (hash ^ (hash >> 27)) * 0x94d049bb133111eb
+	return hash ^ (hash >> 31)
+}
+
+// hashPower is the weight of the first byte of a span of length bytes in its hash
+func hashPower(length int) uint64 {
+	power := uint64(1)
+	for i := 1; i < length; i++ {
+		power *= hashBase
+	}
+	return power
+}
+
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// encodeInsertion URL encodes inserted text the way diff-match-patch does
+func encodeInsertion(text string) string {
+	return strings.Replace(url.QueryEscape(text), "+", " ", -1)
+}
+
+// parseHashedPatch returns the hunks of a hashed patch
+func parseHashedPatch(patchText string) (hunks []hashedHunk, err error) {
+	if !isHashedPatch(patchText) {
+		err = fmt.Errorf("not a hashed patch")
+		return
+	}
+	lines := strings.Split(strings.TrimPrefix(patchText, hashedFormatHeader+"\n"), "\n")
+	for i, line := range lines {
+		lineNumber := i + 2
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "@@ ") {
+			var offset int
+			offset, err = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(line, "@@ "), " @@"))
+			if err != nil || offset < 0 || !strings.HasSuffix(line, " @@") {
+				return nil, fmt.Errorf("line %d: invalid hunk header %q", lineNumber, line)
+			}
+			hunks = append(hunks, hashedHunk{Offset: offset})
+			continue
+		}
+		if len(hunks) == 0 {
+			return nil, fmt.Errorf("line %d: patch text before the first hunk: %q", lineNumber, line)
+		}
+		var part hashedPart
+		part, err = parseHashedPart(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+		hunk := &hunks[len(hunks)-1]
+		hunk.Parts = append(hunk.Parts, part)
+	}
+	return
+}
+
+func parseHashedPart(line string) (part hashedPart, err error) {
+	switch line[0] {
+	case '+':
+		part.Type = diffmatchpatch.DiffInsert
+		part.Text, err = url.QueryUnescape(strings.Replace(line[1:], "+", "%2b", -1))
+		return
+	case '-':
+		part.Type = diffmatchpatch.DiffDelete
+	case '=':
+		part.Type = diffmatchpatch.DiffEqual
+	default:
+		return part, fmt.Errorf("invalid hunk line %q", line)
+	}
+	fields := strings.Fields(line[1:])
+	if len(fields) != 2 {
+		return part, fmt.Errorf("hunk line %q must be a length and a hash", line)
+	}
+	part.Length, err = strconv.Atoi(fields[0])
+	if err != nil || part.Length < 1 {
+		return part, fmt.Errorf("invalid length in hunk line %q", line)
+	}
+	part.Hash, err = strconv.ParseUint(fields[1], 16, 64)
+	if err != nil {
+		return part, fmt.Errorf("invalid hash in hunk line %q", line)
+	}
+	return
+}
@@ -0,0 +1,116 @@
+package pdfpatch_test
+
+import (
+	"os"
+	"path"
+
+	"github.com/motevets/pdfpatch/pkg/pdfpatch"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("hashed patches", func() {
+	const text = "Hello from chapter 1. Hallo von Kapitel 2. "
+
+	var patchText string
+
+	BeforeEach(func() {
+		patchText = pdfpatch.MakeHashedPatchText(text, finalOutput)
+	})
+
+	Describe("MakeHashedPatchText", func() {
+		It("holds the inserted text but none of the source text", func() {
+			Expect(patchText).To(HavePrefix("#pdfpatch hashed\n@@ 0 @@\n"))
+			Expect(patchText).To(ContainSubstring("wiedersehen"))
+			Expect(patchText).NotTo(ContainSubstring("Hallo"))
+			Expect(patchText).NotTo(ContainSubstring("Kapitel"))
+		})
+	})
+
+	Describe("ApplyPatchText", func() {
+		It("applies hashed patches", func() {
+			result, err := pdfpatch.ApplyPatchText(text, patchText)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Rejected()).To(BeEmpty())
+			Expect(result.Text).To(Equal(finalOutput))
+		})
+
+		It("applies text that is not ASCII", func() {
+			source := "Grüße aus Kapitel 1. Tschüß! "
+			target := "\nGrüße aus dem Kapitel 1.\n\nTschüss!\n"
+			result, err := pdfpatch.ApplyPatchText(source, pdfpatch.MakeHashedPatchText(source, target))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Text).To(Equal(target))
+		})
+
+		When("the text has drifted from the text the patch was made against", func() {
+			It("finds the hunks by their hashes and reports the offset", func() {
+				result, err := pdfpatch.ApplyPatchText("Preface. "+text, patchText)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Rejected()).To(BeEmpty())
+				Expect(result.Text).To(Equal("Preface. " + finalOutput))
+				Expect(result.Hunks[0].Offset).To(Equal(len("Preface. ")))
+				Expect(len(result.Hunks)).To(BeNumerically(">", 1))
+				for _, hunk := range result.Hunks {
+					Expect(hunk.Expected + hunk.Offset).To(Equal(hunk.Actual))
+				}
+			})
+		})
+
+		When("the source text of a hunk does not match its hashes", func() {
+			It("rejects the hunk", func() {
+				result, err := pdfpatch.ApplyPatchText("Hello from chapter 1. Hello von Kapitel 2. ", patchText)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Rejected()).NotTo(BeEmpty())
+				Expect(result.Applied()).To(BeNumerically(">", 0))
+			})
+		})
+
+		When("the patch is malformed", func() {
+			It("returns an error with the line", func() {
+				_, err := pdfpatch.ApplyPatchText(text, "#pdfpatch hashed\n@@ 0 @@\n=4 not-a-hash\n")
+				Expect(err).To(MatchError(ContainSubstring("line 3: invalid hash")))
+			})
+		})
+	})
+
+	Describe("AuditPatchText", func() {
+		It("finds no source text in hashed patches", func() {
+			Expect(pdfpatch.AuditPatchText(patchText)).To(Equal(pdfpatch.Leakage{}))
+		})
+	})
+
+	Describe("ReversePatchText", func() {
+		It("cannot reverse hashed patches", func() {
+			_, err := pdfpatch.ReversePatchText(patchText)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("GeneratePatch with the gopdf extractor", func() {
+		const fixturesPath = "../../test/fixtures/one_pdf_two_markdowns"
+		var pdfPath = path.Join(fixturesPath, "original.pdf")
+		var markdownPaths = []string{path.Join(fixturesPath, "chapter_1.md"), path.Join(fixturesPath, "chapter_2.md")}
+
+		It("round trips a hashed patch", func() {
+			options := pdfpatch.Options{Extractor: "gopdf", Hashed: true}
+			patch, err := pdfpatch.GeneratePatch(pdfPath, markdownPaths, options)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(patch).To(HavePrefix("#pdfpatch hashed\n"))
+			patchFilePath := writePatchFile(patch)
+			defer os.Remove(patchFilePath)
+
+			result, err := pdfpatch.ApplyPatch(pdfPath, patchFilePath, pdfpatch.Options{Extractor: "gopdf"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Rejected()).To(BeEmpty())
+			Expect(result.Text).To(Equal(finalOutput))
+		})
+
+		When("the patch is also page anchored", func() {
+			It("returns an error", func() {
+				_, err := pdfpatch.GeneratePatch(pdfPath, markdownPaths, pdfpatch.Options{Extractor: "gopdf", Hashed: true, PageAnchored: true})
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+})
@@ -0,0 +1,209 @@
+package pdfpatch
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/motevets/pdfpatch/pkg/extractor"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// pagesFormatHeader is the first line of a page anchored patch
+//
+// A page anchored patch is made of sections, one for each page that changes, where each
+// section is a "#page N" line followed by a diff-match-patch patch of the text of page N:
+//
+//	#pdfpatch pages
+//	#page 3
+//	@@ -1,8 +1,17 @@
+//	...
+//
+// Hunks are located relative to the start of their page so a difference in the text of one
+// page cannot shift the hunks of another. Pages without a section are passed through unchanged.
+const pagesFormatHeader = "#pdfpatch pages"
+
+const pageSectionPrefix = "#page "
+
+// isPagePatch reports whether patchText is a page anchored patch
+func isPagePatch(patchText string) bool {
+	return strings.HasPrefix(patchText, pagesFormatHeader+"\n")
+}
+
+// MakePatchText makes a diff-match-patch patch that turns text into target
+func MakePatchText(text string, target string) string {
+	dmp := diffmatchpatch.New()
+	diffs := dmp.DiffMain(text, target, false)
+	patches := dmp.PatchMake(diffs)
+	return dmp.PatchToText(patches)
+}
+
+// MakePagePatchText makes a page anchored patch that turns the text of pages into target
+func MakePagePatchText(pages []extractor.Page, target string) (patchText string, err error) {
+	if len(pages) == 0 {
+		err = fmt.Errorf("cannot make a page anchored patch without pages")
+		return
+	}
+	dmp := diffmatchpatch.New()
+	diffs := dmp.DiffMain(extractor.JoinPages(pages), target, false)
+	pageDiffs := splitDiffsByPage(diffs, pages)
+
+	var builder strings.Builder
+	builder.WriteString(pagesFormatHeader + "\n")
+	for i, page := range pages {
+		if !hasChanges(pageDiffs[i]) {
+			continue
+		}
+		patches := dmp.PatchMake(page.Text, pageDiffs[i])
+		fmt.Fprintf(&builder, "%s%d\n%s", pageSectionPrefix, page.Number, dmp.PatchToText(patches))
+	}
+	patchText = builder.String()
+	return
+}
+
+// splitDiffsByPage divides diffs of the joined page text into diffs of the text of each page
+// Insertions at a page boundary belong to the start of the following page.
+func splitDiffsByPage(diffs []diffmatchpatch.Diff, pages []extractor.Page) [][]diffmatchpatch.Diff {
+	pageDiffs := make([][]diffmatchpatch.Diff, len(pages))
+	pageIndex := 0
+	pageRemaining := len(pages[0].Text)
+	nextPage := func() {
+		for pageRemaining == 0 && pageIndex < len(pages)-1 {
+			pageIndex++
+			pageRemaining = len(pages[pageIndex].Text)
+		}
+	}
+	for _, diff := range diffs {
+		if diff.Type == diffmatchpatch.DiffInsert {
+			nextPage()
+			pageDiffs[pageIndex] = append(pageDiffs[pageIndex], diff)
+			continue
+		}
+		text := diff.Text
+		for len(text) > 0 {
+			nextPage()
+			length := len(text)
+			if length > pageRemaining && pageIndex < len(pages)-1 {
+				length = pageRemaining
+			}
+			pageDiffs[pageIndex] = append(pageDiffs[pageIndex], diffmatchpatch.Diff{Type: diff.Type, Text: text[:length]})
+			pageRemaining -= length
+			text = text[length:]
+		}
+	}
+	return pageDiffs
+}
+
+func hasChanges(diffs []diffmatchpatch.Diff) bool {
+	for _, diff := range diffs {
+		if diff.Type != diffmatchpatch.DiffEqual {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyPagePatchText applies a page anchored patch to the text of pages
+// Hunks for pages that are missing are rejected.
+func ApplyPagePatchText(pages []extractor.Page, patchText string) (result PatchResult, err error) {
+	sections, err := parsePageSections(patchText)
+	if err != nil {
+		return
+	}
+	dmp := diffmatchpatch.New()
+	var builder strings.Builder
+	appendHunks := func(pageNumber int, hunks []HunkResult) {
+		for _, hunk := range hunks {
+			hunk.Number = len(result.Hunks) + 1
+			hunk.Page = pageNumber
+			result.Hunks = append(result.Hunks, hunk)
+		}
+	}
+
+	found := map[int]bool{}
+	for _, page := range pages {
+		found[page.Number] = true
+		patches, ok := sections[page.Number]
+		if !ok {
+			builder.WriteString(page.Text)
+			continue
+		}
+		pageText, hunks := applyPatches(dmp, patches, page.Text)
+		builder.WriteString(pageText)
+		appendHunks(page.Number, hunks)
+	}
+	for _, pageNumber := range sortedPageNumbers(sections) {
+		if found[pageNumber] {
+			continue
+		}
+		appendHunks(pageNumber, rejectAll(dmp, sections[pageNumber]))
+	}
+	result.Text = builder.String()
+	return
+}
+
+// parsePageSections returns the patches of each page in a page anchored patch
+func parsePageSections(patchText string) (sections map[int][]diffmatchpatch.Patch, err error) {
+	if !isPagePatch(patchText) {
+		err = fmt.Errorf("not a page anchored patch")
+		return
+	}
+	dmp := diffmatchpatch.New()
+	sections = map[int][]diffmatchpatch.Patch{}
+	lines := strings.SplitAfter(strings.TrimPrefix(patchText, pagesFormatHeader+"\n"), "\n")
+	pageNumber := 0
+	var section strings.Builder
+	flush := func() error {
+		if pageNumber == 0 {
+			return nil
+		}
+		patches, err := dmp.PatchFromText(section.String())
+		if err != nil {
+			return fmt.Errorf("page %d: %v", pageNumber, err)
+		}
+		sections[pageNumber] = append(sections[pageNumber], patches...)
+		section.Reset()
+		return nil
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, pageSectionPrefix) {
+			if pageNumber == 0 && strings.TrimSpace(line) != "" {
+				return nil, fmt.Errorf("patch text before the first page section: %q", line)
+			}
+			section.WriteString(line)
+			continue
+		}
+		if err = flush(); err != nil {
+			return
+		}
+		pageNumber, err = strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, pageSectionPrefix)))
+		if err != nil || pageNumber < 1 {
+			return nil, fmt.Errorf("invalid page section %q", strings.TrimSpace(line))
+		}
+	}
+	err = flush()
+	return
+}
+
+// rejectAll returns the results of patches that could not be applied at all
+func rejectAll(dmp *diffmatchpatch.DiffMatchPatch, patches []diffmatchpatch.Patch) []HunkResult {
+	hunks := make([]HunkResult, len(patches))
+	for i, aPatch := range patches {
+		hunks[i] = HunkResult{
+			Number:   i + 1,
+			Expected: aPatch.Start2,
+			Actual:   -1,
+			Context:  dmp.DiffText1(hunkDiffs(aPatch)),
+		}
+	}
+	return hunks
+}
+
+func sortedPageNumbers(sections map[int][]diffmatchpatch.Patch) (pageNumbers []int) {
+	for pageNumber := range sections {
+		pageNumbers = append(pageNumbers, pageNumber)
+	}
+	sort.Ints(pageNumbers)
+	return
+}
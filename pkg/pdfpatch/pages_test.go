@@ -0,0 +1,109 @@
+package pdfpatch_test
+
+import (
+	"strings"
+
+	"github.com/motevets/pdfpatch/pkg/extractor"
+	"github.com/motevets/pdfpatch/pkg/pdfpatch"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("page anchored patches", func() {
+	var pages = []extractor.Page{
+		{Number: 1, Text: "TITLE PAGE "},
+		{Number: 2, Text: "Dedicated to my fellow men. "},
+		{Number: 3, Text: "This is chapter 1. "},
+	}
+	const target = "\nNEW TITLE PAGE\n\nDedicated to my fellow men.\n\nThis is chapter 1.\n\nIt's pretty great.\n"
+
+	var patchText string
+
+	BeforeEach(func() {
+		var err error
+		patchText, err = pdfpatch.MakePagePatchText(pages, target)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Describe("MakePagePatchText", func() {
+		It("writes a section for each page that changes", func() {
+			Expect(patchText).To(HavePrefix("#pdfpatch pages\n#page 1\n@@ "))
+			Expect(patchText).To(ContainSubstring("\n#page 3\n@@ "))
+		})
+
+		When("there are no pages", func() {
+			It("returns an error", func() {
+				_, err := pdfpatch.MakePagePatchText(nil, target)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("ApplyPagePatchText", func() {
+		It("patches the text of every page", func() {
+			result, err := pdfpatch.ApplyPagePatchText(pages, patchText)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Text).To(Equal(target))
+			Expect(result.Rejected()).To(BeEmpty())
+			for _, hunk := range result.Hunks {
+				Expect(hunk.Page).To(BeNumerically(">", 0))
+			}
+		})
+
+		It("does not let a difference on one page shift the hunks of another", func() {
+			changedPages := []extractor.Page{
+				{Number: 1, Text: "TITLE PAGE (second printing, with an added subtitle) "},
+				pages[1],
+				pages[2],
+			}
+			result, err := pdfpatch.ApplyPagePatchText(changedPages, patchText)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Rejected()).To(BeEmpty())
+			for _, hunk := range result.Hunks {
+				if hunk.Page == 3 {
+					Expect(hunk.Offset).To(Equal(0))
+				}
+			}
+			Expect(result.Text).To(HaveSuffix("This is chapter 1.\n\nIt's pretty great.\n"))
+		})
+
+		It("rejects the hunks of pages that are missing", func() {
+			result, err := pdfpatch.ApplyPagePatchText(pages[:2], patchText)
+			Expect(err).NotTo(HaveOccurred())
+			rejected := result.Rejected()
+			Expect(rejected).NotTo(BeEmpty())
+			for _, hunk := range rejected {
+				Expect(hunk.Page).To(Equal(3))
+			}
+		})
+
+		When("the patch is not page anchored", func() {
+			It("returns an error", func() {
+				_, err := pdfpatch.ApplyPagePatchText(pages, pdfpatch.MakePatchText(extractor.JoinPages(pages), target))
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		When("a page section is invalid", func() {
+			It("returns an error", func() {
+				_, err := pdfpatch.ApplyPagePatchText(pages, "#pdfpatch pages\n#page three\n")
+				Expect(err).To(MatchError(`invalid page section "#page three"`))
+			})
+		})
+	})
+
+	Describe("ApplyPatchText", func() {
+		It("refuses page anchored patches", func() {
+			_, err := pdfpatch.ApplyPatchText(extractor.JoinPages(pages), patchText)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("still applies flat patches", func() {
+			flatPatch := pdfpatch.MakePatchText(extractor.JoinPages(pages), target)
+			Expect(strings.HasPrefix(flatPatch, "@@")).To(BeTrue())
+			result, err := pdfpatch.ApplyPatchText(extractor.JoinPages(pages), flatPatch)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Text).To(Equal(target))
+		})
+	})
+})
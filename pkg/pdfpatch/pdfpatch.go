@@ -1,32 +1,98 @@
 package pdfpatch
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"path"
+	"strings"
 
 	"github.com/motevets/pdfpatch/pkg/extractor"
+	"github.com/motevets/pdfpatch/pkg/fetcher"
 	"github.com/motevets/pdfpatch/pkg/manifest"
-	"github.com/motevets/pdfpatch/pkg/pdfbinder"
-	"github.com/sergi/go-diff/diffmatchpatch"
+	"github.com/motevets/pdfpatch/pkg/workspace"
 )
 
 type PDFMarkdowns struct {
 	PDFFileName       string
 	MarkdownFileNames []string
+	Extractor         string
+	Pages             string
 }
 
 type PDFPatch struct {
-	PDFFileName string
-	Patch       string
+	PDFFileName      string
+	Patch            string
+	Extractor        string
+	ExtractorVersion string
+	Pages            string
 }
 
-func GeneratePatch(inputPDFFile string, markdownFiles []string) (patch string, err error) {
+// PatchFileName returns the name of the file the patch should be written to
+func (patch PDFPatch) PatchFileName() string {
+	return manifest.PatchFileName(patch.PDFFileName, patch.Pages)
+}
+
+// Options configures how patches are generated and applied
+// AllowRejectedHunks logs hunks that could not be applied as warnings instead of failing
+// SkipVerify skips checking source PDFs against the checksums in the manifest
+// Extractor is the name of the text extractor to use instead of the one pinned by each source (or the default)
+// AllowExtractorMismatch logs using a different extractor than a patch was generated with instead of failing
+// PageAnchored generates page anchored patches whose hunks are located relative to their page
+// Hashed generates hashed patches holding the lengths and hashes of the source text instead of the text itself
+// (see MakeHashedPatchText), which cannot also be page anchored
+// Pages limits GeneratePatch and ApplyPatch to page ranges of the PDF like "1-4,9,12-"
+// Renderer is the name of the renderer used to bind the PDF instead of the one named by the style (or the default)
+// Format is the format of the output document, FormatPDF (the default) or FormatEPUB
+// Progress (optional) is called as PatchPDF and PatchBundle move through each stage, source PDF and rendered page
+// (one event at a time, with the events of each source in the order they finish)
+// KeepWorkDir leaves the work directory with the intermediate files of a run in place instead of removing it
+// Jobs is the number of source PDFs processed at the same time (default: the number of CPUs)
+// Cache (optional) is where the text extracted from PDFs is looked up before extracting it again
+// SkipAudit skips checking that the patches of MakeBundle reveal no more source text than AuditLimits allow
+// AuditLimits are the limits MakeBundle checks patches against (default: DefaultAuditLimits)
+// Book (optional) is the metadata written into the output document, PatchBundle uses the book of the manifest
+// unless it is set
+// Fetcher (optional) downloads the source PDFs missing from the input directory of PatchBundle from the URLs in
+// the manifest before patching (see FetchSources)
+type Options struct {
+	AllowRejectedHunks     bool
+	SkipVerify             bool
+	Extractor              string
+	AllowExtractorMismatch bool
+	PageAnchored           bool
+	Hashed                 bool
+	Pages                  string
+	Renderer               string
+	Format                 string
+	Progress               func(event ProgressEvent)
+	KeepWorkDir            bool
+	Jobs                   int
+	Cache                  *extractor.Cache
+	SkipAudit              bool
+	AuditLimits            AuditLimits
+	Book                   manifest.Book
+	Fetcher                *fetcher.Fetcher
+}
+
+// GeneratePatch diffs the text extracted from a PDF against the concatenated markdown files
+// With options.PageAnchored the patch is made page by page (see MakePagePatchText).
+// With options.Hashed the patch holds only hashes of the extracted text (see MakeHashedPatchText).
+func GeneratePatch(inputPDFFile string, markdownFiles []string, options Options) (patch string, err error) {
+	return GeneratePatchContext(context.Background(), inputPDFFile, markdownFiles, options)
+}
+
+// GeneratePatchContext is GeneratePatch stopping text extraction once ctx is done
+func GeneratePatchContext(ctx context.Context, inputPDFFile string, markdownFiles []string, options Options) (patch string, err error) {
 	if len(markdownFiles) == 0 {
 		log.Println("WARNING: empty list of markdown files to diff against", inputPDFFile)
 	}
-	extractedText, err := extractor.TextFromPDF(inputPDFFile)
+	if options.Hashed && options.PageAnchored {
+		err = fmt.Errorf("hashed patches cannot be page anchored")
+		return
+	}
+	textExtractor, err := chooseExtractor("", options)
 	if err != nil {
 		return
 	}
@@ -34,28 +100,121 @@ func GeneratePatch(inputPDFFile string, markdownFiles []string) (patch string, e
 	if err != nil {
 		return
 	}
-	dmp := diffmatchpatch.New()
-	diffs := dmp.DiffMain(extractedText, markdownFilesText, false)
-	patches := dmp.PatchMake(diffs)
-	return dmp.PatchToText(patches), nil
+	if options.PageAnchored {
+		var pages []extractor.Page
+		pages, err = extractPages(ctx, textExtractor, inputPDFFile, options.Pages)
+		if err != nil {
+			return
+		}
+		return MakePagePatchText(pages, markdownFilesText)
+	}
+	extractedText, err := extractText(ctx, textExtractor, inputPDFFile, options.Pages)
+	if err != nil {
+		return
+	}
+	if options.Hashed {
+		return MakeHashedPatchText(extractedText, markdownFilesText), nil
+	}
+	return MakePatchText(extractedText, markdownFilesText), nil
+}
+
+// GeneratePatches generates a patch for each PDF using the extractor named by each PDFMarkdowns
+// unless options.Extractor is set, limited to the pages of each PDFMarkdowns
+// Up to options.Jobs PDFs are extracted and diffed at the same time but the patches are returned in
+// the order of pdfMarkdownsList. If more than one PDF fails a SourceErrors listing each is returned.
+func GeneratePatches(pdfMarkdownsList []PDFMarkdowns, pdfsDir string, markdownsDir string, options Options) (patches []PDFPatch, err error) {
+	return GeneratePatchesContext(context.Background(), pdfMarkdownsList, pdfsDir, markdownsDir, options)
 }
 
-func GeneratePatches(pdfMarkdownsList []PDFMarkdowns, pdfsDir string, markdownsDir string) (patches []PDFPatch, err error) {
+// GeneratePatchesContext is GeneratePatches stopping once ctx is done
+func GeneratePatchesContext(ctx context.Context, pdfMarkdownsList []PDFMarkdowns, pdfsDir string, markdownsDir string, options Options) (patches []PDFPatch, err error) {
 	patches = make([]PDFPatch, len(pdfMarkdownsList))
+	fileNames := make([]string, len(pdfMarkdownsList))
 	for i, pdfMarkdowns := range pdfMarkdownsList {
-		var patch string
-		patches[i] = PDFPatch{PDFFileName: pdfMarkdowns.PDFFileName}
+		fileNames[i] = pdfMarkdowns.PDFFileName
+	}
+	err = forEachSource(ctx, fileNames, options.jobs(), func(i int) (err error) {
+		pdfMarkdowns := pdfMarkdownsList[i]
+		textExtractor, err := chooseExtractor(pdfMarkdowns.Extractor, options)
+		if err != nil {
+			return
+		}
+		patches[i] = PDFPatch{
+			PDFFileName:      pdfMarkdowns.PDFFileName,
+			Extractor:        textExtractor.Name(),
+			ExtractorVersion: textExtractor.Version(),
+			Pages:            pdfMarkdowns.Pages,
+		}
+		patchOptions := options
+		patchOptions.Extractor = textExtractor.Name()
+		patchOptions.Pages = pdfMarkdowns.Pages
 		pdfFile := path.Join(pdfsDir, pdfMarkdowns.PDFFileName)
 		markdownFiles := make([]string, len(pdfMarkdowns.MarkdownFileNames))
 		for j, markdownFileName := range pdfMarkdowns.MarkdownFileNames {
 			markdownFiles[j] = path.Join(markdownsDir, markdownFileName)
 		}
-		patch, err = GeneratePatch(pdfFile, markdownFiles)
+		patches[i].Patch, err = GeneratePatchContext(ctx, pdfFile, markdownFiles, patchOptions)
+		return
+	})
+	return
+}
+
+// PDFMarkdownsFromSources lists the PDF and markdown file names for each of the manifest sources
+func PDFMarkdownsFromSources(sources []manifest.Source) (pdfMarkdownsList []PDFMarkdowns) {
+	pdfMarkdownsList = make([]PDFMarkdowns, len(sources))
+	for i, source := range sources {
+		pdfMarkdownsList[i] = PDFMarkdowns{
+			PDFFileName:       source.FileName,
+			MarkdownFileNames: source.PatchedFiles,
+			Extractor:         source.Extractor,
+			Pages:             source.Pages,
+		}
+	}
+	return
+}
+
+// MakeBundle generates the patches for every source in the manifest and packs them into a bundle archive
+// The extractor used for each patch is recorded in the bundled manifest.
+// Unless options.SkipAudit is set a *LeakageError is returned if any patch reveals more source text than
+// options.AuditLimits allow.
+// See manifest.PackBundle for how the archive is assembled.
+func MakeBundle(theManifest manifest.Manifest, pdfsDir string, markdownsDir string, cssDir string, outputPath string, options Options) (err error) {
+	return MakeBundleContext(context.Background(), theManifest, pdfsDir, markdownsDir, cssDir, outputPath, options)
+}
+
+// MakeBundleContext is MakeBundle stopping once ctx is done
+func MakeBundleContext(ctx context.Context, theManifest manifest.Manifest, pdfsDir string, markdownsDir string, cssDir string, outputPath string, options Options) (err error) {
+	patches, err := GeneratePatchesContext(ctx, PDFMarkdownsFromSources(theManifest.Sources), pdfsDir, markdownsDir, options)
+	if err != nil {
+		return
+	}
+	if !options.SkipAudit {
+		err = auditPatches(patches, options.auditLimits())
+		if err != nil {
+			return
+		}
+	}
+	theManifest.Sources = append([]manifest.Source(nil), theManifest.Sources...)
+	for i, patch := range patches {
+		theManifest.Sources[i].Extractor = patch.Extractor
+		theManifest.Sources[i].ExtractorVersion = patch.ExtractorVersion
+	}
+	ws, err := workspace.New("pdfpatch-", options.KeepWorkDir)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+	patchesDir, err := ws.Mkdir("patches")
+	if err != nil {
+		return
+	}
+	for _, patch := range patches {
+		err = ioutil.WriteFile(path.Join(patchesDir, patch.PatchFileName()), []byte(patch.Patch), 0644)
 		if err != nil {
 			return
 		}
-		patches[i].Patch = patch
 	}
+	err = manifest.PackBundle(theManifest, pdfsDir, patchesDir, cssDir, outputPath)
 	return
 }
 
@@ -71,8 +230,34 @@ func concatFilesToString(files []string) (output string, err error) {
 	return
 }
 
-func ApplyPatch(inputPDFFilePath string, patchFilePath string) (newText string, err error) {
-	extractedText, err := extractor.TextFromPDF(inputPDFFilePath)
+// ApplyPatch applies a patch file to the text extracted from a PDF
+// Both flat and page anchored patches are accepted.
+// The result lists every hunk of the patch and whether it could be applied.
+func ApplyPatch(inputPDFFilePath string, patchFilePath string, options Options) (result PatchResult, err error) {
+	return ApplyPatchContext(context.Background(), inputPDFFilePath, patchFilePath, options)
+}
+
+// ApplyPatchContext is ApplyPatch stopping text extraction once ctx is done
+func ApplyPatchContext(ctx context.Context, inputPDFFilePath string, patchFilePath string, options Options) (result PatchResult, err error) {
+	extracted, err := extractForPatch(ctx, inputPDFFilePath, patchFilePath, options)
+	if err != nil {
+		return
+	}
+	return extracted.apply()
+}
+
+// extractedPDF is the text of a PDF in the form needed to apply its patch
+type extractedPDF struct {
+	fileName string
+	pages    string
+	patch    string
+	text     string
+	pageText []extractor.Page
+}
+
+// extractForPatch reads a patch and extracts the text of the PDF as a whole or by page depending on the patch format
+func extractForPatch(ctx context.Context, inputPDFFilePath string, patchFilePath string, options Options) (extracted extractedPDF, err error) {
+	textExtractor, err := chooseExtractor("", options)
 	if err != nil {
 		return
 	}
@@ -81,47 +266,188 @@ func ApplyPatch(inputPDFFilePath string, patchFilePath string) (newText string,
 		return
 	}
 
-	dmp := diffmatchpatch.New()
-	patches, err := dmp.PatchFromText(string(patch))
+	extracted = extractedPDF{
+		fileName: path.Base(inputPDFFilePath),
+		pages:    options.Pages,
+		patch:    string(patch),
+	}
+	if isPagePatch(extracted.patch) {
+		extracted.pageText, err = extractPages(ctx, textExtractor, inputPDFFilePath, options.Pages)
+	} else {
+		extracted.text, err = extractText(ctx, textExtractor, inputPDFFilePath, options.Pages)
+	}
+	return
+}
+
+func (extracted extractedPDF) apply() (result PatchResult, err error) {
+	if isPagePatch(extracted.patch) {
+		result, err = ApplyPagePatchText(extracted.pageText, extracted.patch)
+	} else {
+		result, err = ApplyPatchText(extracted.text, extracted.patch)
+	}
+	result.PDFFileName = extracted.fileName
+	result.Pages = extracted.pages
+	return
+}
+
+// PatchPDF applies the patches for each of the source PDFs and binds the results into an output PDF
+// (or an EPUB if options.Format is FormatEPUB)
+// Each source PDF is verified against its manifest checksums unless options.SkipVerify is set.
+// Patches are applied with the extractor pinned by each source unless options.Extractor is set.
+// If any hunk is rejected a *RejectedHunksError is returned unless options.AllowRejectedHunks is set.
+// Up to options.Jobs sources are verified, extracted and patched at the same time, and the output follows
+// the order of sources. If more than one source fails a SourceErrors listing each is returned, along with
+// the results of the sources that were patched.
+// Intermediate files are written to a work directory that is removed on return unless options.KeepWorkDir is set.
+func PatchPDF(sources []manifest.Source, inputPDFsDir string, patchFilesDir string, cssFile string, outputPDFPath string, options Options) (results []PatchResult, err error) {
+	return PatchPDFContext(context.Background(), sources, inputPDFsDir, patchFilesDir, cssFile, outputPDFPath, options)
+}
+
+// PatchPDFContext is PatchPDF stopping once ctx is done, killing the extractor or renderer if they are running
+// The error of ctx is returned if it is done before the output is written.
+func PatchPDFContext(ctx context.Context, sources []manifest.Source, inputPDFsDir string, patchFilesDir string, cssFile string, outputPDFPath string, options Options) (results []PatchResult, err error) {
+	ws, err := workspace.New("pdfpatch-", options.KeepWorkDir)
 	if err != nil {
 		return
 	}
-	newText, _ = dmp.PatchApply(patches, extractedText)
-	return
+	defer ws.Close()
+	return patchPDF(ctx, ws, sources, inputPDFsDir, patchFilesDir, cssFile, outputPDFPath, options)
 }
 
-func PatchPDF(inputPDFs []string, inputPDFsDir string, patchFilesDir string, cssFile string, outputPDFPath string) (err error) {
-	patchedMarkdownDir, err := ioutil.TempDir("", "patched_markdowns")
-	for i, pdfFileName := range inputPDFs {
-		var patchedText string
-		pdfFilePath := path.Join(inputPDFsDir, pdfFileName)
-		patchFilePath := path.Join(patchFilesDir, pdfFileName+".patch")
-		patchedMarkdownFileName := fmt.Sprintf("%04d_%s.md", i, pdfFileName)
-		patchedMarkdownPath := path.Join(patchedMarkdownDir, patchedMarkdownFileName)
+func patchPDF(ctx context.Context, ws *workspace.Workspace, sources []manifest.Source, inputPDFsDir string, patchFilesDir string, cssFile string, outputPDFPath string, options Options) (results []PatchResult, err error) {
+	err = checkFormat(options)
+	if err != nil {
+		return
+	}
+	options = options.synchronized()
+	fileNames := make([]string, len(sources))
+	for i, source := range sources {
+		fileNames[i] = source.FileName
+	}
+	sourceOptions := make([]Options, len(sources))
+	err = forEachSource(ctx, fileNames, options.jobs(), func(i int) (err error) {
+		source := sources[i]
+		if !options.SkipVerify {
+			err = source.Verify(path.Join(inputPDFsDir, source.FileName))
+			if err != nil {
+				return
+			}
+		}
+		textExtractor, err := chooseExtractor(source.Extractor, options)
+		if err != nil {
+			return
+		}
+		err = checkExtractor(source, textExtractor, options)
+		if err != nil {
+			return
+		}
+		sourceOptions[i] = options
+		sourceOptions[i].Extractor = textExtractor.Name()
+		sourceOptions[i].Pages = source.Pages
+		return
+	})
+	if err != nil {
+		return
+	}
 
-		patchedText, err = ApplyPatch(pdfFilePath, patchFilePath)
+	options.report(ProgressEvent{Stage: StageExtracting})
+	extracted := make([]extractedPDF, len(sources))
+	err = forEachSource(ctx, fileNames, options.jobs(), func(i int) (err error) {
+		source := sources[i]
+		pdfFilePath := path.Join(inputPDFsDir, source.FileName)
+		patchFilePath := path.Join(patchFilesDir, source.PatchFileName())
+		extracted[i], err = extractForPatch(ctx, pdfFilePath, patchFilePath, sourceOptions[i])
 		if err != nil {
 			return
 		}
-		err = ioutil.WriteFile(patchedMarkdownPath, []byte(patchedText), 0644)
+		options.report(ProgressEvent{Stage: StageExtracting, FileName: source.FileName})
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	options.report(ProgressEvent{Stage: StagePatching})
+	patchedMarkdownDir, err := ws.Mkdir("patched_markdowns")
+	if err != nil {
+		return
+	}
+	results = make([]PatchResult, len(sources))
+	patched := make([]bool, len(sources))
+	err = forEachSource(ctx, fileNames, options.jobs(), func(i int) (err error) {
+		source := sources[i]
+		patchedMarkdownFileName := fmt.Sprintf("%04d_%s.md", i, source.FileName)
+		patchedMarkdownPath := path.Join(patchedMarkdownDir, patchedMarkdownFileName)
+
+		results[i], err = extracted[i].apply()
 		if err != nil {
 			return
 		}
+		patched[i] = true
+		options.report(ProgressEvent{
+			Stage:        StagePatching,
+			FileName:     source.FileName,
+			Hunks:        len(results[i].Hunks),
+			HunksApplied: results[i].Applied(),
+		})
+		return ioutil.WriteFile(patchedMarkdownPath, []byte(results[i].Text), 0644)
+	})
+	if err != nil {
+		// only the results of the sources that were patched are returned
+		kept := results[:0]
+		for i, result := range results {
+			if patched[i] {
+				kept = append(kept, result)
+			}
+		}
+		results = kept
+		return
+	}
+	if rejectedErr := checkRejectedHunks(results); rejectedErr != nil {
+		if !options.AllowRejectedHunks {
+			err = rejectedErr
+			return
+		}
+		log.Println("WARNING:", rejectedErr)
 	}
 	log.Println("patched mardowns written:", patchedMarkdownDir)
-	err = pdfbinder.BindPdf(patchedMarkdownDir, cssFile, outputPDFPath)
+
+	options.report(ProgressEvent{Stage: StageRendering})
+	err = bind(ctx, ws, patchedMarkdownDir, cssFile, outputPDFPath, options)
 	return
 }
 
+func checkRejectedHunks(results []PatchResult) error {
+	for _, result := range results {
+		if len(result.Rejected()) > 0 {
+			return &RejectedHunksError{Results: results}
+		}
+	}
+	return nil
+}
+
 // PatchBundle extracts a bundle file and uses its contents along with source PDFs to genderate a patched PDF
-func PatchBundle(bundlePath string, inputPDFsDir string, styleSheet string, outputPDFPath string) (err error) {
+// The PDF is rendered with the renderer named by the style unless options.Renderer is set.
+// It is an error to ask for an output format the style does not list in its formats.
+// With options.Fetcher the source PDFs missing from inputPDFsDir are downloaded into it first.
+// The bundle is unpacked to the work directory of PatchPDF and removed with it.
+func PatchBundle(bundlePath string, inputPDFsDir string, styleSheet string, outputPDFPath string, options Options) (results []PatchResult, err error) {
+	return PatchBundleContext(context.Background(), bundlePath, inputPDFsDir, styleSheet, outputPDFPath, options)
+}
+
+// PatchBundleContext is PatchBundle stopping once ctx is done (see PatchPDFContext)
+func PatchBundleContext(ctx context.Context, bundlePath string, inputPDFsDir string, styleSheet string, outputPDFPath string, options Options) (results []PatchResult, err error) {
 	var (
 		bundle      manifest.Bundle
 		cssFilePath string
-		pdfFiles    []string
 	)
 
-	bundle, err = manifest.UnpackBundle(bundlePath)
+	ws, err := workspace.New("pdfpatch-", options.KeepWorkDir)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+	bundle, err = manifest.UnpackBundleInto(bundlePath, ws.Path("bundle"))
 	if err != nil {
 		return
 	}
@@ -129,8 +455,28 @@ func PatchBundle(bundlePath string, inputPDFsDir string, styleSheet string, outp
 	if err != nil {
 		return
 	}
-	pdfFiles = bundle.Manifest.SourceFileNames()
+	style, _ := bundle.Manifest.FindStyle(styleSheet)
+	format := options.Format
+	if format == "" {
+		format = FormatPDF
+	}
+	if !style.SupportsFormat(format) {
+		err = fmt.Errorf("style %q is not designed for %s output (only %s)", style.Name, format, strings.Join(style.Formats, ", "))
+		return
+	}
+	if options.Renderer == "" {
+		options.Renderer = style.Renderer
+	}
+	if options.Book.IsZero() {
+		options.Book = bundle.Manifest.Book
+	}
+	if options.Fetcher != nil {
+		_, err = FetchSourcesContext(ctx, bundle.Manifest.Sources, inputPDFsDir, options)
+		if err != nil {
+			return
+		}
+	}
 
-	err = PatchPDF(pdfFiles, inputPDFsDir, bundle.PatchesDir, cssFilePath, outputPDFPath)
+	results, err = patchPDF(ctx, ws, bundle.Manifest.Sources, inputPDFsDir, bundle.PatchesDir, cssFilePath, outputPDFPath, options)
 	return
 }
@@ -1,11 +1,19 @@
 package pdfpatch_test
 
 import (
+	"archive/zip"
 	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
 	"path"
+	"path/filepath"
 	"time"
 
 	"github.com/ledongthuc/pdf"
+	"github.com/motevets/pdfpatch/pkg/extractor"
+	"github.com/motevets/pdfpatch/pkg/manifest"
 	"github.com/motevets/pdfpatch/pkg/pdfpatch"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -48,7 +56,7 @@ var _ = Describe("pdfpatch", func() {
 		var markdownPaths = []string{path.Join(fixturesPath, "chapter_1.md"), path.Join(fixturesPath, "chapter_2.md")}
 
 		It("generates a patch from the PDF files", func() {
-			patch, err := pdfpatch.GeneratePatch(pdfPath, markdownPaths)
+			patch, err := pdfpatch.GeneratePatch(pdfPath, markdownPaths, pdfpatch.Options{})
 			Expect(err).ToNot(HaveOccurred())
 			Expect(patch).To(Equal(computedPatch))
 		})
@@ -76,45 +84,226 @@ var _ = Describe("pdfpatch", func() {
 
 		var pdfPatches = []pdfpatch.PDFPatch{
 			{
-				PDFFileName: "title_pages.pdf",
-				Patch:       "@@ -1,8 +1,21 @@\n+%0APAGE 1%0A%0ANEW \n TITLE PA\n@@ -20,10 +20,18 @@\n PAGE\n- \n+%0A%0APAGE\n  \n+2%0A%0A\n Dedi\n@@ -52,9 +52,7 @@\n llow\n- men\n+s\n .\n+%0A\n",
+				PDFFileName:      "title_pages.pdf",
+				Extractor:        "pdftotext",
+				ExtractorVersion: extractor.Pdftotext{}.Version(),
+				Patch:            "@@ -1,8 +1,21 @@\n+%0APAGE 1%0A%0ANEW \n TITLE PA\n@@ -20,10 +20,18 @@\n PAGE\n- \n+%0A%0APAGE\n  \n+2%0A%0A\n Dedi\n@@ -52,9 +52,7 @@\n llow\n- men\n+s\n .\n+%0A\n",
 			},
 			{
-				PDFFileName: "chapter_1.pdf",
-				Patch:       "@@ -1,8 +1,17 @@\n+%0APAGE 3%0A%0A\n This is \n@@ -20,8 +20,30 @@\n apter 1.\n+%0A%0AIt's pretty great.%0A%0A\n",
+				PDFFileName:      "chapter_1.pdf",
+				Extractor:        "pdftotext",
+				ExtractorVersion: extractor.Pdftotext{}.Version(),
+				Patch:            "@@ -1,8 +1,17 @@\n+%0APAGE 3%0A%0A\n This is \n@@ -20,8 +20,30 @@\n apter 1.\n+%0A%0AIt's pretty great.%0A%0A\n",
 			},
 		}
 
 		It("generates a patch from the PDF files", func() {
-			patches, err := pdfpatch.GeneratePatches(pdfMarkdowns, pdfsDir, markdownsDir)
+			patches, err := pdfpatch.GeneratePatches(pdfMarkdowns, pdfsDir, markdownsDir, pdfpatch.Options{})
 			Expect(err).ToNot(HaveOccurred())
 			Expect(len(patches)).To(Equal(2))
 			Expect(patches).To(Equal(pdfPatches))
 		})
 	})
 
+	Describe("MakeBundle", func() {
+		const fixturesPath = "../../test/fixtures/multiple_patches"
+		var theManifest = manifest.Manifest{
+			Sources: []manifest.Source{
+				{FileName: "title_pages.pdf", PatchedFiles: []string{"title.md", "dedication.md"}},
+				{FileName: "chapter_1.pdf", PatchedFiles: []string{"chapter_1.md"}},
+			},
+			Styles: []manifest.Style{{Name: "Traditional", StyleSheet: "book.css"}},
+		}
+
+		It("makes a bundle with the generated patches", func() {
+			outputDir, err := ioutil.TempDir("", "make_bundle_test")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(outputDir)
+			bundlePath := path.Join(outputDir, "bundle.zip")
+
+			err = pdfpatch.MakeBundle(theManifest, path.Join(fixturesPath, "pdfs"), path.Join(fixturesPath, "markdowns"), "../../test/fixtures/patch_bundle/css", bundlePath, pdfpatch.Options{})
+			Expect(err).NotTo(HaveOccurred())
+
+			bundle, err := manifest.UnpackBundle(bundlePath)
+			Expect(err).NotTo(HaveOccurred())
+			defer bundle.Close()
+			Expect(bundle.Manifest.Sources[1].Md5Sum).To(Equal("a9933c03362f2b40fa4c28cb86bff14d"))
+			Expect(bundle.Manifest.Sources[1].Extractor).To(Equal("pdftotext"))
+			patch, err := ioutil.ReadFile(path.Join(bundle.PatchesDir, "chapter_1.pdf.patch"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(patch)).To(Equal("@@ -1,8 +1,17 @@\n+%0APAGE 3%0A%0A\n This is \n@@ -20,8 +20,30 @@\n apter 1.\n+%0A%0AIt's pretty great.%0A%0A\n"))
+		})
+	})
+
 	Describe("ApplyPatch", func() {
 		const fixturesPath = "../../test/fixtures/one_pdf_two_markdowns"
 		var pdfPath = path.Join(fixturesPath, "original.pdf")
 		var patchPath = path.Join(fixturesPath, "original.pdf.patch")
 		It("applies the path to the PDF to make the desired output", func() {
-			output, err := pdfpatch.ApplyPatch(pdfPath, patchPath)
+			result, err := pdfpatch.ApplyPatch(pdfPath, patchPath, pdfpatch.Options{})
 			Expect(err).ToNot(HaveOccurred())
-			Expect(output).To(Equal(finalOutput))
+			Expect(result.Text).To(Equal(finalOutput))
+			Expect(result.PDFFileName).To(Equal("original.pdf"))
+			Expect(result.Rejected()).To(BeEmpty())
+		})
+	})
+
+	Describe("ApplyPatch with the gopdf extractor", func() {
+		const fixturesPath = "../../test/fixtures/one_pdf_two_markdowns"
+		var pdfPath = path.Join(fixturesPath, "original.pdf")
+		var markdownPaths = []string{path.Join(fixturesPath, "chapter_1.md"), path.Join(fixturesPath, "chapter_2.md")}
+		var options = pdfpatch.Options{Extractor: "gopdf"}
+
+		It("round trips a patch generated with the same extractor", func() {
+			patch, err := pdfpatch.GeneratePatch(pdfPath, markdownPaths, options)
+			Expect(err).NotTo(HaveOccurred())
+			patchFilePath := writePatchFile(patch)
+			defer os.Remove(patchFilePath)
+
+			result, err := pdfpatch.ApplyPatch(pdfPath, patchFilePath, options)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Rejected()).To(BeEmpty())
+			Expect(result.Text).To(Equal(finalOutput))
+		})
+
+		It("round trips a page anchored patch", func() {
+			pageOptions := options
+			pageOptions.PageAnchored = true
+			patch, err := pdfpatch.GeneratePatch(pdfPath, markdownPaths, pageOptions)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(patch).To(HavePrefix("#pdfpatch pages\n"))
+			patchFilePath := writePatchFile(patch)
+			defer os.Remove(patchFilePath)
+
+			result, err := pdfpatch.ApplyPatch(pdfPath, patchFilePath, options)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Rejected()).To(BeEmpty())
+			Expect(result.Text).To(Equal(finalOutput))
+		})
+	})
+
+	Describe("ReversePatch with the gopdf extractor", func() {
+		const fixturesPath = "../../test/fixtures/one_pdf_two_markdowns"
+		var pdfPath = path.Join(fixturesPath, "original.pdf")
+		var markdownPaths = []string{path.Join(fixturesPath, "chapter_1.md"), path.Join(fixturesPath, "chapter_2.md")}
+
+		// expectLossless checks that reversing the patch made with options turns its output back into the extracted text
+		expectLossless := func(options pdfpatch.Options) {
+			patch, err := pdfpatch.GeneratePatch(pdfPath, markdownPaths, options)
+			Expect(err).NotTo(HaveOccurred())
+			patchFilePath := writePatchFile(patch)
+			defer os.Remove(patchFilePath)
+
+			patched, err := pdfpatch.ApplyPatch(pdfPath, patchFilePath, options)
+			Expect(err).NotTo(HaveOccurred())
+			reversed, err := pdfpatch.ReversePatch(pdfPath, patchFilePath, options)
+			Expect(err).NotTo(HaveOccurred())
+			result, err := pdfpatch.ApplyPatchText(patched.Text, reversed)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Rejected()).To(BeEmpty())
+
+			text, err := extractor.GoPDF{}.TextFromPDF(pdfPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Text).To(Equal(text))
+		}
+
+		It("regenerates the extracted text from the output of a patch", func() {
+			expectLossless(pdfpatch.Options{Extractor: "gopdf"})
+		})
+
+		It("regenerates the extracted text from the output of a page anchored patch", func() {
+			expectLossless(pdfpatch.Options{Extractor: "gopdf", PageAnchored: true})
+		})
+
+		When("a page anchored patch is reversed without its PDF", func() {
+			It("returns an error", func() {
+				patchFilePath := writePatchFile("#pdfpatch pages\n")
+				defer os.Remove(patchFilePath)
+
+				_, err := pdfpatch.ReversePatch("", patchFilePath, pdfpatch.Options{Extractor: "gopdf"})
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("GeneratePatches with page ranges", func() {
+		const fixturesPath = "../../test/fixtures/one_pdf_two_markdowns"
+		var pdfMarkdowns = []pdfpatch.PDFMarkdowns{
+			{PDFFileName: "original.pdf", MarkdownFileNames: []string{"chapter_1.md"}, Pages: "1"},
+			{PDFFileName: "original.pdf", MarkdownFileNames: []string{"chapter_2.md"}, Pages: "2-"},
+		}
+
+		It("patches only the pages of each source", func() {
+			patches, err := pdfpatch.GeneratePatches(pdfMarkdowns, fixturesPath, fixturesPath, pdfpatch.Options{Extractor: "gopdf"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(patches[0].PatchFileName()).To(Equal("original.pdf.pages-1.patch"))
+			Expect(patches[1].PatchFileName()).To(Equal("original.pdf.pages-2-.patch"))
+
+			patchesDir, err := ioutil.TempDir("", "page_range_patches")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(patchesDir)
+			for i, patch := range patches {
+				patchPath := path.Join(patchesDir, patch.PatchFileName())
+				Expect(ioutil.WriteFile(patchPath, []byte(patch.Patch), 0644)).To(Succeed())
+				markdown, err := ioutil.ReadFile(path.Join(fixturesPath, pdfMarkdowns[i].MarkdownFileNames[0]))
+				Expect(err).NotTo(HaveOccurred())
+
+				result, err := pdfpatch.ApplyPatch(path.Join(fixturesPath, "original.pdf"), patchPath, pdfpatch.Options{Extractor: "gopdf", Pages: patch.Pages})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Rejected()).To(BeEmpty())
+				Expect(result.Text).To(Equal("\n" + string(markdown) + "\n"))
+			}
+		})
+
+		When("no pages of the PDF are in the range", func() {
+			It("returns an error", func() {
+				_, err := pdfpatch.GeneratePatches([]pdfpatch.PDFMarkdowns{{PDFFileName: "original.pdf", MarkdownFileNames: []string{"chapter_1.md"}, Pages: "5-"}}, fixturesPath, fixturesPath, pdfpatch.Options{Extractor: "gopdf"})
+				Expect(err).To(MatchError(`original.pdf has no pages in "5-"`))
+			})
+		})
+
+		It("returns the patches in the order of the sources when they are generated at the same time", func() {
+			var manyPDFMarkdowns []pdfpatch.PDFMarkdowns
+			for i := 0; i < 8; i++ {
+				manyPDFMarkdowns = append(manyPDFMarkdowns, pdfMarkdowns[i%2])
+			}
+			patches, err := pdfpatch.GeneratePatches(manyPDFMarkdowns, fixturesPath, fixturesPath, pdfpatch.Options{Extractor: "gopdf", Jobs: 4})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(patches).To(HaveLen(8))
+			for i, patch := range patches {
+				Expect(patch.Pages).To(Equal(manyPDFMarkdowns[i].Pages))
+			}
+		})
+
+		When("more than one source fails", func() {
+			It("returns the errors of every failing source in order", func() {
+				_, err := pdfpatch.GeneratePatches([]pdfpatch.PDFMarkdowns{
+					{PDFFileName: "original.pdf", MarkdownFileNames: []string{"chapter_1.md"}, Pages: "5-"},
+					pdfMarkdowns[0],
+					{PDFFileName: "missing.pdf", MarkdownFileNames: []string{"chapter_2.md"}},
+				}, fixturesPath, fixturesPath, pdfpatch.Options{Extractor: "gopdf", Jobs: 2})
+				var sourceErrs pdfpatch.SourceErrors
+				Expect(errors.As(err, &sourceErrs)).To(BeTrue())
+				Expect(sourceErrs).To(HaveLen(2))
+				Expect(sourceErrs[0].FileName).To(Equal("original.pdf"))
+				Expect(sourceErrs[0].Err).To(MatchError(`original.pdf has no pages in "5-"`))
+				Expect(sourceErrs[1].FileName).To(Equal("missing.pdf"))
+				Expect(err.Error()).To(HavePrefix("2 sources failed:\n  original.pdf: "))
+			})
 		})
 	})
 
 	Describe("PatchPDF", func() {
 		var outputPDFFile = "../../test/output/" + time.Now().Format(time.RFC3339) + "-patch-pdf-out.pdf"
 		const fixturesPath = "../../test/fixtures/pdfs_patches_and_csses"
-		var pdfFiles = []string{"title_pages.pdf", "chapter_1.pdf"}
+		var sources = []manifest.Source{{FileName: "title_pages.pdf"}, {FileName: "chapter_1.pdf"}}
 		var patchesDir = path.Join(fixturesPath, "patches")
 		var pdfsDir = path.Join(fixturesPath, "pdfs")
 		var cssFile = path.Join(fixturesPath, "css/book.css")
 
 		It("uses the patch bundle and input PDFs to make a patched PDF", func() {
 			var err error
-			err = pdfpatch.PatchPDF(pdfFiles, pdfsDir, patchesDir, cssFile, outputPDFFile)
+			_, err = pdfpatch.PatchPDF(sources, pdfsDir, patchesDir, cssFile, outputPDFFile, pdfpatch.Options{})
 			Expect(err).NotTo(HaveOccurred())
 			numPages, text, err := statPDF(outputPDFFile)
 			Expect(err).NotTo(HaveOccurred())
@@ -123,6 +312,125 @@ var _ = Describe("pdfpatch", func() {
 		})
 	})
 
+	Describe("PatchPDF with the EPUB format", func() {
+		const fixturesPath = "../../test/fixtures/one_pdf_two_markdowns"
+		var (
+			patchesDir string
+			outputPath string
+			options    pdfpatch.Options
+			events     []pdfpatch.ProgressEvent
+		)
+
+		BeforeEach(func() {
+			var err error
+			patchesDir, err = ioutil.TempDir("", "epub_patches")
+			Expect(err).NotTo(HaveOccurred())
+			outputPath = path.Join(patchesDir, "output.epub")
+			patch, err := pdfpatch.GeneratePatch(path.Join(fixturesPath, "original.pdf"), []string{path.Join(fixturesPath, "chapter_1.md"), path.Join(fixturesPath, "chapter_2.md")}, pdfpatch.Options{Extractor: "gopdf"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.WriteFile(path.Join(patchesDir, "original.pdf.patch"), []byte(patch), 0644)).To(Succeed())
+			events = nil
+			options = pdfpatch.Options{
+				Extractor: "gopdf",
+				Format:    pdfpatch.FormatEPUB,
+				Progress:  func(event pdfpatch.ProgressEvent) { events = append(events, event) },
+			}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(patchesDir)
+		})
+
+		It("binds the patched text into an EPUB without a PDF renderer", func() {
+			_, err := pdfpatch.PatchPDF([]manifest.Source{{FileName: "original.pdf"}}, fixturesPath, patchesDir, "../../test/fixtures/patch_bundle/css/book.css", outputPath, options)
+			Expect(err).NotTo(HaveOccurred())
+			reader, err := zip.OpenReader(outputPath)
+			Expect(err).NotTo(HaveOccurred())
+			defer reader.Close()
+			Expect(reader.File[0].Name).To(Equal("mimetype"))
+			var chapter string
+			for _, file := range reader.File {
+				if file.Name == "EPUB/chapter-0001.xhtml" {
+					contents, err := file.Open()
+					Expect(err).NotTo(HaveOccurred())
+					data, err := ioutil.ReadAll(contents)
+					Expect(err).NotTo(HaveOccurred())
+					chapter = string(data)
+				}
+			}
+			Expect(chapter).To(ContainSubstring("<p>Goodbye from chapter 1.</p>"))
+			Expect(chapter).To(ContainSubstring("<p>Auf wiedersehen von Kapitel 2.</p>"))
+		})
+
+		It("reports the progress of each stage and source PDF", func() {
+			_, err := pdfpatch.PatchPDF([]manifest.Source{{FileName: "original.pdf"}}, fixturesPath, patchesDir, "../../test/fixtures/patch_bundle/css/book.css", outputPath, options)
+			Expect(err).NotTo(HaveOccurred())
+			var descriptions []string
+			for _, event := range events {
+				descriptions = append(descriptions, event.String())
+			}
+			Expect(descriptions).To(Equal([]string{"extracting", "extracted original.pdf", "patching", "applied 3/3 hunks to original.pdf", "rendering"}))
+		})
+
+		Describe("the work directory", func() {
+			var tempDir, previousTempDir string
+
+			BeforeEach(func() {
+				var err error
+				tempDir, err = ioutil.TempDir("", "work_dir_test")
+				Expect(err).NotTo(HaveOccurred())
+				previousTempDir = os.Getenv("TMPDIR")
+				os.Setenv("TMPDIR", tempDir)
+			})
+
+			AfterEach(func() {
+				os.Setenv("TMPDIR", previousTempDir)
+				os.RemoveAll(tempDir)
+			})
+
+			It("is removed once the output is written", func() {
+				_, err := pdfpatch.PatchPDF([]manifest.Source{{FileName: "original.pdf"}}, fixturesPath, patchesDir, "../../test/fixtures/patch_bundle/css/book.css", outputPath, options)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ioutil.ReadDir(tempDir)).To(BeEmpty())
+			})
+
+			It("is removed when patching fails", func() {
+				_, err := pdfpatch.PatchPDF([]manifest.Source{{FileName: "missing.pdf"}}, fixturesPath, patchesDir, "../../test/fixtures/patch_bundle/css/book.css", outputPath, options)
+				Expect(err).To(HaveOccurred())
+				Expect(ioutil.ReadDir(tempDir)).To(BeEmpty())
+			})
+
+			It("is kept with the patched markdowns if KeepWorkDir is set", func() {
+				options.KeepWorkDir = true
+				_, err := pdfpatch.PatchPDF([]manifest.Source{{FileName: "original.pdf"}}, fixturesPath, patchesDir, "../../test/fixtures/patch_bundle/css/book.css", outputPath, options)
+				Expect(err).NotTo(HaveOccurred())
+				workDirs, err := filepath.Glob(path.Join(tempDir, "pdfpatch-*"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(workDirs).To(HaveLen(1))
+				Expect(path.Join(workDirs[0], "patched_markdowns", "0000_original.pdf.md")).To(BeARegularFile())
+			})
+		})
+
+		When("the context is cancelled", func() {
+			It("stops with the error of the context", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				_, err := pdfpatch.PatchPDFContext(ctx, []manifest.Source{{FileName: "original.pdf"}}, fixturesPath, patchesDir, "../../test/fixtures/patch_bundle/css/book.css", outputPath, options)
+				Expect(err).To(MatchError(context.Canceled))
+				Expect(outputPath).NotTo(BeAnExistingFile())
+			})
+		})
+
+		When("the format is unknown", func() {
+			It("returns an error before extracting text", func() {
+				options.Format = "docx"
+				_, err := pdfpatch.PatchPDF([]manifest.Source{{FileName: "original.pdf"}}, fixturesPath, patchesDir, "", outputPath, options)
+				Expect(err).To(MatchError(`unknown format "docx" (must be one of [pdf epub])`))
+				Expect(events).To(BeEmpty())
+			})
+		})
+	})
+
 	Describe("PatchBundle", func() {
 		var outputPDFFile = "../../test/output/" + time.Now().Format(time.RFC3339) + "-patch-bundle-out.pdf"
 		const pdfsDir = "../../test/fixtures/patch_bundle_pdfs"
@@ -131,16 +439,67 @@ var _ = Describe("pdfpatch", func() {
 
 		It("uses the patch bundle and input PDFs to make a patched PDF", func() {
 			var err error
-			err = pdfpatch.PatchBundle(bundlePath, pdfsDir, styleSheet, outputPDFFile)
+			_, err = pdfpatch.PatchBundle(bundlePath, pdfsDir, styleSheet, outputPDFFile, pdfpatch.Options{})
 			Expect(err).NotTo(HaveOccurred())
 			numPages, text, err := statPDF(outputPDFFile)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(numPages).To(Equal(3))
 			Expect(text).To(Equal("NEW TITLE PAGE1Dedicated to myfellows.2This is chapter 1.It's pretty great.3"))
 		})
+
+		When("a source was patched with a different extractor than the one chosen", func() {
+			var pinnedSources = []manifest.Source{{FileName: "title_pages.pdf", Extractor: "gopdf"}}
+
+			It("returns an extractor mismatch error", func() {
+				_, err := pdfpatch.PatchPDF(pinnedSources, pdfsDir, "", "", outputPDFFile, pdfpatch.Options{Extractor: "pdftotext"})
+				var mismatchErr *pdfpatch.ExtractorMismatchError
+				Expect(errors.As(err, &mismatchErr)).To(BeTrue())
+				Expect(err).To(MatchError("title_pages.pdf was patched with the gopdf extractor but the pdftotext extractor was chosen"))
+			})
+		})
+
+		When("an input PDF does not match the checksum in the manifest", func() {
+			It("returns a checksum mismatch error and no results", func() {
+				results, err := pdfpatch.PatchBundle(bundlePath, "../../test/fixtures/pdfs_swapped", styleSheet, outputPDFFile, pdfpatch.Options{})
+				var mismatchErr *manifest.ChecksumMismatchError
+				Expect(errors.As(err, &mismatchErr)).To(BeTrue())
+				Expect(mismatchErr.FileName).To(Equal("title_pages.pdf"))
+				Expect(results).To(BeEmpty())
+			})
+		})
+
+		When("the style is not designed for the output format", func() {
+			const fixturesPath = "../../test/fixtures/pdfs_patches_and_csses"
+
+			It("returns an error", func() {
+				bundleDir, err := ioutil.TempDir("", "pdfpatch-test")
+				Expect(err).NotTo(HaveOccurred())
+				defer os.RemoveAll(bundleDir)
+				printOnlyBundlePath := path.Join(bundleDir, "bundle.zip")
+				theManifest := manifest.Manifest{
+					Sources: []manifest.Source{{FileName: "chapter_1.pdf", PatchedFiles: []string{"chapter_1.md"}}},
+					Styles:  []manifest.Style{{Name: "Print", StyleSheet: "book.css", Formats: []string{"pdf"}}},
+				}
+				err = manifest.PackBundle(theManifest, path.Join(fixturesPath, "pdfs"), path.Join(fixturesPath, "patches"), path.Join(fixturesPath, "css"), printOnlyBundlePath)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = pdfpatch.PatchBundle(printOnlyBundlePath, path.Join(fixturesPath, "pdfs"), "book.css", outputPDFFile, pdfpatch.Options{Format: pdfpatch.FormatEPUB})
+				Expect(err).To(MatchError(`style "Print" is not designed for epub output (only pdf)`))
+			})
+		})
 	})
 })
 
+// writePatchFile writes the patch to a temporary file and returns its path
+func writePatchFile(patch string) string {
+	patchFile, err := ioutil.TempFile("", "gopdf-*.patch")
+	Expect(err).NotTo(HaveOccurred())
+	_, err = patchFile.WriteString(patch)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(patchFile.Close()).To(Succeed())
+	return patchFile.Name()
+}
+
 func statPDF(path string) (numPages int, text string, err error) {
 	f, r, err := pdf.Open(path)
 	defer f.Close()
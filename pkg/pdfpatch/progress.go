@@ -0,0 +1,47 @@
+package pdfpatch
+
+import "fmt"
+
+// Stage is a step in patching PDFs
+type Stage string
+
+const (
+	// StageExtracting is extracting the text of the source PDFs
+	StageExtracting Stage = "extracting"
+	// StagePatching is applying the patches to the extracted text
+	StagePatching Stage = "patching"
+	// StageRendering is binding the patched text into the output document
+	StageRendering Stage = "rendering"
+)
+
+// ProgressEvent reports progress while patching PDFs
+// An event is sent as each stage starts, without a FileName or Page, followed by an event
+// for each source PDF extracted and patched (with its FileName) or each page rendered (with its Page).
+// Hunks and HunksApplied are set for source PDFs that have been patched.
+type ProgressEvent struct {
+	Stage        Stage
+	FileName     string
+	Hunks        int
+	HunksApplied int
+	Page         int
+}
+
+// String describes the event like "applied 14/15 hunks to chapter_1.pdf"
+func (event ProgressEvent) String() string {
+	switch {
+	case event.Stage == StageExtracting && event.FileName != "":
+		return fmt.Sprintf("extracted %s", event.FileName)
+	case event.Stage == StagePatching && event.FileName != "":
+		return fmt.Sprintf("applied %d/%d hunks to %s", event.HunksApplied, event.Hunks, event.FileName)
+	case event.Stage == StageRendering && event.Page > 0:
+		return fmt.Sprintf("rendering page %d", event.Page)
+	}
+	return string(event.Stage)
+}
+
+// report sends an event to options.Progress if it is set
+func (options Options) report(event ProgressEvent) {
+	if options.Progress != nil {
+		options.Progress(event)
+	}
+}
@@ -0,0 +1,30 @@
+package pdfpatch_test
+
+import (
+	"github.com/motevets/pdfpatch/pkg/pdfpatch"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ProgressEvent", func() {
+	Describe("String", func() {
+		It("describes the start of a stage", func() {
+			Expect(pdfpatch.ProgressEvent{Stage: pdfpatch.StageExtracting}.String()).To(Equal("extracting"))
+		})
+
+		It("describes an extracted source PDF", func() {
+			event := pdfpatch.ProgressEvent{Stage: pdfpatch.StageExtracting, FileName: "chapter_1.pdf"}
+			Expect(event.String()).To(Equal("extracted chapter_1.pdf"))
+		})
+
+		It("describes the hunks applied to a source PDF", func() {
+			event := pdfpatch.ProgressEvent{Stage: pdfpatch.StagePatching, FileName: "chapter_1.pdf", Hunks: 15, HunksApplied: 14}
+			Expect(event.String()).To(Equal("applied 14/15 hunks to chapter_1.pdf"))
+		})
+
+		It("describes a rendered page", func() {
+			event := pdfpatch.ProgressEvent{Stage: pdfpatch.StageRendering, Page: 3}
+			Expect(event.String()).To(Equal("rendering page 3"))
+		})
+	})
+})
@@ -0,0 +1,153 @@
+package pdfpatch
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+const (
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorCyan  = "\x1b[36m"
+	colorReset = "\x1b[0m"
+)
+
+// WriteDiff writes the hunks of each patch diff to w with deleted words as [-words-] and inserted words as {+words+},
+// coloured for a terminal if color is set
+// Hunks of the patches that were rejected are listed after the hunks of their source.
+func WriteDiff(w io.Writer, patchDiffs []PatchDiff, color bool) (err error) {
+	paint := func(code string, text string) string {
+		if !color {
+			return text
+		}
+		return code + text + colorReset
+	}
+	for _, patchDiff := range patchDiffs {
+		result := patchDiff.Result
+		_, err = fmt.Fprintf(w, "%s\n", paint(colorCyan, fmt.Sprintf("== %s: %d/%d hunks applied", result.Name(), result.Applied(), len(result.Hunks))))
+		if err != nil {
+			return
+		}
+		for _, hunk := range patchDiff.Hunks {
+			_, err = fmt.Fprintf(w, "%s\n", paint(colorCyan, fmt.Sprintf("@@ hunk %d @@", hunk.Number)))
+			if err != nil {
+				return
+			}
+			for _, diff := range hunk.Diffs {
+				switch diff.Type {
+				case diffmatchpatch.DiffDelete:
+					_, err = io.WriteString(w, paint(colorRed, "[-"+diff.Text+"-]"))
+				case diffmatchpatch.DiffInsert:
+					_, err = io.WriteString(w, paint(colorGreen, "{+"+diff.Text+"+}"))
+				default:
+					_, err = io.WriteString(w, diff.Text)
+				}
+				if err != nil {
+					return
+				}
+			}
+			_, err = io.WriteString(w, "\n")
+			if err != nil {
+				return
+			}
+		}
+		for _, hunk := range result.Rejected() {
+			_, err = fmt.Fprintf(w, "%s\n", paint(colorRed, "patch "+hunk.String()))
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// reportSource is a source PDF in the HTML report
+type reportSource struct {
+	Name     string
+	Applied  int
+	Total    int
+	Rejected []string
+	Hunks    []reportHunk
+}
+
+// reportHunk is a row of the HTML report with the extracted text of a hunk beside its patched text
+type reportHunk struct {
+	Number  int
+	Text    []reportSpan
+	Patched []reportSpan
+}
+
+// reportSpan is a run of text that is either unchanged or deleted (in Text) or inserted (in Patched)
+type reportSpan struct {
+	Text    string
+	Changed bool
+}
+
+// WriteHTMLReport writes an HTML page to w showing the extracted text of each hunk of each patch diff
+// beside its patched text
+func WriteHTMLReport(w io.Writer, patchDiffs []PatchDiff) error {
+	sources := make([]reportSource, len(patchDiffs))
+	for i, patchDiff := range patchDiffs {
+		result := patchDiff.Result
+		sources[i] = reportSource{Name: result.Name(), Applied: result.Applied(), Total: len(result.Hunks)}
+		for _, hunk := range result.Rejected() {
+			sources[i].Rejected = append(sources[i].Rejected, "patch "+hunk.String())
+		}
+		for _, hunk := range patchDiff.Hunks {
+			row := reportHunk{Number: hunk.Number}
+			for _, diff := range hunk.Diffs {
+				span := reportSpan{Text: diff.Text, Changed: diff.Type != diffmatchpatch.DiffEqual}
+				if diff.Type != diffmatchpatch.DiffInsert {
+					row.Text = append(row.Text, span)
+				}
+				if diff.Type != diffmatchpatch.DiffDelete {
+					row.Patched = append(row.Patched, span)
+				}
+			}
+			sources[i].Hunks = append(sources[i].Hunks, row)
+		}
+	}
+	return reportTemplate.Execute(w, sources)
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>pdfpatch report</title>
+  <style>
+    body { font-family: sans-serif; margin: 2em; }
+    table { border-collapse: collapse; width: 100%; table-layout: fixed; }
+    th, td { border: 1px solid #ccc; padding: 0.4em; vertical-align: top; text-align: left; }
+    th.hunk, td.hunk { width: 4em; text-align: right; }
+    td.text { font-family: monospace; white-space: pre-wrap; word-wrap: break-word; }
+    del { background: #fdd; color: #900; }
+    ins { background: #dfd; color: #060; text-decoration: none; }
+    .rejected { color: #900; }
+  </style>
+</head>
+<body>
+<h1>pdfpatch report</h1>
+{{range $source, $_ := .}}<section id="source-{{$source}}">
+  <h2>{{.Name}}</h2>
+  <p>{{.Applied}}/{{.Total}} hunks applied</p>
+  {{if .Rejected}}<ul class="rejected">
+    {{range .Rejected}}<li>{{.}}</li>
+    {{end}}</ul>
+  {{end}}<table>
+    <thead><tr><th class="hunk">Hunk</th><th>Extracted text</th><th>Patched text</th></tr></thead>
+    <tbody>
+    {{range .Hunks}}<tr id="source-{{$source}}-hunk-{{.Number}}">
+      <td class="hunk"><a href="#source-{{$source}}-hunk-{{.Number}}">{{.Number}}</a></td>
+      <td class="text">{{range .Text}}{{if .Changed}}<del>{{.Text}}</del>{{else}}{{.Text}}{{end}}{{end}}</td>
+      <td class="text">{{range .Patched}}{{if .Changed}}<ins>{{.Text}}</ins>{{else}}{{.Text}}{{end}}{{end}}</td>
+    </tr>
+    {{end}}</tbody>
+  </table>
+</section>
+{{end}}</body>
+</html>
+`))
@@ -0,0 +1,116 @@
+package pdfpatch
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/motevets/pdfpatch/pkg/extractor"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// ReversePatch returns a patch that turns the text made by applying a patch back into the text extracted from the PDF
+// Flat patches are inverted on their own so inputPDFFilePath may be empty, but the text of the pages
+// of the PDF is needed to locate the hunks of page anchored patches in the patched text.
+func ReversePatch(inputPDFFilePath string, patchFilePath string, options Options) (reversePatch string, err error) {
+	return ReversePatchContext(context.Background(), inputPDFFilePath, patchFilePath, options)
+}
+
+// ReversePatchContext is ReversePatch stopping text extraction once ctx is done
+func ReversePatchContext(ctx context.Context, inputPDFFilePath string, patchFilePath string, options Options) (reversePatch string, err error) {
+	patch, err := ioutil.ReadFile(patchFilePath)
+	if err != nil {
+		return
+	}
+	if !isPagePatch(string(patch)) {
+		return ReversePatchText(string(patch))
+	}
+	if inputPDFFilePath == "" {
+		err = fmt.Errorf("reversing a page anchored patch needs the PDF it was made from")
+		return
+	}
+	textExtractor, err := chooseExtractor("", options)
+	if err != nil {
+		return
+	}
+	pages, err := extractPages(ctx, textExtractor, inputPDFFilePath, options.Pages)
+	if err != nil {
+		return
+	}
+	return ReversePagePatchText(pages, string(patch))
+}
+
+// ReversePatchText inverts a patch (in diff-match-patch text format) so that it turns the patched text
+// back into the original text
+func ReversePatchText(patchText string) (reversePatchText string, err error) {
+	if isPagePatch(patchText) {
+		err = fmt.Errorf("page anchored patches can only be reversed with the text of their pages")
+		return
+	}
+	if isHashedPatch(patchText) {
+		err = fmt.Errorf("hashed patches cannot be reversed, they do not hold the text they delete")
+		return
+	}
+	dmp := diffmatchpatch.New()
+	patches, err := dmp.PatchFromText(patchText)
+	if err != nil {
+		return
+	}
+	var reversed strings.Builder
+	starts := hunkStarts(patches)
+	for i, aPatch := range patches {
+		reversed.WriteString(reverseHunk(aPatch, starts[i]))
+	}
+	return reversed.String(), nil
+}
+
+// ReversePagePatchText inverts a page anchored patch into a flat patch that turns the patched text of pages back
+// into the text of the pages
+// The patched text is not divided into pages so the hunks are located using the length of each page.
+func ReversePagePatchText(pages []extractor.Page, patchText string) (reversePatchText string, err error) {
+	sections, err := parsePageSections(patchText)
+	if err != nil {
+		return
+	}
+	var (
+		reversed   strings.Builder
+		textOffset int
+	)
+	for _, page := range pages {
+		starts := hunkStarts(sections[page.Number])
+		for i, aPatch := range sections[page.Number] {
+			reversed.WriteString(reverseHunk(aPatch, textOffset+starts[i]))
+		}
+		textOffset += len(page.Text)
+	}
+	return reversed.String(), nil
+}
+
+// reverseHunk returns the text form of a hunk with its insertions and deletions swapped, since diffmatchpatch
+// does not export the diffs of a patch
+// Like the hunks diffmatchpatch makes, start is where the hunk applies once the hunks before it have been applied.
+func reverseHunk(aPatch diffmatchpatch.Patch, start int) string {
+	header := diffmatchpatch.Patch{
+		Start1:  start,
+		Start2:  start,
+		Length1: aPatch.Length2,
+		Length2: aPatch.Length1,
+	}
+	var reversed strings.Builder
+	reversed.WriteString(header.String())
+	lines := strings.Split(aPatch.String(), "\n")
+	for _, line := range lines[1:] {
+		if len(line) == 0 {
+			continue
+		}
+		switch line[0] {
+		case '-':
+			line = "+" + line[1:]
+		case '+':
+			line = "-" + line[1:]
+		}
+		reversed.WriteString(line + "\n")
+	}
+	return reversed.String()
+}
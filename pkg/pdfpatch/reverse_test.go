@@ -0,0 +1,72 @@
+package pdfpatch_test
+
+import (
+	"github.com/motevets/pdfpatch/pkg/extractor"
+	"github.com/motevets/pdfpatch/pkg/pdfpatch"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("reverse patches", func() {
+	Describe("ReversePatchText", func() {
+		const text = "Hello from chapter 1. Hallo von Kapitel 2. "
+
+		It("turns the patched text back into the original text", func() {
+			reversed, err := pdfpatch.ReversePatchText(pdfpatch.MakePatchText(text, finalOutput))
+			Expect(err).NotTo(HaveOccurred())
+
+			result, err := pdfpatch.ApplyPatchText(finalOutput, reversed)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Rejected()).To(BeEmpty())
+			Expect(result.Text).To(Equal(text))
+			for _, hunk := range result.Hunks {
+				Expect(hunk.Offset).To(BeZero())
+			}
+		})
+
+		It("gives back the patch when it is reversed twice", func() {
+			reversed, err := pdfpatch.ReversePatchText(computedPatch)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pdfpatch.ReversePatchText(reversed)).To(Equal(computedPatch))
+		})
+
+		When("the patch is page anchored", func() {
+			It("returns an error", func() {
+				_, err := pdfpatch.ReversePatchText("#pdfpatch pages\n#page 1\n")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		When("the patch is malformed", func() {
+			It("returns an error", func() {
+				_, err := pdfpatch.ReversePatchText("@@ not a hunk\n")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("ReversePagePatchText", func() {
+		var pages = []extractor.Page{
+			{Number: 1, Text: "TITLE PAGE "},
+			{Number: 2, Text: "Dedicated to my fellow men. "},
+			{Number: 3, Text: "This is chapter 1. "},
+		}
+		const target = "\nNEW TITLE PAGE\n\nDedicated to my fellow men.\n\nThis is chapter 1.\n\nIt's pretty great.\n"
+
+		It("turns the patched text of the pages back into the text of the pages", func() {
+			patchText, err := pdfpatch.MakePagePatchText(pages, target)
+			Expect(err).NotTo(HaveOccurred())
+			reversed, err := pdfpatch.ReversePagePatchText(pages, patchText)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reversed).NotTo(HavePrefix("#pdfpatch pages"))
+
+			result, err := pdfpatch.ApplyPatchText(target, reversed)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Rejected()).To(BeEmpty())
+			Expect(result.Text).To(Equal("TITLE PAGE Dedicated to my fellow men. This is chapter 1. "))
+			for _, hunk := range result.Hunks {
+				Expect(hunk.Offset).To(BeZero())
+			}
+		})
+	})
+})
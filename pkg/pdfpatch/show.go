@@ -0,0 +1,97 @@
+package pdfpatch
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// DefaultContextWords is the most unchanged words shown around each change
+const DefaultContextWords = 8
+
+// nonSpacePattern matches the words of text without the space between them
+var nonSpacePattern = regexp.MustCompile(`\S+`)
+
+// DiffHunk is an applied hunk of a patch with the unchanged words around its changes
+// Number is the number of the hunk in the patch, as in HunkResult
+type DiffHunk struct {
+	Number int
+	Diffs  []diffmatchpatch.Diff
+}
+
+// PatchDiff is the change a patch makes to the text of a PDF, hunk by hunk
+type PatchDiff struct {
+	Result PatchResult
+	Hunks  []DiffHunk
+}
+
+// ShowPatch applies a patch to the text of a PDF and returns the changes of each applied hunk, with up to
+// contextWords of the unchanged words the hunk is anchored to around them
+// Rejected hunks of the patch are not an error, they are left in the result for the caller to report.
+func ShowPatch(inputPDFFilePath string, patchFilePath string, contextWords int, options Options) (patchDiff PatchDiff, err error) {
+	return ShowPatchContext(context.Background(), inputPDFFilePath, patchFilePath, contextWords, options)
+}
+
+// ShowPatchContext is ShowPatch stopping text extraction once ctx is done
+func ShowPatchContext(ctx context.Context, inputPDFFilePath string, patchFilePath string, contextWords int, options Options) (patchDiff PatchDiff, err error) {
+	extracted, err := extractForPatch(ctx, inputPDFFilePath, patchFilePath, options)
+	if err != nil {
+		return
+	}
+	patchDiff.Result, err = extracted.apply()
+	if err != nil {
+		return
+	}
+	patchDiff.Hunks = DiffHunks(patchDiff.Result, contextWords)
+	return
+}
+
+// DiffHunks returns the applied hunks of a patch result, numbered as in the patch, keeping up to
+// contextWords unchanged words before and after the changes of each hunk
+func DiffHunks(result PatchResult, contextWords int) (hunks []DiffHunk) {
+	for _, hunk := range result.Hunks {
+		if !hunk.Applied || len(hunk.Diffs) == 0 {
+			continue
+		}
+		diffs := append([]diffmatchpatch.Diff{}, hunk.Diffs...)
+		if first := &diffs[0]; first.Type == diffmatchpatch.DiffEqual {
+			first.Text = lastWords(first.Text, contextWords)
+		}
+		if last := &diffs[len(diffs)-1]; last.Type == diffmatchpatch.DiffEqual {
+			last.Text = firstWords(last.Text, contextWords)
+		}
+		var trimmed []diffmatchpatch.Diff
+		for _, diff := range diffs {
+			if diff.Text != "" {
+				trimmed = append(trimmed, diff)
+			}
+		}
+		hunks = append(hunks, DiffHunk{Number: hunk.Number, Diffs: trimmed})
+	}
+	return
+}
+
+// firstWords returns text up to the end of its first n words, nothing if n is not positive
+func firstWords(text string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	words := nonSpacePattern.FindAllStringIndex(text, -1)
+	if n < len(words) {
+		return text[:words[n-1][1]]
+	}
+	return text
+}
+
+// lastWords returns text from the start of its last n words, nothing if n is not positive
+func lastWords(text string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	words := nonSpacePattern.FindAllStringIndex(text, -1)
+	if n < len(words) {
+		return text[words[len(words)-n][0]:]
+	}
+	return text
+}
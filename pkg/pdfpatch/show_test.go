@@ -0,0 +1,156 @@
+package pdfpatch_test
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/motevets/pdfpatch/pkg/pdfpatch"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+var _ = Describe("showing patches", func() {
+	Describe("DiffHunks", func() {
+		const text = "one two three four five six seven eight nine ten eleven twelve thirteen fourteen fifteen "
+
+		applyPatch := func(text string, target string) pdfpatch.PatchResult {
+			result, err := pdfpatch.ApplyPatchText(text, pdfpatch.MakePatchText(text, target))
+			Expect(err).NotTo(HaveOccurred())
+			return result
+		}
+
+		It("shows the changes of each hunk with the context it is anchored to, widened to whole words", func() {
+			result := applyPatch(text, strings.Replace(text, "five", "FIVE", 1))
+			Expect(pdfpatch.DiffHunks(result, 2)).To(Equal([]pdfpatch.DiffHunk{{
+				Number: 1,
+				Diffs: []diffmatchpatch.Diff{
+					{Type: diffmatchpatch.DiffEqual, Text: "four "},
+					{Type: diffmatchpatch.DiffDelete, Text: "five"},
+					{Type: diffmatchpatch.DiffInsert, Text: "FIVE"},
+					{Type: diffmatchpatch.DiffEqual, Text: " six"},
+				},
+			}}))
+			Expect(pdfpatch.DiffHunks(result, 0)[0].Diffs).To(Equal([]diffmatchpatch.Diff{
+				{Type: diffmatchpatch.DiffDelete, Text: "five"},
+				{Type: diffmatchpatch.DiffInsert, Text: "FIVE"},
+			}))
+		})
+
+		When("contextWords is negative", func() {
+			It("shows no context", func() {
+				result := applyPatch(text, strings.Replace(text, "five", "FIVE", 1))
+				Expect(pdfpatch.DiffHunks(result, -1)).To(Equal(pdfpatch.DiffHunks(result, 0)))
+			})
+		})
+
+		It("numbers the hunks as the patch does, leaving out rejected hunks", func() {
+			target := strings.Replace(strings.Replace(text, "two", "TWO", 1), "fourteen", "FOURTEEN", 1)
+			patch := pdfpatch.MakePatchText(text, target)
+			result, err := pdfpatch.ApplyPatchText(strings.Replace(text, "one two three", "1 2 3", 1), patch)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Rejected()).To(HaveLen(1))
+			Expect(result.Rejected()[0].Number).To(Equal(1))
+
+			hunks := pdfpatch.DiffHunks(result, 1)
+			Expect(hunks).To(HaveLen(1))
+			Expect(hunks[0].Number).To(Equal(2))
+			Expect(hunks[0].Diffs).To(ContainElement(diffmatchpatch.Diff{Type: diffmatchpatch.DiffInsert, Text: "FOURTEEN"}))
+		})
+
+		It("shows the source text of the hunks of hashed patches", func() {
+			target := strings.Replace(text, "five", "FIVE", 1)
+			result, err := pdfpatch.ApplyHashedPatchText(text, pdfpatch.MakeHashedPatchText(text, target))
+			Expect(err).NotTo(HaveOccurred())
+			hunks := pdfpatch.DiffHunks(result, 2)
+			Expect(hunks).To(HaveLen(1))
+			Expect(hunks[0].Diffs).To(ContainElement(diffmatchpatch.Diff{Type: diffmatchpatch.DiffDelete, Text: "five"}))
+		})
+	})
+
+	Describe("ShowPatch with the gopdf extractor", func() {
+		const fixturesPath = "../../test/fixtures/one_pdf_two_markdowns"
+		var pdfPath = path.Join(fixturesPath, "original.pdf")
+		var markdownPaths = []string{path.Join(fixturesPath, "chapter_1.md"), path.Join(fixturesPath, "chapter_2.md")}
+
+		showPatch := func(options pdfpatch.Options) pdfpatch.PatchDiff {
+			patch, err := pdfpatch.GeneratePatch(pdfPath, markdownPaths, options)
+			Expect(err).NotTo(HaveOccurred())
+			patchFilePath := writePatchFile(patch)
+			defer os.Remove(patchFilePath)
+
+			patchDiff, err := pdfpatch.ShowPatch(pdfPath, patchFilePath, pdfpatch.DefaultContextWords, options)
+			Expect(err).NotTo(HaveOccurred())
+			return patchDiff
+		}
+
+		changes := func(patchDiff pdfpatch.PatchDiff) (diffs []diffmatchpatch.Diff) {
+			Expect(patchDiff.Hunks).To(HaveLen(patchDiff.Result.Applied()))
+			for i, hunk := range patchDiff.Hunks {
+				Expect(hunk.Number).To(Equal(patchDiff.Result.Hunks[i].Number))
+				diffs = append(diffs, hunk.Diffs...)
+			}
+			return
+		}
+
+		It("shows the words the patch changes", func() {
+			patchDiff := showPatch(pdfpatch.Options{Extractor: "gopdf"})
+			Expect(patchDiff.Result.Text).To(Equal(finalOutput))
+			Expect(changes(patchDiff)).To(ContainElement(diffmatchpatch.Diff{Type: diffmatchpatch.DiffInsert, Text: "\n\nPAGE 2\n\nAuf wiedersehen"}))
+		})
+
+		It("shows the words a page anchored patch changes", func() {
+			patchDiff := showPatch(pdfpatch.Options{Extractor: "gopdf", PageAnchored: true})
+			Expect(changes(patchDiff)).To(ContainElement(diffmatchpatch.Diff{Type: diffmatchpatch.DiffDelete, Text: "Hallo"}))
+		})
+	})
+
+	Describe("writing patch diffs", func() {
+		var patchDiffs = []pdfpatch.PatchDiff{{
+			Result: pdfpatch.PatchResult{
+				PDFFileName: "original.pdf",
+				Hunks: []pdfpatch.HunkResult{
+					{Number: 1, Applied: true},
+					{Number: 2, Expected: 30, Actual: -1, Context: "Kapitel"},
+				},
+			},
+			Hunks: []pdfpatch.DiffHunk{{
+				Number: 1,
+				Diffs: []diffmatchpatch.Diff{
+					{Type: diffmatchpatch.DiffEqual, Text: "Hello "},
+					{Type: diffmatchpatch.DiffDelete, Text: "<from> "},
+					{Type: diffmatchpatch.DiffInsert, Text: "to "},
+					{Type: diffmatchpatch.DiffEqual, Text: "chapter 1."},
+				},
+			}},
+		}}
+
+		It("writes the changed words between markers", func() {
+			var out bytes.Buffer
+			Expect(pdfpatch.WriteDiff(&out, patchDiffs, false)).To(Succeed())
+			Expect(out.String()).To(Equal(`== original.pdf: 1/2 hunks applied
+@@ hunk 1 @@
+Hello [-<from> -]{+to +}chapter 1.
+patch hunk #2 REJECTED at 30: "Kapitel"
+`))
+		})
+
+		It("colours the changed words for a terminal", func() {
+			var out bytes.Buffer
+			Expect(pdfpatch.WriteDiff(&out, patchDiffs, true)).To(Succeed())
+			Expect(out.String()).To(ContainSubstring("\x1b[31m[-<from> -]\x1b[0m\x1b[32m{+to +}\x1b[0m"))
+		})
+
+		It("writes an HTML report with the extracted and patched text of each hunk side by side", func() {
+			var out bytes.Buffer
+			Expect(pdfpatch.WriteHTMLReport(&out, patchDiffs)).To(Succeed())
+			Expect(out.String()).To(ContainSubstring("<h2>original.pdf</h2>"))
+			Expect(out.String()).To(ContainSubstring(`<tr id="source-0-hunk-1">`))
+			Expect(out.String()).To(ContainSubstring(`<td class="text">Hello <del>&lt;from&gt; </del>chapter 1.</td>`))
+			Expect(out.String()).To(ContainSubstring(`<td class="text">Hello <ins>to </ins>chapter 1.</td>`))
+			Expect(out.String()).To(ContainSubstring("patch hunk #2 REJECTED at 30: &#34;Kapitel&#34;"))
+		})
+	})
+})
@@ -0,0 +1,107 @@
+package pdfpatch
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// SourceError is the failure of one of several source PDFs
+type SourceError struct {
+	FileName string
+	Err      error
+}
+
+func (e *SourceError) Error() string {
+	return fmt.Sprintf("%s: %v", e.FileName, e.Err)
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// SourceErrors is returned when more than one source PDF fails, listing them in the order of the sources
+// It unwraps to the first of them.
+type SourceErrors []*SourceError
+
+func (errs SourceErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d sources failed:\n  %s", len(errs), strings.Join(messages, "\n  "))
+}
+
+func (errs SourceErrors) Unwrap() error {
+	return errs[0]
+}
+
+// jobs returns the number of sources to process at the same time
+func (options Options) jobs() int {
+	if options.Jobs < 1 {
+		return runtime.NumCPU()
+	}
+	return options.Jobs
+}
+
+// forEachSource calls process with the index of each source PDF, running up to jobs at the same time
+// Every source is processed even if others fail. The error of a single failing source is returned as
+// is, otherwise the errors of all of them are returned as SourceErrors. If ctx is done its error is
+// returned instead.
+func forEachSource(ctx context.Context, fileNames []string, jobs int, process func(i int) error) error {
+	var (
+		errs      = make([]error, len(fileNames))
+		slots     = make(chan struct{}, jobs)
+		waitGroup sync.WaitGroup
+	)
+	for i := range fileNames {
+		slots <- struct{}{}
+		if ctx.Err() != nil {
+			break
+		}
+		waitGroup.Add(1)
+		go func(i int) {
+			defer func() {
+				<-slots
+				waitGroup.Done()
+			}()
+			errs[i] = process(i)
+		}(i)
+	}
+	waitGroup.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	var sourceErrs SourceErrors
+	for i, err := range errs {
+		if err != nil {
+			sourceErrs = append(sourceErrs, &SourceError{FileName: fileNames[i], Err: err})
+		}
+	}
+	switch len(sourceErrs) {
+	case 0:
+		return nil
+	case 1:
+		return sourceErrs[0].Err
+	default:
+		return sourceErrs
+	}
+}
+
+// synchronized returns a copy of options whose Progress may be called from several goroutines at once
+func (options Options) synchronized() Options {
+	if options.Progress == nil {
+		return options
+	}
+	var mutex sync.Mutex
+	progress := options.Progress
+	options.Progress = func(event ProgressEvent) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		progress(event)
+	}
+	return options
+}
@@ -0,0 +1,114 @@
+package sourcestore
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore is a Store in a directory of the local file system
+//
+// Each source is written to sha256/HASH.pdf, and md5/HASH holds the sha256 of the source with that md5.
+type LocalStore struct {
+	Dir string
+}
+
+// NewLocalStore returns a store in dir, creating it if needed
+func NewLocalStore(dir string) (store *LocalStore, err error) {
+	for _, subDir := range []string{"sha256", "md5"} {
+		err = os.MkdirAll(filepath.Join(dir, subDir), 0755)
+		if err != nil {
+			return
+		}
+	}
+	return &LocalStore{Dir: dir}, nil
+}
+
+// Has reports whether the store has the source with the hash
+func (store *LocalStore) Has(hash string) (found bool, err error) {
+	sourcePath, err := store.sourcePath(hash)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return
+	}
+	_, err = os.Stat(sourcePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Put writes a source to the store, checking it has expectedHash unless it is empty
+func (store *LocalStore) Put(expectedHash string, contents io.Reader) (sums Checksums, err error) {
+	if expectedHash != "" {
+		expectedHash, err = CheckHash(expectedHash)
+		if err != nil {
+			return
+		}
+	}
+	tempFile, err := ioutil.TempFile(store.Dir, "upload-*.tmp")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tempFile.Name())
+
+	md5Hash, sha256Hash := md5.New(), sha256.New()
+	_, err = io.Copy(io.MultiWriter(tempFile, md5Hash, sha256Hash), contents)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+	sums = Checksums{Md5: hex.EncodeToString(md5Hash.Sum(nil)), Sha256: hex.EncodeToString(sha256Hash.Sum(nil))}
+	if expectedHash != "" && !sums.Matches(expectedHash) {
+		return sums, &HashMismatchError{Expected: expectedHash, Actual: sums}
+	}
+
+	err = os.Rename(tempFile.Name(), filepath.Join(store.Dir, "sha256", sums.Sha256+".pdf"))
+	if err != nil {
+		return
+	}
+	err = ioutil.WriteFile(filepath.Join(store.Dir, "md5", sums.Md5), []byte(sums.Sha256), 0644)
+	return
+}
+
+// Open returns the contents of the source with the hash or ErrNotFound
+func (store *LocalStore) Open(hash string) (contents io.ReadCloser, err error) {
+	sourcePath, err := store.sourcePath(hash)
+	if err != nil {
+		return
+	}
+	file, err := os.Open(sourcePath)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+// sourcePath returns where the source with the hash is written, looking up the sha256 of md5 hashes
+func (store *LocalStore) sourcePath(hash string) (sourcePath string, err error) {
+	hash, err = CheckHash(hash)
+	if err != nil {
+		return
+	}
+	if len(hash) == md5.Size*2 {
+		var sha256Hash []byte
+		sha256Hash, err = ioutil.ReadFile(filepath.Join(store.Dir, "md5", hash))
+		if os.IsNotExist(err) {
+			return "", ErrNotFound
+		}
+		if err != nil {
+			return
+		}
+		hash = strings.TrimSpace(string(sha256Hash))
+	}
+	return filepath.Join(store.Dir, "sha256", hash+".pdf"), nil
+}
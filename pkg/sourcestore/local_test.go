@@ -0,0 +1,90 @@
+package sourcestore_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/motevets/pdfpatch/pkg/sourcestore"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LocalStore", func() {
+	const (
+		pdfPath   = "../../test/fixtures/patch_bundle_pdfs/title_pages.pdf"
+		md5Sum    = "663d57d25413c9da4808f89919436090"
+		sha256Sum = "4f7698a2562733dc3cd17a0bda13374c3f8e781d16b18631f41a506fbeb1d935"
+	)
+	var (
+		storeDir string
+		store    *sourcestore.LocalStore
+		contents []byte
+	)
+
+	BeforeEach(func() {
+		var err error
+		storeDir, err = ioutil.TempDir("", "source_store")
+		Expect(err).NotTo(HaveOccurred())
+		store, err = sourcestore.NewLocalStore(storeDir)
+		Expect(err).NotTo(HaveOccurred())
+		contents, err = ioutil.ReadFile(pdfPath)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(storeDir)
+	})
+
+	It("stores a source that can be found by its md5 or sha256", func() {
+		Expect(store.Has(sha256Sum)).To(BeFalse())
+
+		sums, err := store.Put(strings.ToUpper(md5Sum), bytes.NewReader(contents))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sums).To(Equal(sourcestore.Checksums{Md5: md5Sum, Sha256: sha256Sum}))
+
+		for _, hash := range []string{md5Sum, sha256Sum} {
+			Expect(store.Has(hash)).To(BeTrue())
+			source, err := store.Open(hash)
+			Expect(err).NotTo(HaveOccurred())
+			stored, err := ioutil.ReadAll(source)
+			source.Close()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored).To(Equal(contents))
+		}
+	})
+
+	It("stores a source without an expected hash", func() {
+		sums, err := store.Put("", bytes.NewReader(contents))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sums.Sha256).To(Equal(sha256Sum))
+		Expect(store.Has(md5Sum)).To(BeTrue())
+	})
+
+	When("the source does not have the expected hash", func() {
+		It("returns a hash mismatch error and does not store it", func() {
+			_, err := store.Put(sha256Sum, bytes.NewReader([]byte("not the PDF")))
+			var mismatchErr *sourcestore.HashMismatchError
+			Expect(errors.As(err, &mismatchErr)).To(BeTrue())
+			Expect(mismatchErr.Expected).To(Equal(sha256Sum))
+			Expect(store.Has(sha256Sum)).To(BeFalse())
+			Expect(ioutil.ReadDir(storeDir + "/sha256")).To(BeEmpty())
+		})
+	})
+
+	When("the source is not stored", func() {
+		It("returns ErrNotFound", func() {
+			_, err := store.Open(md5Sum)
+			Expect(err).To(Equal(sourcestore.ErrNotFound))
+		})
+	})
+
+	When("the hash is not an md5 or sha256", func() {
+		It("returns an invalid hash error", func() {
+			_, err := store.Has("../../etc/passwd")
+			Expect(err).To(MatchError(`"../../etc/passwd" is not a hex md5 or sha256 hash`))
+		})
+	})
+})
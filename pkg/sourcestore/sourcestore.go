@@ -0,0 +1,74 @@
+package sourcestore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// ErrNotFound is returned when a store has no source with a hash
+var ErrNotFound = errors.New("source not found")
+
+// hashPattern matches the hex md5 (32 characters) and sha256 (64 characters) hashes of sources
+var hashPattern = regexp.MustCompile(`^([0-9a-f]{32}|[0-9a-f]{64})$`)
+
+// Store keeps source PDFs so they only need to be uploaded once
+//
+// Sources are identified by the md5 or sha256 of their contents, like the checksums of manifest
+// sources, and either may be used to look up a source.
+type Store interface {
+	// Has reports whether the store has the source with the hash
+	Has(hash string) (bool, error)
+	// Put stores a source, failing with a *HashMismatchError if expectedHash is not empty
+	// and is not a hash of contents
+	Put(expectedHash string, contents io.Reader) (Checksums, error)
+	// Open returns the contents of the source with the hash or ErrNotFound
+	Open(hash string) (io.ReadCloser, error)
+}
+
+// Checksums are the hashes of a source, as hex strings
+type Checksums struct {
+	Md5    string
+	Sha256 string
+}
+
+// Matches reports whether hash is either of the checksums
+func (sums Checksums) Matches(hash string) bool {
+	hash = NormalizeHash(hash)
+	return hash == sums.Md5 || hash == sums.Sha256
+}
+
+// InvalidHashError is returned for a hash that is neither a hex md5 nor sha256
+type InvalidHashError struct {
+	Hash string
+}
+
+func (e *InvalidHashError) Error() string {
+	return fmt.Sprintf("%q is not a hex md5 or sha256 hash", e.Hash)
+}
+
+// HashMismatchError is returned when the contents of a source do not have the hash they were stored as
+type HashMismatchError struct {
+	Expected string
+	Actual   Checksums
+}
+
+func (e *HashMismatchError) Error() string {
+	return fmt.Sprintf("source does not have the hash %s (md5 %s, sha256 %s)", e.Expected, e.Actual.Md5, e.Actual.Sha256)
+}
+
+// NormalizeHash returns hash in lower case without surrounding space
+func NormalizeHash(hash string) string {
+	return strings.ToLower(strings.TrimSpace(hash))
+}
+
+// CheckHash returns the normalized hash or an *InvalidHashError if it is not an md5 or sha256 hash
+func CheckHash(hash string) (string, error) {
+	normalized := NormalizeHash(hash)
+	if !hashPattern.MatchString(normalized) {
+		return "", &InvalidHashError{Hash: hash}
+	}
+	return normalized, nil
+}
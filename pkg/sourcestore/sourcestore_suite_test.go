@@ -0,0 +1,13 @@
+package sourcestore_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestSourcestore(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Sourcestore Suite")
+}
@@ -0,0 +1,52 @@
+package workspace
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+)
+
+// Workspace is a temporary directory that owns the intermediate files of one run
+// (unpacked bundles, patched markdowns, bound HTML, uploads) so they can be removed together.
+type Workspace struct {
+	Dir  string
+	keep bool
+}
+
+// New creates a workspace in a new temporary directory named with prefix
+// If keep is set the directory is left in place by Close, for debugging.
+func New(prefix string, keep bool) (ws *Workspace, err error) {
+	dir, err := ioutil.TempDir("", prefix)
+	if err != nil {
+		return
+	}
+	return &Workspace{Dir: dir, keep: keep}, nil
+}
+
+// Path returns the path of a file or directory within the workspace
+func (ws *Workspace) Path(elem ...string) string {
+	return path.Join(append([]string{ws.Dir}, elem...)...)
+}
+
+// Mkdir creates a directory within the workspace and returns its path
+func (ws *Workspace) Mkdir(name string) (dir string, err error) {
+	dir = ws.Path(name)
+	err = os.MkdirAll(dir, 0755)
+	return
+}
+
+// TempFile creates a new file within the workspace named by pattern (see ioutil.TempFile)
+func (ws *Workspace) TempFile(pattern string) (*os.File, error) {
+	return ioutil.TempFile(ws.Dir, pattern)
+}
+
+// Close removes the workspace and everything in it unless it is kept
+// Close may be called more than once.
+func (ws *Workspace) Close() error {
+	if ws.keep {
+		log.Println("work directory kept:", ws.Dir)
+		return nil
+	}
+	return os.RemoveAll(ws.Dir)
+}
@@ -0,0 +1,39 @@
+package workspace_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/motevets/pdfpatch/pkg/workspace"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Workspace", func() {
+	It("removes everything written to it when closed", func() {
+		ws, err := workspace.New("workspace_test", false)
+		Expect(err).NotTo(HaveOccurred())
+		dir, err := ws.Mkdir("markdowns")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dir).To(Equal(path.Join(ws.Dir, "markdowns")))
+		Expect(ioutil.WriteFile(path.Join(dir, "chapter_1.md"), []byte("text"), 0644)).To(Succeed())
+		file, err := ws.TempFile("bound-*.html")
+		Expect(err).NotTo(HaveOccurred())
+		file.Close()
+		Expect(path.Dir(file.Name())).To(Equal(ws.Dir))
+
+		Expect(ws.Close()).To(Succeed())
+		Expect(ws.Dir).NotTo(BeAnExistingFile())
+		Expect(ws.Close()).To(Succeed())
+	})
+
+	It("is left in place when closed if it is kept", func() {
+		ws, err := workspace.New("workspace_test", true)
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(ws.Dir)
+
+		Expect(ws.Close()).To(Succeed())
+		Expect(ws.Dir).To(BeADirectory())
+	})
+})